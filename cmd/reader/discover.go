@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reader/internal/discovery"
+	"reader/internal/feed"
+	"reader/internal/storage"
+)
+
+// discover subscribes the default user to the feeds found on the given
+// sites, keeping them in bolt storage so that they are read once the
+// reader is started.
+//
+//	reader discover -db=reader.db https://example.com
+func discover(args []string) {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reader discover [-db file] <site URL>...")
+		fs.PrintDefaults()
+	}
+
+	var dbFile = fs.String("db", "reader.db", "database file used by bolt storage")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	s, err := storage.NewBoltStorage(*dbFile, 30)
+	if err != nil {
+		fmt.Printf("Could not open database file: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	d := discovery.NewDiscoverer()
+
+	failed := false
+	for _, site := range fs.Args() {
+		u, err := url.Parse(site)
+		if err != nil || !u.IsAbs() {
+			fmt.Printf("Site link must be an absolute URL: %s\n", site)
+			failed = true
+			continue
+		}
+
+		found, err := d.Discover(context.Background(), u)
+		if err != nil {
+			fmt.Printf("Could not discover feeds of %s: %v\n", site, err)
+			failed = true
+			continue
+		}
+
+		for _, df := range found {
+			f := &feed.Feed{FeedLink: df.FeedLink, Title: df.Title}
+
+			// Feeds which have moved are found by their new feed link
+			existing, err := s.Feed(f.UUID())
+			if errors.Is(err, storage.ErrFeedNotFound) {
+				existing, err = storage.FeedWithLink(s, f.FeedLink.String())
+			}
+
+			switch {
+			case err == nil:
+				f = existing
+			case errors.Is(err, storage.ErrFeedNotFound):
+				err = s.Store(f, nil)
+			}
+
+			if err != nil {
+				fmt.Printf("Could not store feed %s: %v\n", f.FeedLink, err)
+				failed = true
+				continue
+			}
+
+			err = s.Subscribe(storage.DefaultUser, f.UUID())
+			switch {
+			case errors.Is(err, storage.ErrSubscribed):
+				fmt.Printf("%s (already subscribed)\n", f.FeedLink)
+			case err != nil:
+				fmt.Printf("Could not subscribe to feed %s: %v\n", f.FeedLink, err)
+				failed = true
+			default:
+				fmt.Println(f.FeedLink)
+			}
+		}
+	}
+
+	if failed {
+		s.Close()
+		os.Exit(1)
+	}
+}
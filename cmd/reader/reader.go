@@ -3,69 +3,230 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/google/uuid"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"reader/internal/api"
 	"reader/internal/feed"
+	"reader/internal/opml"
 	"reader/internal/reader"
 	"reader/internal/storage"
+	"reader/internal/webhook"
+	"strings"
 	"sync"
 	"time"
 )
 
 func main() {
 
+	// Subcommands are given before any flags
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		discover(os.Args[2:])
+		return
+	}
+
 	// Define file flag which needs to point to a JSON file containing
-	// an array of feed URL's/
+	// an array of feed URL's, or of objects for feeds with settings/
 	var feedFile = flag.String("file", "", "file of feeds")
+
+	// Define OPML flag which points to an OPML file exported from another
+	// reader. It can be given instead of, or as well as, the file flag.
+	var opmlFile = flag.String("opml", "", "OPML file of feeds")
+
+	// Define storage flags which select where feeds and articles are kept.
+	// In memory storage is lost on restart whereas bolt storage is kept
+	// in a single database file on disk.
+	var storageType = flag.String("storage", "memory", "storage backend to use (memory or bolt)")
+	var dbFile = flag.String("db", "reader.db", "database file used by bolt storage")
+
+	// Define retention flags which control how many articles are kept in
+	// storage. A value of 0 disables the given limit.
+	var maxPerFeed = flag.Uint("max-per-feed", 0, "maximum number of articles to keep per feed")
+	var maxAge = flag.Duration("max-age", 0, "maximum age of articles to keep")
+	var maxTotal = flag.Uint("max-total", 0, "maximum number of articles to keep across all feeds")
+	var compactInterval = flag.Duration("compact-interval", 10*time.Minute, "interval between storage compactions")
+
+	// Define authentication flags. When enabled every request needs an API
+	// key, and the admin key can be used to create the first API keys. The
+	// admin key is read from the environment by default so that it does not
+	// show up in the process list.
+	var auth = flag.Bool("auth", false, "require an API key for every request")
+	var adminKey = flag.String("admin-key", os.Getenv("READER_ADMIN_KEY"), "API key with admin scope, enables -auth")
+
+	// Define WebSub flag which is the public URL that /websub is reachable
+	// at. Feeds which advertise a hub are subscribed to it and have their
+	// content pushed rather than being polled.
+	var websubCallback = flag.String("websub-callback", "", "public URL of /websub, enables WebSub (e.g. https://reader.example.com/websub)")
+
+	// Define allowed origins flag for pages on other sites which connect
+	// websockets. Pages on the same host as the API can always connect.
+	var allowedOrigins = flag.String("allowed-origins", "", "comma separated origins of other sites which may connect to /ws (e.g. https://app.example.com)")
+
+	// Define sanitise flag which can be turned off to keep article HTML as
+	// it was published, for clients which sanitise it themselves
+	var sanitizeHTML = flag.Bool("sanitize", true, "sanitize the HTML of article descriptions and content")
 	flag.Parse()
 
-	if *feedFile == "" {
-		fmt.Println("Please specify -file argument")
+	// Bolt storage can be started with only the feeds it already holds,
+	// such as those added by the discover subcommand
+	if *feedFile == "" && *opmlFile == "" && *storageType != "bolt" {
+		fmt.Println("Please specify -file or -opml argument")
 		os.Exit(1)
 	}
 
-	f, err := os.Open(*feedFile)
-	if err != nil {
-		fmt.Printf("Could not open feed file: %v\n", err)
-		os.Exit(1)
+	var feedLinks []feedEntry
+	if *feedFile != "" {
+		f, err := os.Open(*feedFile)
+		if err != nil {
+			fmt.Printf("Could not open feed file: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := json.NewDecoder(f).Decode(&feedLinks); err != nil {
+			fmt.Printf("Could not parse feed file as JSON: %v\n", err)
+			os.Exit(1)
+		}
+		f.Close()
 	}
 
-	var feedLinks []string
-	if err := json.NewDecoder(f).Decode(&feedLinks); err != nil {
-		fmt.Printf("Could not parse feed file as JSON: %v\n", err)
-		os.Exit(1)
+	// Titles and site links from OPML are kept until the feeds are read
+	var entries []opml.Entry
+	if *opmlFile != "" {
+		f, err := os.Open(*opmlFile)
+		if err != nil {
+			fmt.Printf("Could not open OPML file: %v\n", err)
+			os.Exit(1)
+		}
+
+		o, err := opml.Parse(f)
+		if err != nil {
+			fmt.Printf("Could not parse OPML file: %v\n", err)
+			os.Exit(1)
+		}
+		f.Close()
+
+		entries = o.Entries()
+	}
+
+	fullContent := map[string]bool{}
+	for _, fl := range feedLinks {
+		entries = append(entries, opml.Entry{FeedLink: fl.FeedLink})
+		fullContent[fl.FeedLink] = fl.FullContent
 	}
 
 	ctx, cf := context.WithCancel(context.Background())
 	go catchSignal(cf)
 
-	var s storage.Storage = storage.NewInMemoryStorage(30)
+	var s storage.Storage
+	switch *storageType {
+	case "memory":
+		s = storage.NewInMemoryStorage(30)
+	case "bolt":
+		bs, err := storage.NewBoltStorage(*dbFile, 30)
+		if err != nil {
+			fmt.Printf("Could not open database file: %v\n", err)
+			os.Exit(1)
+		}
+		defer bs.Close()
+		s = bs
+	default:
+		fmt.Printf("Unknown storage backend: %s\n", *storageType)
+		os.Exit(1)
+	}
+
+	// Keep track of feeds we already know about so that persisted feeds
+	// are not reset when the program is restarted. Feeds which have moved
+	// keep the UUID of the link they were given by, so are known by both.
+	existing, err := s.Feeds()
+	if err != nil {
+		log.Printf("Could not retrieve existing feeds from storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	known := make(map[uuid.UUID]*feed.Feed, len(existing))
+	for _, f := range existing {
+		known[f.UUID()] = f
+		known[feed.UUIDFromString(f.FeedLink.String())] = f
+	}
 
 	// Loop through all given feeds and try to store them for later retrieval
-	for _, fl := range feedLinks {
-		u, err := url.Parse(fl)
+	for _, e := range entries {
+		u, err := url.Parse(e.FeedLink)
 		if err != nil {
 			log.Printf("Could not parse feed link as URL: %v\n", err)
 			continue
 		}
 
-		err = s.Store(&feed.Feed{
-			FeedLink:   u,
-			ModifiedAt: time.Time{},
-		}, nil)
-		if err != nil {
-			log.Printf("Could not store feed URL: %v\n", err)
+		f := &feed.Feed{
+			FeedLink:    u,
+			ModifiedAt:  time.Time{},
+			Title:       e.Title,
+			Link:        e.SiteLink,
+			FullContent: fullContent[e.FeedLink],
+		}
+
+		if k, ok := known[f.UUID()]; !ok {
+			if err := s.Store(f, nil); err != nil {
+				log.Printf("Could not store feed URL: %v\n", err)
+				continue
+			}
+		} else {
+			f = k
+
+			// Feeds given as plain links leave full content as it is, so
+			// that it can be turned on through the API as well
+			if fullContent[e.FeedLink] && !k.FullContent {
+				updated := *k
+				updated.FullContent = true
+				if err := s.UpdateFeed(k.UUID(), &updated); err != nil {
+					log.Printf("Could not update feed: %v\n", err)
+				}
+			}
+		}
+
+		// Feeds given on the command line belong to the default user
+		err = s.Subscribe(storage.DefaultUser, f.UUID())
+		if err != nil && !errors.Is(err, storage.ErrSubscribed) {
+			log.Printf("Could not subscribe to feed: %v\n", err)
+			continue
+		}
+
+		if e.Folder() == "" {
 			continue
 		}
+
+		folder, err := storage.FolderNamed(s, storage.DefaultUser, e.Folder())
+		if err == nil {
+			err = s.SetFolder(storage.DefaultUser, f.UUID(), folder.UUID)
+		}
+		if err != nil {
+			log.Printf("Could not add feed to folder: %v\n", err)
+		}
 	}
 
-	r := reader.NewReader(s)
+	var readerOptions []reader.Option
+	if !*sanitizeHTML {
+		readerOptions = append(readerOptions, reader.WithPolicy(nil))
+	}
+
+	if *websubCallback != "" {
+		u, err := url.Parse(*websubCallback)
+		if err != nil || !u.IsAbs() {
+			fmt.Printf("WebSub callback must be an absolute URL: %s\n", *websubCallback)
+			os.Exit(1)
+		}
+
+		readerOptions = append(readerOptions, reader.WithWebSub(u))
+	}
+
+	r := reader.NewReader(s, readerOptions...)
 
 	feeds, err := s.Feeds()
 	if err != nil {
@@ -73,6 +234,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Webhooks are dispatched as articles are stored, so the dispatcher
+	// has to be listening before feeds are updated
+	deliveryErrs := webhook.NewDispatcher(s).Run(ctx)
+	go func() {
+		for err := range deliveryErrs {
+			fmt.Printf("Error delivering webhook: %v\n", err)
+		}
+	}()
+
 	errChan := r.Update(ctx, feeds)
 	go func() {
 		for err := range errChan {
@@ -80,10 +250,51 @@ func main() {
 		}
 	}()
 
+	policy := storage.RetentionPolicy{
+		MaxPerFeed: *maxPerFeed,
+		MaxAge:     *maxAge,
+		MaxTotal:   *maxTotal,
+	}
+
+	// Only run the compactor if at least one retention limit is set
+	if policy != (storage.RetentionPolicy{}) {
+		compactions := storage.NewCompactor(s, policy, *compactInterval).Run(ctx)
+		go func() {
+			for c := range compactions {
+				if c.Err != nil {
+					fmt.Printf("Error compacting storage: %v\n", c.Err)
+					continue
+				}
+
+				log.Printf("compacted storage, evicted %d articles (age: %d, feed: %d, total: %d)",
+					c.Sum(), c.Age, c.Feed, c.Total)
+			}
+		}()
+	}
+
+	options := []api.Option{api.WithScheduler(r)}
+	if *auth || *adminKey != "" {
+		options = append(options, api.WithAPIKeys(*adminKey))
+	}
+
+	if *websubCallback != "" {
+		options = append(options, api.WithWebSub(r.WebSub()))
+	}
+
+	if *allowedOrigins != "" {
+		options = append(options, api.WithAllowedOrigins(strings.Split(*allowedOrigins, ",")...))
+	}
+
 	// Initialise our web server
 	srv := http.Server{
 		Addr:    ":8080",
-		Handler: api.NewAPI(s),
+		Handler: api.NewAPI(s, options...),
+
+		// Requests are cancelled on shutdown so that streams are closed
+		// rather than holding up the shutdown
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
 
 	var wg sync.WaitGroup
@@ -106,7 +317,8 @@ func main() {
 		// Create a context which times out after 1 minute. This should give
 		// ample time for all remaining requests to be processed before
 		// force shutting the server.
-		timeoutCtx, _ := context.WithTimeout(context.Background(), 1*time.Minute)
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		defer cancel()
 		if err := srv.Shutdown(timeoutCtx); err != nil {
 			log.Fatalf("Error shutting down server: %v\n", err)
 		}
@@ -115,6 +327,22 @@ func main() {
 	wg.Wait()
 }
 
+// feedEntry is a feed in the file of feeds, given either as its feed
+// link or as an object such as {"FeedLink": "...", "FullContent": true}
+type feedEntry struct {
+	FeedLink    string
+	FullContent bool
+}
+
+func (e *feedEntry) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &e.FeedLink); err == nil {
+		return nil
+	}
+
+	type plain feedEntry
+	return json.Unmarshal(b, (*plain)(e))
+}
+
 // catchSignal will cancel given context if a termination signal is passed to the program
 func catchSignal(cancelFunc context.CancelFunc) {
 	s := make(chan os.Signal, 1)
@@ -4,8 +4,13 @@ go 1.14
 
 require (
 	github.com/bitly/go-simplejson v0.5.0
+	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/google/uuid v1.1.2
+	github.com/gorilla/websocket v1.4.2
+	github.com/kr/pretty v0.3.1 // indirect
 	github.com/mmcdole/gofeed v1.1.0
 	github.com/pquerna/cachecontrol v0.0.0-20200921180117-858c6e7e6b7e
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
 )
@@ -1,18 +1,102 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi"
 	chiMiddleware "github.com/go-chi/chi/middleware"
+	"github.com/google/uuid"
 	"net/http"
+	"net/url"
 	"reader/internal/api/response"
+	"reader/internal/broker"
+	"reader/internal/discovery"
+	"reader/internal/feed"
 	"reader/internal/middleware"
+	"reader/internal/search"
 	"reader/internal/storage"
+	"reader/internal/syndication"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type API struct {
-	s storage.Storage
+	s   storage.Storage
+	sch Scheduler
+
+	// Whether requests must be authenticated by an API key
+	auth bool
+
+	// Key which is always accepted with admin scope, see WithAPIKeys
+	adminKey string
+
+	// Articles added to storage, which are sent on to streams
+	events *broker.Broker
+
+	// Handler for callbacks from WebSub hubs, see WithWebSub
+	websub http.Handler
+
+	// Finds the feeds of sites added by their site link
+	discoverer *discovery.Discoverer
+
+	// Origins of other sites which may connect websockets, see
+	// WithAllowedOrigins
+	origins map[string]bool
+}
+
+// Scheduler is notified whenever feeds are added or removed through
+// the API so that they are picked up or dropped without a restart.
+type Scheduler interface {
+	Add(f *feed.Feed)
+	Remove(id uuid.UUID)
+}
+
+// noopScheduler is used when no scheduler is given to the API
+type noopScheduler struct{}
+
+func (noopScheduler) Add(*feed.Feed)   {}
+func (noopScheduler) Remove(uuid.UUID) {}
+
+type Option func(*API)
+
+func WithScheduler(sch Scheduler) Option {
+	return func(a *API) {
+		a.sch = sch
+	}
+}
+
+// WithAPIKeys requires every request to be authenticated by an API key,
+// which decides the user a request is made by and what it may do. The
+// given admin key is always accepted with admin scope for the default user
+// so that the first keys can be created. It is not accepted when empty.
+func WithAPIKeys(adminKey string) Option {
+	return func(a *API) {
+		a.auth = true
+		a.adminKey = adminKey
+	}
+}
+
+// WithWebSub serves callbacks from WebSub hubs at /websub/{uuid}. Hubs
+// cannot authenticate so callbacks are not checked for API keys, the
+// given handler is expected to verify them instead.
+func WithWebSub(h http.Handler) Option {
+	return func(a *API) {
+		a.websub = h
+	}
+}
+
+// WithAllowedOrigins lets pages on the given origins, such as
+// https://app.example.com, connect websockets. Browsers let pages on any
+// site connect websockets, so by default only pages served from the same
+// host as the API may connect.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(a *API) {
+		for _, o := range origins {
+			a.origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+		}
+	}
 }
 
 const OffsetTimeFormat = "2006-01-02T15:04:05"
@@ -27,28 +111,185 @@ func timeOffsetFromRequest(r *http.Request) time.Time {
 	return t
 }
 
-func NewAPI(s storage.Storage) http.Handler {
+// filterFromRequest builds a storage filter from the unread, starred,
+// category and author query parameters.
+func filterFromRequest(r *http.Request) storage.Filter {
+	unread, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+	starred, _ := strconv.ParseBool(r.URL.Query().Get("starred"))
+
+	return storage.Filter{
+		Unread:   unread,
+		Starred:  starred,
+		Category: strings.TrimSpace(r.URL.Query().Get("category")),
+		Author:   strings.TrimSpace(r.URL.Query().Get("author")),
+	}
+}
+
+func NewAPI(s storage.Storage, options ...Option) http.Handler {
 	r := chi.NewRouter()
 	a := &API{
-		s: s,
+		s:          s,
+		sch:        noopScheduler{},
+		events:     broker.New(recentEvents),
+		discoverer: discovery.NewDiscoverer(),
+		origins:    map[string]bool{},
 	}
 
-	r.Use(chiMiddleware.SetHeader("Content-Type", "application/json"))
-	r.Get("/feeds", a.Feeds)
-	r.Get("/latest", a.Latest)
+	for _, opt := range options {
+		opt(a)
+	}
+
+	s.OnStore(a.events.Publish)
+
+	if a.websub != nil {
+		r.Handle("/websub/{uuid}", a.websub)
+	}
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.UUID)
+		if a.auth {
+			r.Use(middleware.APIKey(a.apiKey))
+		}
+		r.Use(middleware.User(storage.DefaultUser, a.knownUser))
+		r.Use(chiMiddleware.SetHeader("Content-Type", "application/json"))
+
+		read := a.scope(storage.ScopeRead)
+		write := a.scope(storage.ScopeWrite)
+		admin := a.scope(storage.ScopeAdmin)
+
+		r.With(admin).Post("/users", a.AddUser)
+		r.With(admin).Get("/keys", a.APIKeys)
+		r.With(admin).Post("/keys", a.AddAPIKey)
+		r.With(read).Get("/feeds", a.Feeds)
+		r.With(write).Post("/feeds", a.AddFeed)
+		timeline(r.With(read), "/latest", a.Latest)
+		timeline(r.With(read), "/podcasts", a.Podcasts)
+		r.With(read).Get("/search", a.Search)
+		r.With(write).Post("/read", a.MarkReadBefore)
+		r.With(read).Get("/opml", a.ExportOPML)
+		r.With(write).Post("/opml", a.ImportOPML)
+		r.With(read).Get("/folders", a.Folders)
+		r.With(write).Post("/folders", a.AddFolder)
+		r.With(read).Get("/webhooks", a.Webhooks)
+		r.With(write).Post("/webhooks", a.AddWebhook)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.UUID)
+
+			r.With(admin).Delete("/keys/{uuid}", a.DeleteAPIKey)
+			r.With(write).Patch("/feeds/{uuid}", a.UpdateFeed)
+			r.With(write).Delete("/feeds/{uuid}", a.DeleteFeed)
+			r.With(write).Post("/feeds/{uuid}/read", a.MarkFeedRead)
+			r.With(write).Put("/feeds/{uuid}/folder", a.SetFolder)
+			r.With(write).Delete("/feeds/{uuid}/folder", a.SetFolder)
+			r.With(write).Delete("/folders/{uuid}", a.DeleteFolder)
+			timeline(r.With(read), "/folders/{uuid}/latest", a.LatestFromFolder)
+			r.With(write).Delete("/webhooks/{uuid}", a.DeleteWebhook)
+			r.With(read).Get("/webhooks/{uuid}/deliveries", a.WebhookDeliveries)
+			timeline(r.With(read), "/latest/{uuid}", a.LatestFromFeed)
+			r.With(read).Get("/article/{uuid}", a.Article)
+			r.With(write).Put("/article/{uuid}/read", a.MarkRead(true))
+			r.With(write).Delete("/article/{uuid}/read", a.MarkRead(false))
+			r.With(write).Put("/article/{uuid}/star", a.Star(true))
+			r.With(write).Delete("/article/{uuid}/star", a.Star(false))
+			r.With(write).Put("/article/{uuid}/position", a.SetPosition)
+		})
+	})
+
+	// Browsers can't set headers on EventSource and WebSocket requests so
+	// streams also accept the API key as a query parameter
+	r.Group(func(r chi.Router) {
+		if a.auth {
+			r.Use(middleware.StreamAPIKey(a.apiKey))
+		}
+		r.Use(middleware.User(storage.DefaultUser, a.knownUser))
+
+		read := a.scope(storage.ScopeRead)
 
-		r.Get("/latest/{uuid}", a.LatestFromFeed)
-		r.Get("/article/{uuid}", a.Article)
+		r.With(read).Get("/stream", a.Stream)
+		r.With(read).Get("/ws", a.WebSocket)
 	})
 
 	return r
 }
 
+// timeline routes a timeline, which can also be requested as a feed by
+// adding a suffix such as .rss to its path
+func timeline(r chi.Router, pattern string, h http.HandlerFunc) {
+	r.Get(pattern, h)
+	r.Get(pattern+".{"+formatParam+"}", h)
+}
+
+// scope returns middleware which requires the given scope when requests
+// are authenticated by API keys. Without API keys every request is allowed.
+func (a *API) scope(scope storage.Scope) func(http.Handler) http.Handler {
+	if !a.auth {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return middleware.RequireScope(scope)
+}
+
+// apiKey returns the stored API key for a key given in a request
+func (a *API) apiKey(key string) (*storage.APIKey, error) {
+	if a.adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.adminKey)) == 1 {
+		return &storage.APIKey{
+			Name:   "admin",
+			User:   storage.DefaultUser,
+			Scopes: []storage.Scope{storage.ScopeAdmin},
+		}, nil
+	}
+
+	return a.s.APIKey(storage.HashAPIKey(key))
+}
+
+// knownUser reports whether the user with the given UUID exists
+func (a *API) knownUser(id uuid.UUID) bool {
+	if id == storage.DefaultUser {
+		return true
+	}
+
+	_, err := a.s.User(id)
+	return err == nil
+}
+
+// userRequest is the request body used when adding a user
+type userRequest struct {
+	Name string
+}
+
+func (a *API) AddUser(w http.ResponseWriter, r *http.Request) {
+	var ur userRequest
+	if err := json.NewDecoder(r.Body).Decode(&ur); err != nil || ur.Name == "" {
+		response.WithMessage(w, http.StatusBadRequest, "invalid user")
+		return
+	}
+
+	u := &storage.User{
+		UUID: uuid.New(),
+		Name: ur.Name,
+	}
+
+	if err := a.s.AddUser(u); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not store user")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(u); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
 func (a *API) Feeds(w http.ResponseWriter, r *http.Request) {
-	feeds, err := a.s.Feeds()
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	feeds, err := a.s.Subscriptions(user)
 	if err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve feeds")
 		return
@@ -59,50 +300,582 @@ func (a *API) Feeds(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// feedRequest is the request body used when adding or updating a feed.
+// Feeds can also be added by the link of a site, in which case the feeds
+// the site links to are subscribed to.
+type feedRequest struct {
+	FeedLink string
+	SiteLink string
+
+	// Whether the content of articles is fetched from their links, it is
+	// left as it is when not given
+	FullContent *bool
+}
+
+// parseFeedLink parses a feed link, which must be an absolute URL
+func parseFeedLink(link string) (*url.URL, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("feed link must be an absolute http or https URL")
+	}
+
+	return u, nil
+}
+
+// subscribe will subscribe a user to the given feed. Feeds are shared
+// between users so a feed is only stored and scheduled when it is not
+// already known, otherwise the stored feed is returned. The stored feed
+// is returned along with ErrSubscribed when the user is already
+// subscribed to it.
+func (a *API) subscribe(user uuid.UUID, f *feed.Feed) (*feed.Feed, error) {
+	// Feeds which have moved are found by their new feed link
+	existing, err := a.s.Feed(f.UUID())
+	if errors.Is(err, storage.ErrFeedNotFound) {
+		existing, err = storage.FeedWithLink(a.s, f.FeedLink.String())
+	}
+
+	switch {
+	case err == nil:
+		f = existing
+	case errors.Is(err, storage.ErrFeedNotFound):
+		if err := a.s.Store(f, nil); err != nil {
+			return nil, err
+		}
+
+		a.sch.Add(f)
+	default:
+		return nil, err
+	}
+
+	if err := a.s.Subscribe(user, f.UUID()); err != nil {
+		if errors.Is(err, storage.ErrSubscribed) {
+			return f, err
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// unsubscribe will unsubscribe a user from the given feed. Once no
+// users are subscribed to a feed it is no longer read and is deleted.
+func (a *API) unsubscribe(user uuid.UUID, id uuid.UUID) error {
+	if err := a.s.Unsubscribe(user, id); err != nil {
+		return err
+	}
+
+	subscribers, err := a.s.Subscribers(id)
+	if err != nil {
+		return err
+	}
+
+	if len(subscribers) > 0 {
+		return nil
+	}
+
+	if err := a.s.DeleteFeed(id); err != nil {
+		return err
+	}
+
+	a.sch.Remove(id)
+
+	return nil
+}
+
+// subscribed reports whether a user is the only subscriber to a feed
+// as well as whether they are subscribed at all.
+func (a *API) subscribed(user uuid.UUID, id uuid.UUID) (subscribed bool, only bool, err error) {
+	subscribers, err := a.s.Subscribers(id)
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, u := range subscribers {
+		if u == user {
+			return true, len(subscribers) == 1, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+func (a *API) AddFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var fr feedRequest
+	if err := json.NewDecoder(r.Body).Decode(&fr); err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid feed link")
+		return
+	}
+
+	if fr.FeedLink == "" && fr.SiteLink != "" {
+		a.addSite(w, r, user, fr.SiteLink)
+		return
+	}
+
+	u, err := parseFeedLink(fr.FeedLink)
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid feed link")
+		return
+	}
+
+	f, err := a.subscribe(user, &feed.Feed{
+		FeedLink: u,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrSubscribed) {
+			response.WithMessage(w, http.StatusConflict, "feed already exists")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not store feed")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+// addSite subscribes a user to the feeds discovered on a site, responding
+// with the feeds which were not already subscribed to.
+func (a *API) addSite(w http.ResponseWriter, r *http.Request, user uuid.UUID, link string) {
+	u, err := parseFeedLink(link)
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid site link")
+		return
+	}
+
+	found, err := a.discoverer.Discover(r.Context(), u)
+	if err != nil {
+		if errors.Is(err, discovery.ErrNoFeeds) {
+			response.WithMessage(w, http.StatusNotFound, "no feeds found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusBadGateway, "could not discover feeds")
+		return
+	}
+
+	feeds := []*feed.Feed{}
+	for _, df := range found {
+		f, err := a.subscribe(user, &feed.Feed{
+			FeedLink: df.FeedLink,
+			Title:    df.Title,
+		})
+		if errors.Is(err, storage.ErrSubscribed) {
+			continue
+		}
+
+		if err != nil {
+			response.WithMessage(w, http.StatusInternalServerError, "could not store feed")
+			return
+		}
+
+		feeds = append(feeds, f)
+	}
+
+	if len(feeds) == 0 {
+		response.WithMessage(w, http.StatusConflict, "feed already exists")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(feeds); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) UpdateFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	var fr feedRequest
+	if err := json.NewDecoder(r.Body).Decode(&fr); err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid feed link")
+		return
+	}
+
+	// Feeds keep their link when only their settings are updated
+	var u *url.URL
+	if fr.FeedLink != "" || fr.FullContent == nil {
+		u, err = parseFeedLink(fr.FeedLink)
+		if err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "invalid feed link")
+			return
+		}
+	}
+
+	subscribed, only, err := a.subscribed(user, id)
+	if err != nil || !subscribed {
+		response.WithMessage(w, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	existing, err := a.s.Feed(id)
+	if err != nil {
+		response.WithMessage(w, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	// Keep what we already know about the feed but reset the modified
+	// time so the feed is read from its new link, or with its new
+	// settings, straight away. Updating an inactive feed makes it active
+	// again.
+	updated := *existing
+	updated.ModifiedAt = time.Time{}
+	updated.Inactive = false
+	if u != nil && u.String() != existing.FeedLink.String() {
+		updated.FeedLink = u
+		updated.ID = uuid.Nil
+	}
+
+	if fr.FullContent != nil {
+		updated.FullContent = *fr.FullContent
+	}
+	f := &updated
+
+	if f.UUID() == id && !existing.Inactive && f.FullContent == existing.FullContent {
+		if err := json.NewEncoder(w).Encode(existing); err != nil {
+			response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+		}
+		return
+	}
+
+	// A feed which is only read by this user is moved so that its articles
+	// are kept. A feed shared with other users is left as it is and the
+	// user is moved over to a feed for the new link instead.
+	_, err = a.s.Feed(f.UUID())
+	if f.UUID() == id || (only && errors.Is(err, storage.ErrFeedNotFound)) {
+		err = a.s.UpdateFeed(id, f)
+		if err == nil {
+			a.sch.Remove(id)
+			a.sch.Add(f)
+		}
+	} else {
+		f, err = a.subscribe(user, f)
+		if err == nil {
+			err = a.unsubscribe(user, id)
+		}
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrFeedNotFound):
+			response.WithMessage(w, http.StatusNotFound, "feed not found")
+		case errors.Is(err, storage.ErrFeedExists), errors.Is(err, storage.ErrSubscribed):
+			response.WithMessage(w, http.StatusConflict, "feed already exists")
+		default:
+			response.WithMessage(w, http.StatusInternalServerError, "could not update feed")
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	if err := a.unsubscribe(user, id); err != nil {
+		if errors.Is(err, storage.ErrFeedNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "feed not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not delete feed")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (a *API) Latest(w http.ResponseWriter, r *http.Request) {
-	articles, err := a.s.Latest(timeOffsetFromRequest(r))
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	format, err := feedFormat(r)
+	if err != nil {
+		response.WithMessage(w, http.StatusNotFound, "unknown feed format")
+		return
+	}
+
+	articles, err := a.s.Latest(user, timeOffsetFromRequest(r), filterFromRequest(r))
 	if err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve latest articles from feed")
 		return
 	}
 
+	if format != "" {
+		writeTimeline(w, r, format, &syndication.Timeline{
+			Title:    "Latest articles",
+			Articles: articles,
+		})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(articles); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+// maxSearchResults is the default and maximum number of search results
+const maxSearchResults = 100
+
+func (a *API) Search(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	q, err := search.ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid search query")
+		return
+	}
+
+	// Results can be restricted to one or more feeds
+	for _, f := range r.URL.Query()["feed"] {
+		u, err := uuid.Parse(f)
+		if err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "invalid feed UUID")
+			return
+		}
+
+		q.Feeds = append(q.Feeds, u)
+	}
+
+	q.Limit = maxSearchResults
+	if l, err := strconv.ParseUint(r.URL.Query().Get("limit"), 10, 64); err == nil && l > 0 && l < maxSearchResults {
+		q.Limit = uint(l)
+	}
+
+	articles, err := a.s.Search(user, q)
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not search articles")
+		return
+	}
+
 	if err := json.NewEncoder(w).Encode(articles); err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
 	}
 }
 
 func (a *API) LatestFromFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
 	u, err := middleware.UUIDFromContext(r.Context())
 	if err != nil {
 		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
 		return
 	}
 
-	articles, err := a.s.LatestFromFeed(u, timeOffsetFromRequest(r))
+	format, err := feedFormat(r)
+	if err != nil {
+		response.WithMessage(w, http.StatusNotFound, "unknown feed format")
+		return
+	}
+
+	articles, err := a.s.LatestFromFeed(user, u, timeOffsetFromRequest(r), filterFromRequest(r))
 	if err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve latest articles from feed")
 		return
 	}
 
+	if format != "" {
+		f, err := a.s.Feed(u)
+		if err != nil {
+			response.WithMessage(w, http.StatusInternalServerError, "could not retrieve feed")
+			return
+		}
+
+		title := f.Title
+		if title == "" {
+			title = f.FeedLink.String()
+		}
+
+		writeTimeline(w, r, format, &syndication.Timeline{
+			Title:    title,
+			Link:     f.Link,
+			Articles: articles,
+		})
+		return
+	}
+
 	if err := json.NewEncoder(w).Encode(articles); err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
 	}
 }
 
 func (a *API) Article(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
 	u, err := middleware.UUIDFromContext(r.Context())
 	if err != nil {
 		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
 		return
 	}
 
-	article, err := a.s.Article(u)
+	article, err := a.s.Article(user, u)
 	if err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve article")
 		return
 	}
 
+	// Articles are sanitised unless asked for as they were published
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		article = article.Raw()
+	}
+
 	if err := json.NewEncoder(w).Encode(article); err != nil {
 		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
 	}
-}
\ No newline at end of file
+}
+
+// MarkRead returns a handler which marks an article as read or unread
+func (a *API) MarkRead(read bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := middleware.UserFromContext(r.Context())
+		if err != nil {
+			response.WithMessage(w, http.StatusUnauthorized, "user not found")
+			return
+		}
+
+		u, err := middleware.UUIDFromContext(r.Context())
+		if err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+			return
+		}
+
+		if err := a.s.MarkRead(user, u, read); err != nil {
+			if errors.Is(err, storage.ErrArticleNotFound) {
+				response.WithMessage(w, http.StatusNotFound, "article not found")
+				return
+			}
+
+			response.WithMessage(w, http.StatusInternalServerError, "could not update article")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Star returns a handler which stars or unstars an article
+func (a *API) Star(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := middleware.UserFromContext(r.Context())
+		if err != nil {
+			response.WithMessage(w, http.StatusUnauthorized, "user not found")
+			return
+		}
+
+		u, err := middleware.UUIDFromContext(r.Context())
+		if err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+			return
+		}
+
+		if err := a.s.Star(user, u, starred); err != nil {
+			if errors.Is(err, storage.ErrArticleNotFound) {
+				response.WithMessage(w, http.StatusNotFound, "article not found")
+				return
+			}
+
+			response.WithMessage(w, http.StatusInternalServerError, "could not update article")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *API) MarkFeedRead(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	u, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	if err := a.s.MarkFeedRead(user, u); err != nil {
+		if errors.Is(err, storage.ErrFeedNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "feed not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not update feed")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) MarkReadBefore(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	before, err := time.Parse(OffsetTimeFormat, r.URL.Query().Get("before"))
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid before time")
+		return
+	}
+
+	if err := a.s.MarkReadBefore(user, before); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not update articles")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
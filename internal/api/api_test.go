@@ -2,12 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/google/uuid"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reader/internal/feed"
+	"reader/internal/middleware"
 	"reader/internal/storage"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,6 +36,12 @@ func timeFromString(t *testing.T, s string) time.Time {
 }
 
 func newTestAPI(t *testing.T, latest uint) http.Handler {
+	return NewAPI(newTestStorage(t, latest))
+}
+
+// newTestStorage returns storage holding two mock feeds which the
+// default user is subscribed to.
+func newTestStorage(t *testing.T, latest uint) storage.Storage {
 	s := storage.NewInMemoryStorage(latest)
 
 	err := s.Store(&feed.Feed{
@@ -96,7 +106,13 @@ func newTestAPI(t *testing.T, latest uint) http.Handler {
 		t.Errorf("error occurred creating mock storage: %v", err)
 	}
 
-	return NewAPI(s)
+	for _, host := range []string{"https://mock.local", "https://mock2.local"} {
+		if err := s.Subscribe(storage.DefaultUser, feed.UUIDFromString(host)); err != nil {
+			t.Errorf("error occurred creating mock storage: %v", err)
+		}
+	}
+
+	return s
 }
 
 func TestAPI_Endpoints(t *testing.T) {
@@ -304,6 +320,64 @@ func TestAPI_Endpoints(t *testing.T) {
 				Image:       nil,
 			},
 		},
+		{
+			"searching articles",
+			&http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path:     "/search",
+					RawQuery: "q=" + url.QueryEscape(`"second article" feed`),
+				},
+			},
+			4,
+			http.StatusOK,
+			[]*feed.Article{
+				{
+					GUID:        "",
+					Link:        "https://mock2.local/article/2",
+					Published:   timeFromString(t, "2020-01-01T01:01:02"),
+					Title:       "Article 2",
+					Description: "This is the second article in second feed",
+					Image:       nil,
+				},
+			},
+		},
+		{
+			"searching articles within feed",
+			&http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path:     "/search",
+					RawQuery: "q=firs*&feed=" + feed.UUIDFromString("https://mock.local").String(),
+				},
+			},
+			4,
+			http.StatusOK,
+			[]*feed.Article{
+				{
+					GUID:        "",
+					Link:        "https://mock.local/article/1",
+					Published:   timeFromString(t, "2010-01-01T01:01:01"),
+					Title:       "Article 1",
+					Description: "This is the first article",
+					Image:       nil,
+				},
+			},
+		},
+		{
+			"searching without query",
+			&http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path: "/search",
+				},
+			},
+			4,
+			http.StatusBadRequest,
+			map[string]string{
+				"Message": "invalid search query",
+			},
+		},
 		{
 			"getting non-existant article",
 			&http.Request{
@@ -364,3 +438,822 @@ func TestAPI_Endpoints(t *testing.T) {
 		})
 	}
 }
+
+type recordingScheduler struct {
+	added   []uuid.UUID
+	removed []uuid.UUID
+}
+
+func (s *recordingScheduler) Add(f *feed.Feed) {
+	s.added = append(s.added, f.UUID())
+}
+
+func (s *recordingScheduler) Remove(id uuid.UUID) {
+	s.removed = append(s.removed, id)
+}
+
+func TestAPI_FeedManagement(t *testing.T) {
+	mock := feed.UUIDFromString("https://mock.local")
+	added := feed.UUIDFromString("https://added.local/rss")
+	other := uuid.MustParse("6f0c4d3e-2b1a-4c5d-8e9f-0a1b2c3d4e5f")
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		user        uuid.UUID
+		shared      bool
+		code        int
+		wantAdded   []uuid.UUID
+		wantRemoved []uuid.UUID
+		wantFeeds   int
+	}{
+		{
+			"adding feed",
+			"POST",
+			"/feeds",
+			`{"FeedLink": "https://added.local/rss"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusCreated,
+			[]uuid.UUID{added},
+			nil,
+			3,
+		},
+		{
+			"adding existing feed",
+			"POST",
+			"/feeds",
+			`{"FeedLink": "https://mock.local"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusConflict,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"adding invalid feed link",
+			"POST",
+			"/feeds",
+			`{"FeedLink": "mock.local"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusBadRequest,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"updating feed link",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{"FeedLink": "https://added.local/rss"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusOK,
+			[]uuid.UUID{added},
+			[]uuid.UUID{mock},
+			2,
+		},
+		{
+			"updating feed to existing feed link",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{"FeedLink": "https://mock2.local"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusConflict,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"updating full content",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{"FullContent": true}`,
+			storage.DefaultUser,
+			false,
+			http.StatusOK,
+			[]uuid.UUID{mock},
+			[]uuid.UUID{mock},
+			2,
+		},
+		{
+			"updating feed without changes",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{"FullContent": false}`,
+			storage.DefaultUser,
+			false,
+			http.StatusOK,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"updating feed without a feed link",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{}`,
+			storage.DefaultUser,
+			false,
+			http.StatusBadRequest,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"updating non-existent feed",
+			"PATCH",
+			"/feeds/" + added.String(),
+			`{"FeedLink": "https://mock3.local"}`,
+			storage.DefaultUser,
+			false,
+			http.StatusNotFound,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"deleting feed",
+			"DELETE",
+			"/feeds/" + mock.String(),
+			"",
+			storage.DefaultUser,
+			false,
+			http.StatusNoContent,
+			nil,
+			[]uuid.UUID{mock},
+			1,
+		},
+		{
+			"deleting non-existent feed",
+			"DELETE",
+			"/feeds/" + added.String(),
+			"",
+			storage.DefaultUser,
+			false,
+			http.StatusNotFound,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"deleting shared feed",
+			"DELETE",
+			"/feeds/" + mock.String(),
+			"",
+			storage.DefaultUser,
+			true,
+			http.StatusNoContent,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"updating shared feed link",
+			"PATCH",
+			"/feeds/" + mock.String(),
+			`{"FeedLink": "https://added.local/rss"}`,
+			storage.DefaultUser,
+			true,
+			http.StatusOK,
+			[]uuid.UUID{added},
+			nil,
+			3,
+		},
+		{
+			"adding feed read by another user",
+			"POST",
+			"/feeds",
+			`{"FeedLink": "https://mock2.local"}`,
+			other,
+			true,
+			http.StatusCreated,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"deleting feed not subscribed to",
+			"DELETE",
+			"/feeds/" + feed.UUIDFromString("https://mock2.local").String(),
+			"",
+			other,
+			true,
+			http.StatusNotFound,
+			nil,
+			nil,
+			2,
+		},
+		{
+			"adding feed as unknown user",
+			"POST",
+			"/feeds",
+			`{"FeedLink": "https://added.local/rss"}`,
+			uuid.New(),
+			false,
+			http.StatusUnauthorized,
+			nil,
+			nil,
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewInMemoryStorage(10)
+			for _, host := range []string{"mock.local", "mock2.local"} {
+				err := s.Store(&feed.Feed{
+					FeedLink: &url.URL{
+						Scheme: "https",
+						Host:   host,
+					},
+				}, nil)
+				if err != nil {
+					t.Fatalf("error occurred creating mock storage: %v", err)
+				}
+
+				if err := s.Subscribe(storage.DefaultUser, feed.UUIDFromString("https://"+host)); err != nil {
+					t.Fatalf("error occurred creating mock storage: %v", err)
+				}
+			}
+
+			if err := s.AddUser(&storage.User{UUID: other, Name: "other"}); err != nil {
+				t.Fatalf("error occurred creating mock storage: %v", err)
+			}
+
+			if tt.shared {
+				if err := s.Subscribe(other, mock); err != nil {
+					t.Fatalf("error occurred creating mock storage: %v", err)
+				}
+			}
+
+			sch := &recordingScheduler{}
+			h := NewAPI(s, WithScheduler(sch), WithAPIKeys("admin-secret"))
+
+			// Only admins can make requests as other users
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(middleware.APIKeyHeader, "admin-secret")
+			if tt.user != storage.DefaultUser {
+				req.Header.Set(middleware.UserHeader, tt.user.String())
+			}
+
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			if resp.Code != tt.code {
+				t.Errorf("StatusCode want %v got %v", tt.code, resp.Code)
+			}
+
+			if !reflect.DeepEqual(sch.added, tt.wantAdded) {
+				t.Errorf("Scheduler added want %v got %v", tt.wantAdded, sch.added)
+			}
+
+			if !reflect.DeepEqual(sch.removed, tt.wantRemoved) {
+				t.Errorf("Scheduler removed want %v got %v", tt.wantRemoved, sch.removed)
+			}
+
+			feeds, err := s.Feeds()
+			if err != nil {
+				t.Fatalf("error retrieving feeds: %v", err)
+			}
+
+			if len(feeds) != tt.wantFeeds {
+				t.Errorf("feed count want %v got %v", tt.wantFeeds, len(feeds))
+			}
+		})
+	}
+}
+
+func TestAPI_MovedFeed(t *testing.T) {
+	mock := feed.UUIDFromString("https://mock.local")
+
+	s := storage.NewInMemoryStorage(10)
+	f := &feed.Feed{
+		FeedLink: &url.URL{Scheme: "https", Host: "moved.local"},
+		ID:       mock,
+		Inactive: true,
+	}
+
+	if err := s.Store(f, nil); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, mock); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	sch := &recordingScheduler{}
+	h := NewAPI(s, WithScheduler(sch))
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		return resp
+	}
+
+	// A moved feed is found by its new feed link
+	if resp := serve("POST", "/feeds", `{"FeedLink": "https://moved.local"}`); resp.Code != http.StatusConflict {
+		t.Errorf("adding moved feed StatusCode want %v got %v", http.StatusConflict, resp.Code)
+	}
+
+	// Updating an inactive feed with its own feed link reads it again
+	resp := serve("PATCH", "/feeds/"+mock.String(), `{"FeedLink": "https://moved.local"}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("updating inactive feed StatusCode want %v got %v", http.StatusOK, resp.Code)
+	}
+
+	var got struct {
+		UUID     uuid.UUID
+		FeedLink string
+		Inactive bool
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if got.UUID != mock || got.FeedLink != "https://moved.local" || got.Inactive {
+		t.Errorf("updated feed got = %+v", got)
+	}
+
+	if !reflect.DeepEqual(sch.added, []uuid.UUID{mock}) {
+		t.Errorf("Scheduler added want %v got %v", []uuid.UUID{mock}, sch.added)
+	}
+
+	stored, err := s.Feed(mock)
+	if err != nil || stored.Inactive {
+		t.Errorf("stored feed is still inactive: %v", err)
+	}
+}
+
+func TestAPI_FullContent(t *testing.T) {
+	mock := feed.UUIDFromString("https://mock.local")
+
+	s := storage.NewInMemoryStorage(10)
+	if err := s.Store(&feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock.local"}}, nil); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, mock); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	h := NewAPI(s)
+
+	for _, fullContent := range []bool{true, false} {
+		body := `{"FeedLink": "https://mock.local", "FullContent": ` + strconv.FormatBool(fullContent) + `}`
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("PATCH", "/feeds/"+mock.String(), strings.NewReader(body)))
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+		}
+
+		var got struct {
+			UUID        uuid.UUID
+			FullContent bool
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("could not decode response body: %v", err)
+		}
+
+		if got.UUID != mock || got.FullContent != fullContent {
+			t.Errorf("updated feed got = %+v, want FullContent %v", got, fullContent)
+		}
+
+		stored, err := s.Feed(mock)
+		if err != nil || stored.FullContent != fullContent {
+			t.Errorf("stored feed FullContent got = %v, want %v", stored, fullContent)
+		}
+	}
+}
+
+// articleLinks decodes a list of articles from a response body and
+// returns their links.
+func articleLinks(t *testing.T, resp *httptest.ResponseRecorder) []string {
+	var articles []struct {
+		Link string
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&articles); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	links := []string{}
+	for _, a := range articles {
+		links = append(links, a.Link)
+	}
+
+	return links
+}
+
+func TestAPI_ArticleState(t *testing.T) {
+	h := newTestAPI(t, 10)
+	article := feed.UUIDFromString("https://mock2.local/article/2").String()
+	mock := feed.UUIDFromString("https://mock.local").String()
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		code   int
+		links  []string
+	}{
+		{
+			"marking article read",
+			"PUT", "/article/" + article + "/read",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"marking non-existent article read",
+			"PUT", "/article/" + feed.UUIDFromString("oops").String() + "/read",
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"getting unread",
+			"GET", "/latest?unread=true",
+			http.StatusOK,
+			[]string{"https://mock.local/article/2", "https://mock2.local/article/1", "https://mock.local/article/1"},
+		},
+		{
+			"starring article",
+			"PUT", "/article/" + article + "/star",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"getting starred",
+			"GET", "/latest?starred=true",
+			http.StatusOK,
+			[]string{"https://mock2.local/article/2"},
+		},
+		{
+			"marking article unread",
+			"DELETE", "/article/" + article + "/read",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"marking feed read",
+			"POST", "/feeds/" + mock + "/read",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"getting unread after marking feed read",
+			"GET", "/latest?unread=true",
+			http.StatusOK,
+			[]string{"https://mock2.local/article/2", "https://mock2.local/article/1"},
+		},
+		{
+			"marking read before time",
+			"POST", "/read?before=2015-01-01T00:00:00",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"marking read without time",
+			"POST", "/read",
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"getting unread from feed",
+			"GET", "/latest/" + feed.UUIDFromString("https://mock2.local").String() + "?unread=true",
+			http.StatusOK,
+			[]string{"https://mock2.local/article/2"},
+		},
+	}
+	for _, st := range steps {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(st.method, st.path, nil))
+
+		if resp.Code != st.code {
+			t.Errorf("%s: StatusCode want %v got %v", st.name, st.code, resp.Code)
+			continue
+		}
+
+		if st.links == nil {
+			continue
+		}
+
+		if got := articleLinks(t, resp); !reflect.DeepEqual(got, st.links) {
+			t.Errorf("%s: articles want %v got %v", st.name, st.links, got)
+		}
+	}
+}
+
+func TestAPI_LatestFilters(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock.local"}}
+
+	err := s.Store(f, []*feed.Article{
+		{
+			Link:       "https://mock.local/article/1",
+			Published:  timeFromString(t, "2010-01-01T01:01:01"),
+			Authors:    []*feed.Person{{Name: "Jane Doe"}},
+			Categories: []string{"Go", "Databases"},
+		},
+		{
+			Link:       "https://mock.local/article/2",
+			Published:  timeFromString(t, "2020-01-01T01:01:01"),
+			Authors:    []*feed.Person{{Name: "John Doe"}, {Name: "Jane Doe"}},
+			Categories: []string{"Rust"},
+		},
+		{
+			Link:      "https://mock.local/article/3",
+			Published: timeFromString(t, "2015-01-01T01:01:01"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	h := NewAPI(s)
+
+	tests := []struct {
+		name  string
+		path  string
+		links []string
+	}{
+		{
+			"category",
+			"/latest?category=go",
+			[]string{"https://mock.local/article/1"},
+		},
+		{
+			"author",
+			"/latest?author=jane%20doe",
+			[]string{"https://mock.local/article/2", "https://mock.local/article/1"},
+		},
+		{
+			"category and author",
+			"/latest?category=rust&author=John+Doe",
+			[]string{"https://mock.local/article/2"},
+		},
+		{
+			"unknown category",
+			"/latest/" + f.UUID().String() + "?category=python",
+			[]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, httptest.NewRequest("GET", tt.path, nil))
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+			}
+
+			if got := articleLinks(t, resp); !reflect.DeepEqual(got, tt.links) {
+				t.Errorf("articles want %v got %v", tt.links, got)
+			}
+		})
+	}
+
+	// Articles without any authors, categories or enclosures still list them
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/latest", nil))
+
+	if !strings.Contains(resp.Body.String(), `"Authors":[],"Categories":[],"Enclosures":[]`) {
+		t.Errorf("article without details got %v", resp.Body.String())
+	}
+}
+
+func TestAPI_RawArticle(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock.local"}}
+	a := &feed.Article{
+		Link:           "https://mock.local/article/1",
+		Description:    "<p>Sanitised</p>",
+		RawDescription: "<p>Sanitised<script></script></p>",
+		Content:        "<p>Unchanged</p>",
+	}
+
+	if err := s.Store(f, []*feed.Article{a}); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	h := NewAPI(s)
+
+	tests := []struct {
+		name        string
+		query       string
+		description string
+	}{
+		{"sanitised", "", "<p>Sanitised</p>"},
+		{"raw", "?raw=true", "<p>Sanitised<script></script></p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, httptest.NewRequest("GET", "/article/"+a.UUID().String()+tt.query, nil))
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+			}
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("could not decode response body: %v", err)
+			}
+
+			if got["Description"] != tt.description || got["Content"] != "<p>Unchanged</p>" {
+				t.Errorf("article got = %v %v, want %v %v", got["Description"], got["Content"], tt.description, "<p>Unchanged</p>")
+			}
+
+			if _, ok := got["RawDescription"]; ok {
+				t.Errorf("article got RawDescription, want it hidden")
+			}
+		})
+	}
+}
+
+func TestAPI_Users(t *testing.T) {
+	h := NewAPI(newTestStorage(t, 10), WithAPIKeys("admin-secret"))
+
+	// do makes a request with the admin key, as the given user if any
+	do := func(method, path, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(middleware.APIKeyHeader, "admin-secret")
+		if user != "" {
+			req.Header.Set(middleware.UserHeader, user)
+		}
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do("POST", "/users", `{"Name": "alice"}`, "")
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("StatusCode want %v got %v", http.StatusCreated, resp.Code)
+	}
+
+	var u storage.User
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if u.Name != "alice" || u.UUID == storage.DefaultUser {
+		t.Errorf("user want name alice and a new UUID got %+v", u)
+	}
+
+	// A new user starts without any subscriptions
+	resp = do("GET", "/latest", "", u.UUID.String())
+
+	if got := articleLinks(t, resp); len(got) != 0 {
+		t.Errorf("articles want none got %v", got)
+	}
+
+	resp = do("POST", "/users", `{}`, "")
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode want %v got %v", http.StatusBadRequest, resp.Code)
+	}
+}
+
+func TestAPI_UserHeader(t *testing.T) {
+	s := newTestStorage(t, 10)
+	u := &storage.User{UUID: uuid.New(), Name: "alice"}
+	if err := s.AddUser(u); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+
+	// Without authentication every request is made by the default user,
+	// so acting as another user is rejected
+	req := httptest.NewRequest("GET", "/latest", nil)
+	req.Header.Set(middleware.UserHeader, u.UUID.String())
+
+	resp := httptest.NewRecorder()
+	NewAPI(s).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("StatusCode without authentication want %v got %v", http.StatusForbidden, resp.Code)
+	}
+
+	// Keys without admin scope can't act as another user either
+	key := &storage.APIKey{UUID: uuid.New(), Hash: storage.HashAPIKey("read-secret"), User: storage.DefaultUser, Scopes: []storage.Scope{storage.ScopeRead}}
+	if err := s.AddAPIKey(key); err != nil {
+		t.Fatalf("AddAPIKey() error = %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/latest", nil)
+	req.Header.Set(middleware.APIKeyHeader, "read-secret")
+	req.Header.Set(middleware.UserHeader, u.UUID.String())
+
+	resp = httptest.NewRecorder()
+	NewAPI(s, WithAPIKeys("admin-secret")).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("StatusCode with read key want %v got %v", http.StatusForbidden, resp.Code)
+	}
+}
+
+func TestAPI_WebSub(t *testing.T) {
+	// Callbacks reach the WebSub handler without an API key
+	websub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("hub.challenge")))
+	})
+
+	h := NewAPI(newTestStorage(t, 10), WithAPIKeys("secret"), WithWebSub(websub))
+
+	id := feed.UUIDFromString("https://mock.local").String()
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/websub/"+id+"?hub.challenge=challenge", nil))
+
+	if resp.Code != http.StatusOK || resp.Body.String() != "challenge" {
+		t.Errorf("callback got %v %q, want %v %q", resp.Code, resp.Body.String(), http.StatusOK, "challenge")
+	}
+
+	// Every other request still needs one
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/latest", nil))
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("StatusCode want %v got %v", http.StatusUnauthorized, resp.Code)
+	}
+}
+
+func TestAPI_AddSite(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" title="Site" href="/feed.xml"></head></html>`))
+		case "/feed.xml":
+			w.Write([]byte(`<rss version="2.0"><channel><title>Site</title></channel></rss>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`<html><head><title>No feeds</title></head></html>`))
+	}))
+	defer empty.Close()
+
+	h := newTestAPI(t, 10)
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/feeds", strings.NewReader(`{"SiteLink": "`+site.URL+`"}`)))
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("StatusCode want %v got %v", http.StatusCreated, resp.Code)
+	}
+
+	var feeds []struct {
+		FeedLink string
+		Title    string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&feeds); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if len(feeds) != 1 || feeds[0].FeedLink != site.URL+"/feed.xml" || feeds[0].Title != "Site" {
+		t.Errorf("feeds want %v got %+v", site.URL+"/feed.xml", feeds)
+	}
+
+	steps := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"adding site again", `{"SiteLink": "` + site.URL + `"}`, http.StatusConflict},
+		{"adding site without feeds", `{"SiteLink": "` + empty.URL + `"}`, http.StatusNotFound},
+		{"adding missing page", `{"SiteLink": "` + site.URL + `/missing"}`, http.StatusBadGateway},
+		{"adding invalid site link", `{"SiteLink": "/relative"}`, http.StatusBadRequest},
+	}
+	for _, st := range steps {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("POST", "/feeds", strings.NewReader(st.body)))
+
+		if resp.Code != st.code {
+			t.Errorf("%s: StatusCode want %v got %v", st.name, st.code, resp.Code)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/middleware"
+	"reader/internal/storage"
+	"time"
+)
+
+// apiKeyRequest is the request body used when adding an API key. Keys
+// belong to the user making the request unless another user is given.
+type apiKeyRequest struct {
+	Name   string
+	User   *uuid.UUID
+	Scopes []storage.Scope
+}
+
+// apiKeyResponse is an API key as it is shown by the API. The key itself
+// is only shown once, when it is created.
+type apiKeyResponse struct {
+	UUID      uuid.UUID
+	Name      string
+	User      uuid.UUID
+	Scopes    []storage.Scope
+	CreatedAt time.Time
+	Key       string `json:",omitempty"`
+}
+
+func newAPIKeyResponse(k *storage.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		UUID:      k.UUID,
+		Name:      k.Name,
+		User:      k.User,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+	}
+}
+
+// generateAPIKey returns a new random API key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (a *API) APIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.s.APIKeys()
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve API keys")
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResponse(k))
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) AddAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var kr apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&kr); err != nil || kr.Name == "" || len(kr.Scopes) == 0 {
+		response.WithMessage(w, http.StatusBadRequest, "invalid API key")
+		return
+	}
+
+	for _, s := range kr.Scopes {
+		if s != storage.ScopeRead && s != storage.ScopeWrite && s != storage.ScopeAdmin {
+			response.WithMessage(w, http.StatusBadRequest, "invalid API key scope")
+			return
+		}
+	}
+
+	if kr.User != nil {
+		user = *kr.User
+	}
+
+	if !a.knownUser(user) {
+		response.WithMessage(w, http.StatusBadRequest, "unknown user")
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate API key")
+		return
+	}
+
+	k := &storage.APIKey{
+		UUID:      uuid.New(),
+		Name:      kr.Name,
+		User:      user,
+		Scopes:    kr.Scopes,
+		Hash:      storage.HashAPIKey(key),
+		CreatedAt: time.Now(),
+	}
+
+	if err := a.s.AddAPIKey(k); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not store API key")
+		return
+	}
+
+	resp := newAPIKeyResponse(k)
+	resp.Key = key
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	if err := a.s.DeleteAPIKey(id); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "API key not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not delete API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reader/internal/feed"
+	"reader/internal/middleware"
+	"strings"
+	"testing"
+)
+
+func TestAPI_APIKeys(t *testing.T) {
+	s := newTestStorage(t, 10)
+	h := NewAPI(s, WithAPIKeys("admin-secret"))
+
+	article := "/article/" + feed.UUIDFromString("https://mock.local/article/1").String() + "/read"
+
+	// do makes a request with the given key, in the API key header unless
+	// bearer is set, and returns the response.
+	do := func(method, path, body, key string, bearer bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		switch {
+		case key == "":
+		case bearer:
+			req.Header.Set("Authorization", "Bearer "+key)
+		default:
+			req.Header.Set(middleware.APIKeyHeader, key)
+		}
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// newKey creates a key with the given scope and returns it
+	newKey := func(scope string) apiKeyResponse {
+		resp := do("POST", "/keys", `{"Name": "`+scope+`", "Scopes": ["`+scope+`"]}`, "admin-secret", false)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("creating key StatusCode want %v got %v", http.StatusCreated, resp.Code)
+		}
+
+		var k apiKeyResponse
+		if err := json.NewDecoder(resp.Body).Decode(&k); err != nil {
+			t.Fatalf("could not decode response body: %v", err)
+		}
+
+		if k.Key == "" {
+			t.Fatalf("created key was not returned")
+		}
+
+		return k
+	}
+
+	readKey := newKey("read")
+	writeKey := newKey("write")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		key    string
+		bearer bool
+		code   int
+	}{
+		{"without key", "GET", "/latest", "", "", false, http.StatusUnauthorized},
+		{"with invalid key", "GET", "/latest", "", "oops", false, http.StatusUnauthorized},
+		{"reading with read key", "GET", "/latest", "", readKey.Key, false, http.StatusOK},
+		{"reading with bearer token", "GET", "/feeds", "", readKey.Key, true, http.StatusOK},
+		{"reading with key in query", "GET", "/latest?" + middleware.APIKeyParam + "=admin-secret", "", "", false, http.StatusUnauthorized},
+		{"writing with read key", "PUT", article, "", readKey.Key, false, http.StatusForbidden},
+		{"writing with write key", "PUT", article, "", writeKey.Key, true, http.StatusNoContent},
+		{"managing keys with write key", "GET", "/keys", "", writeKey.Key, false, http.StatusForbidden},
+		{"adding user with read key", "POST", "/users", `{"Name": "bob"}`, readKey.Key, false, http.StatusForbidden},
+		{"adding key with invalid scope", "POST", "/keys", `{"Name": "oops", "Scopes": ["all"]}`, "admin-secret", false, http.StatusBadRequest},
+		{"deleting key with admin key", "DELETE", "/keys/" + readKey.UUID.String(), "", "admin-secret", false, http.StatusNoContent},
+		{"reading with deleted key", "GET", "/latest", "", readKey.Key, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp := do(tt.method, tt.path, tt.body, tt.key, tt.bearer)
+		if resp.Code != tt.code {
+			t.Errorf("%s: StatusCode want %v got %v", tt.name, tt.code, resp.Code)
+		}
+	}
+
+	// Listed keys must never include the key or its hash
+	resp := do("GET", "/keys", "", "admin-secret", false)
+	if strings.Contains(resp.Body.String(), writeKey.Key) || strings.Contains(resp.Body.String(), "Hash") {
+		t.Errorf("listed keys include secrets: %s", resp.Body.String())
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/middleware"
+	"reader/internal/storage"
+	"reader/internal/syndication"
+)
+
+type folderRequest struct {
+	Name string
+}
+
+// feedFolderRequest moves a feed into a folder
+type feedFolderRequest struct {
+	Folder uuid.UUID
+}
+
+func (a *API) Folders(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	folders, err := a.s.Folders(user)
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve folders")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(folders); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) AddFolder(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var fr folderRequest
+	if err := json.NewDecoder(r.Body).Decode(&fr); err != nil || fr.Name == "" {
+		response.WithMessage(w, http.StatusBadRequest, "invalid folder")
+		return
+	}
+
+	f := &storage.Folder{
+		UUID:  uuid.New(),
+		Name:  fr.Name,
+		Feeds: []uuid.UUID{},
+	}
+
+	if err := a.s.AddFolder(user, f); err != nil {
+		if errors.Is(err, storage.ErrFolderExists) {
+			response.WithMessage(w, http.StatusConflict, "folder already exists")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not store folder")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	if err := a.s.DeleteFolder(user, id); err != nil {
+		if errors.Is(err, storage.ErrFolderNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "folder not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not delete folder")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) LatestFromFolder(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	format, err := feedFormat(r)
+	if err != nil {
+		response.WithMessage(w, http.StatusNotFound, "unknown feed format")
+		return
+	}
+
+	folder, err := a.s.Folder(user, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrFolderNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "folder not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve folder")
+		return
+	}
+
+	articles, err := a.s.LatestFromFolder(user, folder.UUID, timeOffsetFromRequest(r), filterFromRequest(r))
+	if err != nil {
+		if errors.Is(err, storage.ErrFolderNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "folder not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve latest articles from folder")
+		return
+	}
+
+	if format != "" {
+		writeTimeline(w, r, format, &syndication.Timeline{
+			Title:    folder.Name,
+			Articles: articles,
+		})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(articles); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+// SetFolder moves a feed into the folder given in the request body, or
+// out of any folder when the request is made with DELETE.
+func (a *API) SetFolder(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	var fr feedFolderRequest
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&fr); err != nil || fr.Folder == uuid.Nil {
+			response.WithMessage(w, http.StatusBadRequest, "invalid folder")
+			return
+		}
+	}
+
+	if err := a.s.SetFolder(user, id, fr.Folder); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrFeedNotFound):
+			response.WithMessage(w, http.StatusNotFound, "feed not found")
+		case errors.Is(err, storage.ErrFolderNotFound):
+			response.WithMessage(w, http.StatusNotFound, "folder not found")
+		default:
+			response.WithMessage(w, http.StatusInternalServerError, "could not update folder")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
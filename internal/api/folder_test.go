@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reader/internal/feed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPI_Folders(t *testing.T) {
+	h := newTestAPI(t, 10)
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/folders", strings.NewReader(`{"Name": "News"}`)))
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("StatusCode want %v got %v", http.StatusCreated, resp.Code)
+	}
+
+	var folder struct {
+		UUID string
+		Name string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&folder); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	mock := feed.UUIDFromString("https://mock.local").String()
+	unknown := feed.UUIDFromString("oops").String()
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		links  []string
+	}{
+		{
+			"adding folder with existing name",
+			"POST", "/folders", `{"Name": "News"}`,
+			http.StatusConflict,
+			nil,
+		},
+		{
+			"adding folder without name",
+			"POST", "/folders", `{}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"getting empty folder",
+			"GET", "/folders/" + folder.UUID + "/latest", "",
+			http.StatusOK,
+			[]string{},
+		},
+		{
+			"moving feed into folder",
+			"PUT", "/feeds/" + mock + "/folder", `{"Folder": "` + folder.UUID + `"}`,
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"moving feed into unknown folder",
+			"PUT", "/feeds/" + mock + "/folder", `{"Folder": "` + unknown + `"}`,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"moving unknown feed into folder",
+			"PUT", "/feeds/" + unknown + "/folder", `{"Folder": "` + folder.UUID + `"}`,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"getting folder",
+			"GET", "/folders/" + folder.UUID + "/latest", "",
+			http.StatusOK,
+			[]string{"https://mock.local/article/2", "https://mock.local/article/1"},
+		},
+		{
+			"getting folder with offset",
+			"GET", "/folders/" + folder.UUID + "/latest?offset=2015-01-01T00:00:00", "",
+			http.StatusOK,
+			[]string{"https://mock.local/article/1"},
+		},
+		{
+			"getting unknown folder",
+			"GET", "/folders/" + unknown + "/latest", "",
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"moving feed out of folder",
+			"DELETE", "/feeds/" + mock + "/folder", "",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"getting folder after moving feed out",
+			"GET", "/folders/" + folder.UUID + "/latest", "",
+			http.StatusOK,
+			[]string{},
+		},
+		{
+			"deleting folder",
+			"DELETE", "/folders/" + folder.UUID, "",
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"deleting deleted folder",
+			"DELETE", "/folders/" + folder.UUID, "",
+			http.StatusNotFound,
+			nil,
+		},
+	}
+	for _, st := range steps {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(st.method, st.path, strings.NewReader(st.body)))
+
+		if resp.Code != st.code {
+			t.Errorf("%s: StatusCode want %v got %v", st.name, st.code, resp.Code)
+			continue
+		}
+
+		if st.links == nil {
+			continue
+		}
+
+		if got := articleLinks(t, resp); !reflect.DeepEqual(got, st.links) {
+			t.Errorf("%s: articles want %v got %v", st.name, st.links, got)
+		}
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/folders", nil))
+
+	if resp.Code != http.StatusOK || strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Errorf("folders want [] got %v %v", resp.Code, resp.Body.String())
+	}
+}
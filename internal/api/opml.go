@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/feed"
+	"reader/internal/middleware"
+	"reader/internal/opml"
+	"reader/internal/storage"
+)
+
+// maxOPMLSize is the largest OPML document which can be imported
+const maxOPMLSize = 10 << 20
+
+// importResponse reports the outcome of an OPML import
+type importResponse struct {
+	// Feeds which were subscribed to
+	Added []*feed.Feed
+
+	// Number of feeds which were already subscribed to
+	Existing int
+
+	// Feed links which could not be subscribed to
+	Invalid []string
+}
+
+func (a *API) ImportOPML(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	o, err := opml.Parse(http.MaxBytesReader(w, r.Body, maxOPMLSize))
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid OPML document")
+		return
+	}
+
+	resp := importResponse{
+		Added:   []*feed.Feed{},
+		Invalid: []string{},
+	}
+
+	for _, e := range o.Entries() {
+		u, err := parseFeedLink(e.FeedLink)
+		if err != nil {
+			resp.Invalid = append(resp.Invalid, e.FeedLink)
+			continue
+		}
+
+		f := &feed.Feed{
+			FeedLink: u,
+			Title:    e.Title,
+			Link:     e.SiteLink,
+		}
+
+		// Feeds which have moved are stored under the UUID of their old
+		// feed link, so the folder is set on the feed which was found
+		added, err := a.subscribe(user, f)
+		switch {
+		case err == nil:
+			resp.Added = append(resp.Added, added)
+		case errors.Is(err, storage.ErrSubscribed):
+			resp.Existing++
+		default:
+			response.WithMessage(w, http.StatusInternalServerError, "could not store feed")
+			return
+		}
+
+		if e.Folder() == "" {
+			continue
+		}
+
+		folder, err := storage.FolderNamed(a.s, user, e.Folder())
+		if err == nil {
+			err = a.s.SetFolder(user, added.UUID(), folder.UUID)
+		}
+		if err != nil {
+			response.WithMessage(w, http.StatusInternalServerError, "could not store folder")
+			return
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) ExportOPML(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	feeds, err := a.s.Subscriptions(user)
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve feeds")
+		return
+	}
+
+	folders, err := a.s.Folders(user)
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve folders")
+		return
+	}
+
+	// Feeds in a folder are only listed within their folder
+	inFolder := make(map[uuid.UUID][]*feed.Feed, len(folders))
+	unfiled := []*feed.Feed{}
+	for _, f := range feeds {
+		folder, err := folderOf(folders, f.UUID())
+		if err != nil {
+			unfiled = append(unfiled, f)
+			continue
+		}
+
+		inFolder[folder.UUID] = append(inFolder[folder.UUID], f)
+	}
+
+	o := opml.New("Subscriptions", unfiled)
+	for _, folder := range folders {
+		o.AddFolder(folder.Name, inFolder[folder.UUID])
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+
+	if err := o.Write(w); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+// folderOf returns the folder a feed is in
+func folderOf(folders []*storage.Folder, id uuid.UUID) (*storage.Folder, error) {
+	for _, folder := range folders {
+		for _, fid := range folder.Feeds {
+			if fid == id {
+				return folder, nil
+			}
+		}
+	}
+
+	return nil, storage.ErrFolderNotFound
+}
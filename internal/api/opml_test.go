@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/opml"
+	"reader/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestAPI_OPML(t *testing.T) {
+	sch := &recordingScheduler{}
+	h := NewAPI(newTestStorage(t, 10), WithScheduler(sch))
+
+	doc := `<opml version="2.0"><body>
+  <outline text="Existing" xmlUrl="https://mock.local"/>
+  <outline text="Folder">
+    <outline text="Added" xmlUrl="https://added.local/rss" htmlUrl="https://added.local"/>
+    <outline text="Invalid" xmlUrl="added.local"/>
+  </outline>
+</body></opml>`
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/opml", strings.NewReader(doc)))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+	}
+
+	var imported struct {
+		Added []struct {
+			FeedLink string
+			Title    string
+		}
+		Existing int
+		Invalid  []string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&imported); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if len(imported.Added) != 1 || imported.Added[0].FeedLink != "https://added.local/rss" || imported.Added[0].Title != "Added" {
+		t.Errorf("Added want https://added.local/rss got %+v", imported.Added)
+	}
+
+	if imported.Existing != 1 {
+		t.Errorf("Existing want %v got %v", 1, imported.Existing)
+	}
+
+	if len(imported.Invalid) != 1 || imported.Invalid[0] != "added.local" {
+		t.Errorf("Invalid want [added.local] got %v", imported.Invalid)
+	}
+
+	if len(sch.added) != 1 {
+		t.Errorf("Scheduler added want 1 feed got %v", sch.added)
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/opml", nil))
+
+	if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/x-opml") {
+		t.Errorf("Content-Type want text/x-opml got %v", ct)
+	}
+
+	o, err := opml.Parse(resp.Body)
+	if err != nil {
+		t.Fatalf("could not parse exported OPML: %v", err)
+	}
+
+	links := []string{}
+	for _, e := range o.Entries() {
+		links = append(links, e.FeedLink+" "+e.SiteLink+" "+e.Folder())
+	}
+
+	// Feeds are exported in the folders they were imported in
+	want := "https://mock.local https://mock.local ,https://mock2.local https://mock2.local ,https://added.local/rss https://added.local Folder"
+	if got := strings.Join(links, ","); got != want {
+		t.Errorf("exported feeds want %v got %v", want, got)
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/opml", strings.NewReader("not opml")))
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode want %v got %v", http.StatusBadRequest, resp.Code)
+	}
+}
+
+func TestAPI_ImportOPML_MovedFeed(t *testing.T) {
+	s := newTestStorage(t, 10)
+	h := NewAPI(s, WithScheduler(&recordingScheduler{}))
+
+	// The feed moved from old.local and is stored under its old UUID
+	id := feed.UUIDFromString("https://old.local")
+	moved := &feed.Feed{ID: id, FeedLink: &url.URL{Scheme: "https", Host: "moved.local"}}
+	if err := s.Store(moved, nil); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	doc := `<opml version="2.0"><body>
+  <outline text="Folder">
+    <outline text="Moved" xmlUrl="https://moved.local"/>
+  </outline>
+</body></opml>`
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/opml", strings.NewReader(doc)))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+	}
+
+	folders, err := s.Folders(storage.DefaultUser)
+	if err != nil {
+		t.Fatalf("Folders() error = %v", err)
+	}
+
+	if folder, err := folderOf(folders, id); err != nil || folder.Name != "Folder" {
+		t.Errorf("moved feed was not put in its folder: %v", err)
+	}
+
+	if _, err := s.Feed(feed.UUIDFromString("https://moved.local")); err == nil {
+		t.Errorf("moved feed was stored again under the UUID of its new link")
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/middleware"
+	"reader/internal/storage"
+	"reader/internal/syndication"
+)
+
+// positionRequest records how far an episode has been played
+type positionRequest struct {
+	Position *uint
+}
+
+// Podcasts returns the latest articles with audio or video enclosures,
+// such as podcast episodes
+func (a *API) Podcasts(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	format, err := feedFormat(r)
+	if err != nil {
+		response.WithMessage(w, http.StatusNotFound, "unknown feed format")
+		return
+	}
+
+	filter := filterFromRequest(r)
+	filter.Media = true
+
+	articles, err := a.s.Latest(user, timeOffsetFromRequest(r), filter)
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve latest episodes")
+		return
+	}
+
+	if format != "" {
+		writeTimeline(w, r, format, &syndication.Timeline{
+			Title:    "Podcasts",
+			Articles: articles,
+		})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(articles); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+// SetPosition records how far, in seconds, the audio or video of an
+// article has been played
+func (a *API) SetPosition(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	u, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	var pr positionRequest
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil || pr.Position == nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid position")
+		return
+	}
+
+	if err := a.s.SetPosition(user, u, *pr.Position); err != nil {
+		if errors.Is(err, storage.ErrArticleNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "article not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not update article")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPI_Podcasts(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "podcast.local"}}
+
+	err := s.Store(f, []*feed.Article{
+		{
+			Link:       "https://podcast.local/1",
+			Published:  timeFromString(t, "2010-01-01T01:01:01"),
+			Enclosures: []*feed.Enclosure{{URL: "https://podcast.local/1.mp3", Type: "audio/mpeg", Duration: 3600}},
+		},
+		{
+			Link:       "https://podcast.local/2",
+			Published:  timeFromString(t, "2020-01-01T01:01:01"),
+			Enclosures: []*feed.Enclosure{{URL: "https://podcast.local/2.mp4", Type: "Video/MP4"}},
+		},
+		{
+			Link:       "https://podcast.local/notes",
+			Published:  timeFromString(t, "2015-01-01T01:01:01"),
+			Enclosures: []*feed.Enclosure{{URL: "https://podcast.local/notes.pdf", Type: "application/pdf"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	h := NewAPI(s)
+	episode := (&feed.Article{Link: "https://podcast.local/1"}).UUID().String()
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		links  []string
+	}{
+		{
+			"getting podcasts",
+			"GET", "/podcasts", "",
+			http.StatusOK,
+			[]string{"https://podcast.local/2", "https://podcast.local/1"},
+		},
+		{
+			"setting position",
+			"PUT", "/article/" + episode + "/position", `{"Position": 90}`,
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"setting position without position",
+			"PUT", "/article/" + episode + "/position", `{}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"setting negative position",
+			"PUT", "/article/" + episode + "/position", `{"Position": -1}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"setting position of non-existent article",
+			"PUT", "/article/" + feed.UUIDFromString("oops").String() + "/position", `{"Position": 90}`,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"getting unread podcasts",
+			"GET", "/podcasts?unread=true", "",
+			http.StatusOK,
+			[]string{"https://podcast.local/2", "https://podcast.local/1"},
+		},
+	}
+	for _, st := range steps {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(st.method, st.path, strings.NewReader(st.body)))
+
+		if resp.Code != st.code {
+			t.Errorf("%s: StatusCode want %v got %v", st.name, st.code, resp.Code)
+			continue
+		}
+
+		if st.links == nil {
+			continue
+		}
+
+		if got := articleLinks(t, resp); !reflect.DeepEqual(got, st.links) {
+			t.Errorf("%s: articles want %v got %v", st.name, st.links, got)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/article/"+episode, nil))
+
+	var article struct {
+		Position   uint
+		Enclosures []*feed.Enclosure
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&article); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if article.Position != 90 {
+		t.Errorf("Position want %v got %v", 90, article.Position)
+	}
+
+	want := []*feed.Enclosure{{URL: "https://podcast.local/1.mp3", Type: "audio/mpeg", Duration: 3600}}
+	if !reflect.DeepEqual(article.Enclosures, want) {
+		t.Errorf("Enclosures want %v got %v", want, article.Enclosures)
+	}
+}
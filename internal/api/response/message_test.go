@@ -21,6 +21,10 @@ func TestWithMessage(t *testing.T) {
 		t.Errorf("WithMessage StatusCode want %v - got %v", http.StatusInternalServerError, resp.Code)
 	}
 
+	if ct := resp.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("WithMessage Content-Type want application/json - got %v", ct)
+	}
+
 	got := jsn.GetPath("Message").MustString()
 	if want != got {
 		t.Errorf("WithMessage want %v - got %v", want, got)
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/broker"
+	"reader/internal/middleware"
+	"strconv"
+	"time"
+)
+
+// recentEvents is the number of events streams can be resumed from
+const recentEvents = 1000
+
+// streamKeepAlive is how often a comment is sent on idle streams so that
+// proxies do not close them
+const streamKeepAlive = 30 * time.Second
+
+// Stream sends articles as server-sent events as soon as they are
+// stored. Clients which reconnect with a Last-Event-ID are sent the
+// articles they missed, as long as they are still recent.
+func (a *API) Stream(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	// Streams can be restricted to one or more feeds
+	feeds := map[uuid.UUID]bool{}
+	for _, f := range r.URL.Query()["feed"] {
+		u, err := uuid.Parse(f)
+		if err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "invalid feed UUID")
+			return
+		}
+
+		feeds[u] = true
+	}
+
+	var lastID int64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if lastID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			response.WithMessage(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		response.WithMessage(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	events, missed, cancel := a.events.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e broker.Event) error {
+		// Only newly stored articles are streamed
+		if e.Updated || (len(feeds) > 0 && !feeds[e.Feed]) {
+			return nil
+		}
+
+		// Articles from feeds the user is not subscribed to, or which
+		// have been removed since, are not sent
+		article, err := a.s.Article(user, e.Article)
+		if err != nil {
+			return nil
+		}
+
+		data, err := json.Marshal(article)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: article\ndata: %s\n\n", e.ID, data); err != nil {
+			return err
+		}
+
+		flusher.Flush()
+		return nil
+	}
+
+	for _, e := range missed {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			// The stream has fallen behind, the client can resume it
+			// from the last event it was sent
+			if !ok {
+				return
+			}
+
+			if err := send(e); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamEvent is a single server-sent event
+type streamEvent struct {
+	ID   string
+	Link string
+}
+
+// readEvent reads the next event from a stream, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) streamEvent {
+	var e streamEvent
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("could not read event: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.ID != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			var a struct {
+				Link string
+			}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &a); err != nil {
+				t.Fatalf("could not decode event data: %v", err)
+			}
+
+			e.Link = a.Link
+		}
+	}
+}
+
+func TestAPI_Stream(t *testing.T) {
+	s := newTestStorage(t, 10)
+	srv := httptest.NewServer(NewAPI(s))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mock := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock.local"}, Title: "Mock Feed"}
+	mock2 := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock2.local"}, Title: "Mock Feed 2"}
+
+	open := func(lastID string) (*bufio.Reader, func()) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/stream?feed="+mock.UUID().String(), nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not open stream: %v", err)
+		}
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type want text/event-stream got %v", ct)
+		}
+
+		return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+	}
+
+	stream, closeStream := open("")
+
+	store := func(f *feed.Feed, link string) {
+		err := s.Store(f, []*feed.Article{{Link: link, Published: time.Now(), Title: link}})
+		if err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	// Articles from other feeds and articles stored before are not sent
+	store(mock2, "https://mock2.local/article/3")
+	store(mock, "https://mock.local/article/1")
+	store(mock, "https://mock.local/article/3")
+
+	first := readEvent(t, stream)
+	if first.Link != "https://mock.local/article/3" {
+		t.Errorf("event want https://mock.local/article/3 got %v", first.Link)
+	}
+
+	closeStream()
+
+	// Articles stored while disconnected are sent on resuming
+	store(mock, "https://mock.local/article/4")
+
+	stream, closeStream = open(first.ID)
+	defer closeStream()
+
+	if e := readEvent(t, stream); e.Link != "https://mock.local/article/4" {
+		t.Errorf("resumed event want https://mock.local/article/4 got %v", e.Link)
+	}
+
+	resp := httptest.NewRecorder()
+	h := NewAPI(s)
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/stream?feed=oops", nil))
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode want %v got %v", http.StatusBadRequest, resp.Code)
+	}
+}
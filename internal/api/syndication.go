@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/syndication"
+	"strings"
+)
+
+// formatParam is the URL parameter holding the suffix a timeline is
+// requested with
+const formatParam = "format"
+
+// suffixFormats are the feed formats timelines can be requested in by
+// adding a suffix to their URL
+var suffixFormats = map[string]syndication.Format{
+	"rss":  syndication.RSS,
+	"atom": syndication.Atom,
+	"json": syndication.JSONFeed,
+}
+
+// mediaTypeFormats are the feed formats timelines can be requested in
+// by the Accept header
+var mediaTypeFormats = map[string]syndication.Format{
+	"application/rss+xml":   syndication.RSS,
+	"application/atom+xml":  syndication.Atom,
+	"application/feed+json": syndication.JSONFeed,
+}
+
+// feedFormat returns the feed format a timeline is requested in, given
+// either as a suffix of the URL or in the Accept header. The format is
+// empty when the timeline is requested as the API's own JSON.
+func feedFormat(r *http.Request) (syndication.Format, error) {
+	if suffix := chi.URLParam(r, formatParam); suffix != "" {
+		format, ok := suffixFormats[suffix]
+		if !ok {
+			return "", errors.New("unknown feed format")
+		}
+
+		return format, nil
+	}
+
+	// Media types are taken in the order they are given in, which is
+	// good enough for the clients which ask for feeds.
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		if format, ok := mediaTypeFormats[mediaType]; ok {
+			return format, nil
+		}
+
+		if mediaType == "application/json" {
+			return "", nil
+		}
+	}
+
+	return "", nil
+}
+
+// requestURL returns the absolute URL a request was made to
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// writeTimeline responds with a timeline in the given feed format
+func writeTimeline(w http.ResponseWriter, r *http.Request, format syndication.Format, t *syndication.Timeline) {
+	t.FeedLink = requestURL(r)
+
+	w.Header().Set("Content-Type", format.ContentType())
+
+	if err := t.Write(w, format); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
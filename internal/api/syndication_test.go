@@ -0,0 +1,115 @@
+package api
+
+import (
+	"github.com/mmcdole/gofeed"
+	"net/http"
+	"net/http/httptest"
+	"reader/internal/feed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPI_Syndication(t *testing.T) {
+	h := newTestAPI(t, 10)
+	mock := feed.UUIDFromString("https://mock.local").String()
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		contentType string
+		title       string
+		links       []string
+	}{
+		{
+			"latest as RSS",
+			"/latest.rss", "",
+			"application/rss+xml",
+			"Latest articles",
+			[]string{"https://mock2.local/article/2", "https://mock.local/article/2", "https://mock2.local/article/1", "https://mock.local/article/1"},
+		},
+		{
+			"latest as Atom with offset",
+			"/latest.atom?offset=2015-01-01T00:00:00", "",
+			"application/atom+xml",
+			"Latest articles",
+			[]string{"https://mock2.local/article/1", "https://mock.local/article/1"},
+		},
+		{
+			"feed as JSON Feed",
+			"/latest/" + mock + ".json", "",
+			"application/feed+json",
+			"Mock Feed",
+			[]string{"https://mock.local/article/2", "https://mock.local/article/1"},
+		},
+		{
+			"feed by Accept header",
+			"/latest/" + mock, "application/atom+xml;q=0.9, application/json;q=0.8",
+			"application/atom+xml",
+			"Mock Feed",
+			[]string{"https://mock.local/article/2", "https://mock.local/article/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("StatusCode want %v got %v", http.StatusOK, resp.Code)
+			}
+
+			if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Content-Type want %v got %v", tt.contentType, ct)
+			}
+
+			f, err := gofeed.NewParser().Parse(resp.Body)
+			if err != nil {
+				t.Fatalf("could not parse feed: %v", err)
+			}
+
+			if f.Title != tt.title {
+				t.Errorf("Title want %v got %v", tt.title, f.Title)
+			}
+
+			links := []string{}
+			for _, item := range f.Items {
+				links = append(links, item.Link)
+			}
+
+			if !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("items want %v got %v", tt.links, links)
+			}
+		})
+	}
+
+	// The API's own JSON is still returned when no feed is asked for
+	req := httptest.NewRequest("GET", "/latest", nil)
+	req.Header.Set("Accept", "application/json, application/rss+xml")
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+
+	if got := articleLinks(t, resp); len(got) != 4 {
+		t.Errorf("articles want 4 got %v", got)
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/latest.xml", nil))
+
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("StatusCode of unknown format want %v got %v", http.StatusNotFound, resp.Code)
+	}
+
+	// Only timelines can be requested with a suffix
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/feeds.json", nil))
+
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("StatusCode of feeds with suffix want %v got %v", http.StatusNotFound, resp.Code)
+	}
+}
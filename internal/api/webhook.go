@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/middleware"
+	"reader/internal/storage"
+	"time"
+)
+
+// webhookRequest is the request body used when adding a webhook. Articles
+// from every subscribed feed are posted when no feeds are given.
+type webhookRequest struct {
+	URL    string
+	Feeds  []uuid.UUID
+	Secret string
+}
+
+// webhookResponse is a webhook as it is shown by the API. The secret is
+// never shown, only whether deliveries are signed.
+type webhookResponse struct {
+	UUID      uuid.UUID
+	URL       string
+	Feeds     []uuid.UUID
+	Signed    bool
+	CreatedAt time.Time
+}
+
+func newWebhookResponse(w *storage.Webhook) webhookResponse {
+	feeds := w.Feeds
+	if feeds == nil {
+		feeds = []uuid.UUID{}
+	}
+
+	return webhookResponse{
+		UUID:      w.UUID,
+		URL:       w.URL,
+		Feeds:     feeds,
+		Signed:    w.Secret != "",
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+// userWebhook returns a webhook when it belongs to the given user
+func (a *API) userWebhook(user uuid.UUID, id uuid.UUID) (*storage.Webhook, error) {
+	hook, err := a.s.Webhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if hook.User != user {
+		return nil, storage.ErrWebhookNotFound
+	}
+
+	return hook, nil
+}
+
+func (a *API) Webhooks(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	hooks, err := a.s.Webhooks()
+	if err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve webhooks")
+		return
+	}
+
+	resp := []webhookResponse{}
+	for _, hook := range hooks {
+		if hook.User == user {
+			resp = append(resp, newWebhookResponse(hook))
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var wr webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&wr); err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "invalid webhook")
+		return
+	}
+
+	u, err := parseFeedLink(wr.URL)
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "webhook URL must be an absolute http or https URL")
+		return
+	}
+
+	// Webhooks can only be limited to feeds the user is subscribed to
+	for _, id := range wr.Feeds {
+		subscribed, _, err := a.subscribed(user, id)
+		if err != nil && !errors.Is(err, storage.ErrFeedNotFound) {
+			response.WithMessage(w, http.StatusInternalServerError, "could not retrieve feed")
+			return
+		}
+
+		if !subscribed {
+			response.WithMessage(w, http.StatusBadRequest, "not subscribed to feed "+id.String())
+			return
+		}
+	}
+
+	hook := &storage.Webhook{
+		UUID:      uuid.New(),
+		User:      user,
+		URL:       u.String(),
+		Feeds:     wr.Feeds,
+		Secret:    wr.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := a.s.AddWebhook(hook); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not store webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newWebhookResponse(hook)); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
+
+func (a *API) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	if _, err = a.userWebhook(user, id); err == nil {
+		err = a.s.DeleteWebhook(id)
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveries returns the most recent attempts at posting articles
+// to a webhook, newest first.
+func (a *API) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := middleware.UUIDFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusBadRequest, "UUID not found")
+		return
+	}
+
+	var deliveries []*storage.Delivery
+	if _, err = a.userWebhook(user, id); err == nil {
+		deliveries, err = a.s.Deliveries(id)
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			response.WithMessage(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+
+		response.WithMessage(w, http.StatusInternalServerError, "could not retrieve deliveries")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		response.WithMessage(w, http.StatusInternalServerError, "could not generate response")
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestAPI_Webhooks(t *testing.T) {
+	s := newTestStorage(t, 10)
+	h := NewAPI(s)
+
+	mock := feed.UUIDFromString("https://mock.local").String()
+	unknown := feed.UUIDFromString("oops").String()
+
+	// Webhooks of other users are neither listed nor deleted
+	other := &storage.Webhook{UUID: uuid.New(), User: uuid.New(), URL: "https://other.local"}
+	if err := s.AddWebhook(other); err != nil {
+		t.Fatalf("AddWebhook() error = %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/webhooks", strings.NewReader(`{"URL": "https://hook.local", "Feeds": ["`+mock+`"], "Secret": "secret"}`)))
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("StatusCode want %v got %v", http.StatusCreated, resp.Code)
+	}
+
+	var hook webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hook); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+
+	if hook.URL != "https://hook.local" || !hook.Signed || len(hook.Feeds) != 1 || strings.Contains(resp.Body.String(), "secret") {
+		t.Errorf("webhook got %+v", hook)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{
+			"adding webhook without URL",
+			"POST", "/webhooks", `{}`,
+			http.StatusBadRequest,
+		},
+		{
+			"adding webhook with relative URL",
+			"POST", "/webhooks", `{"URL": "/hook"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"adding webhook for unknown feed",
+			"POST", "/webhooks", `{"URL": "https://hook.local", "Feeds": ["` + unknown + `"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"getting deliveries",
+			"GET", "/webhooks/" + hook.UUID.String() + "/deliveries", "",
+			http.StatusOK,
+		},
+		{
+			"getting deliveries of other user",
+			"GET", "/webhooks/" + other.UUID.String() + "/deliveries", "",
+			http.StatusNotFound,
+		},
+		{
+			"deleting webhook of other user",
+			"DELETE", "/webhooks/" + other.UUID.String(), "",
+			http.StatusNotFound,
+		},
+		{
+			"deleting webhook",
+			"DELETE", "/webhooks/" + hook.UUID.String(), "",
+			http.StatusNoContent,
+		},
+		{
+			"deleting deleted webhook",
+			"DELETE", "/webhooks/" + hook.UUID.String(), "",
+			http.StatusNotFound,
+		},
+	}
+	for _, st := range steps {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(st.method, st.path, strings.NewReader(st.body)))
+
+		if resp.Code != st.code {
+			t.Errorf("%s: StatusCode want %v got %v", st.name, st.code, resp.Code)
+		}
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/webhooks", nil))
+
+	if resp.Code != http.StatusOK || strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Errorf("webhooks want [] got %v %v", resp.Code, resp.Body.String())
+	}
+
+	if _, err := s.Webhook(other.UUID); err != nil {
+		t.Errorf("Webhook() of other user error = %v", err)
+	}
+}
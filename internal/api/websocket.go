@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"reader/internal/api/response"
+	"reader/internal/broker"
+	"reader/internal/feed"
+	"reader/internal/middleware"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// wsWriteTimeout is how long writing a single message may take
+	wsWriteTimeout = 10 * time.Second
+
+	// wsPongTimeout is how long a client may take to answer a ping
+	wsPongTimeout = 60 * time.Second
+
+	// wsPingInterval is how often clients are pinged, which must be
+	// shorter than wsPongTimeout
+	wsPingInterval = wsPongTimeout * 9 / 10
+
+	// wsMaxRequestSize is the largest message clients may send
+	wsMaxRequestSize = 4 << 10
+)
+
+// wsRequest is a message sent by websocket clients to subscribe to or
+// unsubscribe from either a feed or a folder
+type wsRequest struct {
+	// Either subscribe or unsubscribe
+	Action string
+
+	Feed   *uuid.UUID
+	Folder *uuid.UUID
+}
+
+// wsMessage is a message sent to websocket clients. Articles are sent
+// with the type article, requests are answered with the type subscribed
+// or unsubscribed, and requests which could not be handled with error.
+type wsMessage struct {
+	Type string
+
+	// Either added or updated for articles
+	Event string `json:",omitempty"`
+
+	Feed    *uuid.UUID    `json:",omitempty"`
+	Folder  *uuid.UUID    `json:",omitempty"`
+	Article *feed.Article `json:",omitempty"`
+	Message string        `json:",omitempty"`
+}
+
+// wsSubscriptions are the feeds and folders a websocket client has
+// subscribed to
+type wsSubscriptions struct {
+	mu      sync.Mutex
+	feeds   map[uuid.UUID]bool
+	folders map[uuid.UUID]bool
+}
+
+// WebSocket sends articles to clients as they are added or updated,
+// from the feeds and folders clients subscribe to once connected.
+func (a *API) WebSocket(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		response.WithMessage(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     a.checkOrigin,
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	events, _, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	subs := &wsSubscriptions{
+		feeds:   map[uuid.UUID]bool{},
+		folders: map[uuid.UUID]bool{},
+	}
+
+	// Requests are read on their own goroutine as only one goroutine
+	// may read from and one may write to a connection
+	replies := make(chan wsMessage)
+	done := make(chan struct{})
+	closed := make(chan struct{})
+	defer close(closed)
+
+	go func() {
+		defer close(done)
+		a.readWebSocket(conn, user, subs, replies, closed)
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	write := func(m wsMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(m)
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-r.Context().Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		case m := <-replies:
+			if err := write(m); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client fell behind"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+
+			m, ok := a.wsArticle(user, subs, e)
+			if !ok {
+				continue
+			}
+
+			if err := write(m); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// checkOrigin reports whether a websocket may be connected from the
+// origin of the request. Clients other than browsers send no origin and
+// are always allowed, browsers must be on the same host as the API or on
+// one of the allowed origins.
+func (a *API) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return a.origins[strings.ToLower(origin)]
+}
+
+// readWebSocket handles requests from a websocket client until the
+// connection is closed, passing replies on to be written
+func (a *API) readWebSocket(conn *websocket.Conn, user uuid.UUID, subs *wsSubscriptions, replies chan<- wsMessage, closed <-chan struct{}) {
+	conn.SetReadLimit(wsMaxRequestSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		reply := wsMessage{Type: "error", Message: "invalid request"}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err == nil {
+			reply = a.wsRequest(user, subs, req)
+		}
+
+		select {
+		case replies <- reply:
+		case <-closed:
+			return
+		}
+	}
+}
+
+// wsRequest changes the subscriptions of a websocket client
+func (a *API) wsRequest(user uuid.UUID, subs *wsSubscriptions, req wsRequest) wsMessage {
+	m := wsMessage{
+		Feed:   req.Feed,
+		Folder: req.Folder,
+	}
+
+	switch req.Action {
+	case "subscribe":
+		m.Type = "subscribed"
+	case "unsubscribe":
+		m.Type = "unsubscribed"
+	default:
+		return wsMessage{Type: "error", Message: "unknown action"}
+	}
+
+	subscribe := req.Action == "subscribe"
+
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	switch {
+	case req.Feed != nil && req.Folder == nil:
+		if !subscribe {
+			delete(subs.feeds, *req.Feed)
+			break
+		}
+
+		if ok, _, err := a.subscribed(user, *req.Feed); err != nil || !ok {
+			return wsMessage{Type: "error", Feed: req.Feed, Message: "feed not found"}
+		}
+
+		subs.feeds[*req.Feed] = true
+	case req.Folder != nil && req.Feed == nil:
+		if !subscribe {
+			delete(subs.folders, *req.Folder)
+			break
+		}
+
+		if _, err := a.s.Folder(user, *req.Folder); err != nil {
+			return wsMessage{Type: "error", Folder: req.Folder, Message: "folder not found"}
+		}
+
+		subs.folders[*req.Folder] = true
+	default:
+		return wsMessage{Type: "error", Message: "either a feed or a folder is required"}
+	}
+
+	return m
+}
+
+// wsArticle returns the message for an event when the client has
+// subscribed to the article's feed, or to a folder it is in
+func (a *API) wsArticle(user uuid.UUID, subs *wsSubscriptions, e broker.Event) (wsMessage, bool) {
+	if !a.wsSubscribed(user, subs, e.Feed) {
+		return wsMessage{}, false
+	}
+
+	// Articles from feeds the user has since unsubscribed from, or which
+	// have been removed since, are not sent
+	article, err := a.s.Article(user, e.Article)
+	if err != nil {
+		return wsMessage{}, false
+	}
+
+	m := wsMessage{
+		Type:    "article",
+		Event:   "added",
+		Feed:    &e.Feed,
+		Article: article,
+	}
+
+	if e.Updated {
+		m.Event = "updated"
+	}
+
+	return m, true
+}
+
+func (a *API) wsSubscribed(user uuid.UUID, subs *wsSubscriptions, id uuid.UUID) bool {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	if subs.feeds[id] {
+		return true
+	}
+
+	// Folders are looked up each time as feeds can be moved between
+	// folders while clients are connected
+	for folder := range subs.folders {
+		f, err := a.s.Folder(user, folder)
+		if err != nil {
+			continue
+		}
+
+		for _, fid := range f.Feeds {
+			if fid == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
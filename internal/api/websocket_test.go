@@ -0,0 +1,176 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/middleware"
+	"reader/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPI_WebSocket(t *testing.T) {
+	s := newTestStorage(t, 10)
+	srv := httptest.NewServer(NewAPI(s))
+	defer srv.Close()
+
+	mock := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock.local"}, Title: "Mock Feed"}
+	mock2 := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "mock2.local"}, Title: "Mock Feed 2"}
+
+	folder := &storage.Folder{UUID: uuid.New(), Name: "News"}
+	if err := s.AddFolder(storage.DefaultUser, folder); err != nil {
+		t.Fatalf("AddFolder() error = %v", err)
+	}
+
+	if err := s.SetFolder(storage.DefaultUser, mock.UUID(), folder.UUID); err != nil {
+		t.Fatalf("SetFolder() error = %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	mock2ID := mock2.UUID()
+	unknown := feed.UUIDFromString("oops")
+
+	requests := []struct {
+		req  wsRequest
+		want string
+	}{
+		{wsRequest{Action: "subscribe", Folder: &folder.UUID}, "subscribed"},
+		{wsRequest{Action: "subscribe", Feed: &mock2ID}, "subscribed"},
+		{wsRequest{Action: "subscribe", Feed: &unknown}, "error"},
+		{wsRequest{Action: "subscribe"}, "error"},
+		{wsRequest{Action: "watch", Feed: &mock2ID}, "error"},
+		{wsRequest{Action: "unsubscribe", Feed: &mock2ID}, "unsubscribed"},
+	}
+	for _, r := range requests {
+		if err := conn.WriteJSON(r.req); err != nil {
+			t.Fatalf("could not send request: %v", err)
+		}
+
+		var m wsMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("could not read reply: %v", err)
+		}
+
+		if m.Type != r.want {
+			t.Errorf("reply to %v %+v want %v got %+v", r.req.Action, r.req, r.want, m)
+		}
+	}
+
+	// Articles are only sent from the feeds in the subscribed folder
+	err = s.Store(mock2, []*feed.Article{{Link: "https://mock2.local/article/3", Title: "Article 3"}})
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	added := &feed.Article{Link: "https://mock.local/article/3", Title: "Article 3"}
+	updated := *added
+	updated.Title = "Article 3 updated"
+
+	// Articles are sent as they are when the message is sent, so each one
+	// is read before it is changed again
+	for _, want := range []struct {
+		articles []*feed.Article
+		event    string
+		title    string
+	}{
+		{[]*feed.Article{added}, "added", "Article 3"},
+		{[]*feed.Article{added, &updated}, "updated", "Article 3 updated"},
+	} {
+		if err := s.Store(mock, want.articles); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+
+		var m wsMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("could not read article: %v", err)
+		}
+
+		if m.Type != "article" || m.Event != want.event || m.Article == nil || m.Article.Title != want.title {
+			t.Errorf("article want %v %v got %+v", want.event, want.title, m)
+		}
+	}
+}
+
+func TestAPI_WebSocket_Origin(t *testing.T) {
+	srv := httptest.NewServer(NewAPI(newTestStorage(t, 10), WithAllowedOrigins("https://app.local/")))
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{srv.URL, http.StatusSwitchingProtocols},
+		{"https://APP.local", http.StatusSwitchingProtocols},
+		{"https://evil.local", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(u, header)
+			if conn != nil {
+				conn.Close()
+			}
+
+			if resp == nil {
+				t.Fatalf("could not connect: %v", err)
+			}
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("StatusCode want %v got %v", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAPI_WebSocket_APIKey(t *testing.T) {
+	srv := httptest.NewServer(NewAPI(newTestStorage(t, 10), WithAPIKeys("admin-secret")))
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	// Browsers can only give the key as a query parameter
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"without key", u, http.StatusUnauthorized},
+		{"with invalid key", u + "?" + middleware.APIKeyParam + "=oops", http.StatusUnauthorized},
+		{"with key in query", u + "?" + middleware.APIKeyParam + "=admin-secret", http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial(tt.url, nil)
+			if conn != nil {
+				conn.Close()
+			}
+
+			if resp == nil {
+				t.Fatalf("could not connect: %v", err)
+			}
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("StatusCode want %v got %v", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"github.com/google/uuid"
+	"reader/internal/storage"
+	"sync"
+	"time"
+)
+
+// Event is a single article which has been added to storage or changed
+type Event struct {
+	// ID orders events. IDs are taken from the time events are published
+	// so that they keep increasing across restarts.
+	ID int64
+
+	Feed    uuid.UUID
+	Article uuid.UUID
+
+	// Whether the article had already been stored before
+	Updated bool
+}
+
+// subscriberBuffer is the number of events a subscriber can fall behind
+// by before it is dropped
+const subscriberBuffer = 256
+
+// Broker passes storage changes on to everyone who is listening for
+// them. The most recent events are kept so that subscribers which have
+// missed some can catch up.
+type Broker struct {
+	mu sync.Mutex
+
+	subscribers map[chan Event]struct{}
+
+	// Most recent events, oldest first
+	recent []Event
+
+	// Number of recent events which are kept
+	size int
+
+	lastID int64
+}
+
+// New creates a broker which keeps the given number of recent events
+func New(size int) *Broker {
+	return &Broker{
+		subscribers: map[chan Event]struct{}{},
+		size:        size,
+	}
+}
+
+// Publish sends an event for each added or updated article to every
+// subscriber. It can be registered as a storage hook.
+func (b *Broker) Publish(c storage.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, id := range c.Added {
+		b.publish(Event{Feed: c.Feed, Article: id})
+	}
+
+	for _, id := range c.Updated {
+		b.publish(Event{Feed: c.Feed, Article: id, Updated: true})
+	}
+}
+
+// publish sends a single event, it must be called with the lock held
+func (b *Broker) publish(e Event) {
+	b.lastID++
+	if now := time.Now().UnixNano(); now > b.lastID {
+		b.lastID = now
+	}
+
+	e.ID = b.lastID
+
+	b.recent = append(b.recent, e)
+	if len(b.recent) > b.size {
+		b.recent = b.recent[len(b.recent)-b.size:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Subscribers which have fallen too far behind are dropped
+			// rather than holding up storage. They can catch up with
+			// the recent events when they subscribe again.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of events published from now on along
+// with the recent events which were published after the given event ID.
+// The channel is closed when the subscriber falls too far behind, and
+// the returned function must be called once events are no longer read.
+func (b *Broker) Subscribe(after int64) (<-chan Event, []Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missed := []Event{}
+	if after > 0 {
+		for _, e := range b.recent {
+			if e.ID > after {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	return ch, missed, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
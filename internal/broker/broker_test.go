@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"github.com/google/uuid"
+	"reader/internal/storage"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := New(2)
+	f := uuid.New()
+	a1, a2, a3 := uuid.New(), uuid.New(), uuid.New()
+
+	events, missed, cancel := b.Subscribe(0)
+	if len(missed) != 0 {
+		t.Errorf("Subscribe() missed got = %v, want none", missed)
+	}
+
+	b.Publish(storage.Change{Feed: f, Added: []uuid.UUID{a1}, Updated: []uuid.UUID{a2}})
+
+	first, second := <-events, <-events
+	if first.Article != a1 || second.Article != a2 || first.Feed != f {
+		t.Errorf("events got = %v %v, want %v %v", first, second, a1, a2)
+	}
+
+	if first.Updated || !second.Updated {
+		t.Errorf("events updated got = %v %v, want false true", first.Updated, second.Updated)
+	}
+
+	if second.ID <= first.ID {
+		t.Errorf("event IDs got = %v %v, want increasing", first.ID, second.ID)
+	}
+
+	cancel()
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Errorf("events open after cancel")
+	}
+
+	b.Publish(storage.Change{Feed: f, Added: []uuid.UUID{a3}})
+
+	// Only the most recent events after the given ID are kept
+	_, missed, cancel = b.Subscribe(first.ID)
+	defer cancel()
+
+	if len(missed) != 2 || missed[0].Article != a2 || missed[1].Article != a3 {
+		t.Errorf("Subscribe() missed got = %v, want %v %v", missed, a2, a3)
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := New(1)
+
+	events, _, cancel := b.Subscribe(0)
+	defer cancel()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(storage.Change{Feed: uuid.New(), Added: []uuid.UUID{uuid.New()}})
+	}
+
+	n := 0
+	for range events {
+		n++
+	}
+
+	if n != subscriberBuffer {
+		t.Errorf("events before drop got = %v, want %v", n, subscriberBuffer)
+	}
+}
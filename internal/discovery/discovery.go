@@ -0,0 +1,213 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrNoFeeds = errors.New("no feeds found")
+
+// Paths tried on the site when a page does not link to any feeds
+var fallbacks = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.json"}
+
+// Media types of the feeds pages link to
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// Largest page or feed read while discovering feeds
+const maxBodySize = 5 << 20
+
+// Feed is a feed found on a site
+type Feed struct {
+	FeedLink *url.URL
+	Title    string
+}
+
+// Discoverer finds the feeds of a site from the URL of any of its pages
+type Discoverer struct {
+	c *http.Client
+}
+
+type Option func(*Discoverer)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Discoverer) {
+		d.c = client
+	}
+}
+
+func NewDiscoverer(options ...Option) *Discoverer {
+	d := &Discoverer{}
+
+	defaultOptions := []Option{
+		WithHTTPClient(&http.Client{Timeout: 10 * time.Second}),
+	}
+
+	for _, opt := range append(defaultOptions, options...) {
+		opt(d)
+	}
+
+	return d
+}
+
+// Discover returns the feeds of the site the given page belongs to. A
+// link to a feed is returned as it is. Otherwise feeds are taken from
+// the alternate links of the page, or when there are none from the
+// first of the common feed paths on the site which is a feed.
+func (d *Discoverer) Discover(ctx context.Context, page *url.URL) ([]*Feed, error) {
+	body, final, err := d.get(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+
+	if pf, ok := parse(body); ok {
+		return []*Feed{{FeedLink: final, Title: pf.Title}}, nil
+	}
+
+	if feeds := alternates(final, body); len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	for _, p := range fallbacks {
+		u := final.ResolveReference(&url.URL{Path: p})
+
+		body, feedLink, err := d.get(ctx, u)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			continue
+		}
+
+		if pf, ok := parse(body); ok {
+			return []*Feed{{FeedLink: feedLink, Title: pf.Title}}, nil
+		}
+	}
+
+	return nil, ErrNoFeeds
+}
+
+// get returns the body of a page along with its URL once any redirects
+// have been followed
+func (d *Discoverer) get(ctx context.Context, u *url.URL) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := d.c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("could not get %v: %s", u, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, resp.Request.URL, nil
+}
+
+// parse reports whether a body is a feed. Any JSON object parses as a
+// JSON Feed, so JSON is only a feed when it gives its version.
+func parse(body []byte) (*gofeed.Feed, bool) {
+	pf, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil || (pf.FeedType == "json" && pf.FeedVersion == "") {
+		return nil, false
+	}
+
+	return pf, true
+}
+
+// alternates returns the feeds an HTML page links to with
+// <link rel="alternate">, resolved against the page's base URL
+func alternates(page *url.URL, body []byte) []*Feed {
+	base := page
+	feeds := []*Feed{}
+	seen := map[string]bool{}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return feeds
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+
+		name, hasAttr := z.TagName()
+		switch string(name) {
+		case "body":
+			// Feeds are only linked to from the head of a page
+			return feeds
+		case "base", "link":
+		default:
+			continue
+		}
+
+		attrs := map[string]string{}
+		for more := hasAttr; more; {
+			var k, v []byte
+			k, v, more = z.TagAttr()
+			attrs[string(k)] = string(v)
+		}
+
+		switch string(name) {
+		case "base":
+			if u, err := page.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = u
+			}
+		case "link":
+			if !hasRel(attrs["rel"], "alternate") || attrs["href"] == "" {
+				continue
+			}
+
+			t, _, err := mime.ParseMediaType(attrs["type"])
+			if err != nil || !feedTypes[t] {
+				continue
+			}
+
+			u, err := base.Parse(attrs["href"])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || seen[u.String()] {
+				continue
+			}
+
+			seen[u.String()] = true
+			feeds = append(feeds, &Feed{FeedLink: u, Title: attrs["title"]})
+		}
+	}
+}
+
+// hasRel reports whether a space separated list of link relations
+// contains the given relation
+func hasRel(rels string, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const rss = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>Mock Feed</title>
+</channel>
+</rss>
+`
+
+func TestDiscoverer_Discover(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<!DOCTYPE html>
+<html>
+<head>
+ <title>Mock</title>
+ <link rel="stylesheet" type="text/css" href="/style.css">
+ <link rel="alternate" type="application/rss+xml" title="Posts" href="/posts.xml">
+ <link rel="alternate" type="application/atom+xml; charset=utf-8" title="Posts" href="posts.atom">
+ <link rel="Alternate" type="application/feed+json" href="https://other.local/feed.json"/>
+ <link rel="alternate" type="application/rss+xml" href="/posts.xml">
+ <link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+</head>
+<body>
+ <link rel="alternate" type="application/rss+xml" href="/body.xml">
+</body>
+</html>`))
+	})
+	mux.HandleFunc("/based/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><base href="/blog/"><link rel="alternate" type="application/rss+xml" href="feed.xml"></head></html>`))
+	})
+	mux.HandleFunc("/plain/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>No feeds</title></head></html>`))
+	})
+	mux.HandleFunc("/feed", http.NotFound)
+	mux.HandleFunc("/rss.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rss))
+	})
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rss))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed.xml", http.StatusMovedPermanently)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	link := func(path string) *url.URL {
+		u, _ := url.Parse(srv.URL + path)
+		return u
+	}
+
+	other, _ := url.Parse("https://other.local/feed.json")
+
+	tests := []struct {
+		name string
+		page string
+		want []*Feed
+	}{
+		{
+			"alternate links",
+			"/about/",
+			[]*Feed{
+				{FeedLink: link("/posts.xml"), Title: "Posts"},
+				{FeedLink: link("/about/posts.atom"), Title: "Posts"},
+				{FeedLink: other},
+			},
+		},
+		{
+			"alternate links relative to base",
+			"/based/",
+			[]*Feed{{FeedLink: link("/blog/feed.xml")}},
+		},
+		{
+			"fallback paths",
+			"/plain/",
+			[]*Feed{{FeedLink: link("/rss.xml"), Title: "Mock Feed"}},
+		},
+		{
+			"feed link",
+			"/feed.xml",
+			[]*Feed{{FeedLink: link("/feed.xml"), Title: "Mock Feed"}},
+		},
+		{
+			"redirected feed link",
+			"/moved",
+			[]*Feed{{FeedLink: link("/feed.xml"), Title: "Mock Feed"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDiscoverer().Discover(context.Background(), link(tt.page))
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Discover() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverer_Discover_NoFeeds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"not": "a feed"}`))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	if _, err := NewDiscoverer().Discover(context.Background(), u); err != ErrNoFeeds {
+		t.Errorf("Discover() error = %v, want %v", err, ErrNoFeeds)
+	}
+
+	u.Path = "/missing"
+	if _, err := NewDiscoverer().Discover(context.Background(), u); err == nil || err == ErrNoFeeds {
+		t.Errorf("Discover() of missing page error = %v, want status error", err)
+	}
+}
@@ -0,0 +1,362 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/net/html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var ErrNoContent = errors.New("no content found")
+
+// Least text the main content of a page must have, anything shorter is
+// more likely a teaser or a page which isn't an article
+const minContentLength = 250
+
+// Elements removed before looking for the main content as they are
+// never part of it
+var removed = map[string]bool{
+	"aside":    true,
+	"button":   true,
+	"footer":   true,
+	"form":     true,
+	"header":   true,
+	"iframe":   true,
+	"input":    true,
+	"link":     true,
+	"meta":     true,
+	"nav":      true,
+	"noscript": true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+}
+
+// Elements whose text is scored as a paragraph
+var paragraphs = map[string]bool{
+	"p":   true,
+	"pre": true,
+	"td":  true,
+}
+
+// Elements which start a new block, a div without any of them is
+// scored as a paragraph
+var blocks = map[string]bool{
+	"article":    true,
+	"blockquote": true,
+	"div":        true,
+	"dl":         true,
+	"figure":     true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"section":    true,
+	"table":      true,
+	"ul":         true,
+}
+
+var (
+	// Classes and IDs of elements which are unlikely to hold the main
+	// content, unless they also look like they might
+	unlikely = regexp.MustCompile(`(?i)ad-|advert|banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|legends|menu|modal|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|popup|promo|tweet|twitter`)
+	maybe    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|story`)
+
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)hidden|^hid$|banner|byline|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// Extract returns the HTML of the main content of a page, such as the
+// body of a news article, without the navigation, comments and adverts
+// around it. Paragraphs are scored by how much text they have and their
+// scores are given to the elements containing them, the content is the
+// element with the best score along with any siblings which also score
+// well.
+func Extract(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	body := find(doc, "body")
+	if body == nil {
+		return "", ErrNoContent
+	}
+
+	prune(body)
+
+	scores := map[*html.Node]float64{}
+	candidates := []*html.Node{}
+
+	// Initialise the score of an element the first time it is given the
+	// score of a paragraph
+	candidate := func(n *html.Node) {
+		if _, ok := scores[n]; ok {
+			return
+		}
+
+		scores[n] = initialScore(n)
+		candidates = append(candidates, n)
+	}
+
+	walk(body, func(n *html.Node) {
+		if !paragraph(n) {
+			return
+		}
+
+		t := text(n)
+		if len(t) < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(t, ",")) + float64(min(len(t)/100, 3))
+
+		if p := n.Parent; p != nil && p.Type == html.ElementNode {
+			candidate(p)
+			scores[p] += score
+
+			if g := p.Parent; g != nil && g.Type == html.ElementNode {
+				candidate(g)
+				scores[g] += score / 2
+			}
+		}
+	})
+
+	// Elements which are mostly links, such as lists of other articles,
+	// have their scores reduced
+	var top *html.Node
+	for _, n := range candidates {
+		scores[n] *= 1 - linkDensity(n)
+
+		if top == nil || scores[n] > scores[top] {
+			top = n
+		}
+	}
+
+	// Pages which are mostly links, such as the front page of a site,
+	// have no main content of their own
+	if top == nil || len(text(top)) < minContentLength || linkDensity(top) > 0.5 {
+		return "", ErrNoContent
+	}
+
+	var b bytes.Buffer
+	for _, n := range content(top, scores) {
+		if err := html.Render(&b, n); err != nil {
+			return "", err
+		}
+	}
+
+	return b.String(), nil
+}
+
+// content returns the top element along with those of its siblings
+// which are likely part of the same content, such as paragraphs which
+// aren't wrapped in the same element
+func content(top *html.Node, scores map[*html.Node]float64) []*html.Node {
+	if top.Parent == nil {
+		return []*html.Node{top}
+	}
+
+	threshold := scores[top] * 0.2
+	if threshold < 10 {
+		threshold = 10
+	}
+
+	nodes := []*html.Node{}
+	for n := top.Parent.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode {
+			continue
+		}
+
+		if score, ok := scores[n]; n == top || (ok && score >= threshold) {
+			nodes = append(nodes, n)
+			continue
+		}
+
+		if n.Data != "p" {
+			continue
+		}
+
+		t := text(n)
+		density := linkDensity(n)
+		if (len(t) > 80 && density < 0.25) || (len(t) > 0 && density == 0 && strings.HasSuffix(t, ".")) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return nodes
+}
+
+// prune removes the elements which are never part of the main content
+// along with those which are unlikely to be
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case removed[c.Data] || hasAttr(c, "hidden") || unlikelyCandidate(c):
+			n.RemoveChild(c)
+		default:
+			prune(c)
+		}
+
+		c = next
+	}
+}
+
+// unlikelyCandidate reports whether the class or ID of an element says
+// it is something other than the main content
+func unlikelyCandidate(n *html.Node) bool {
+	if n.Data == "body" || n.Data == "article" || n.Data == "a" {
+		return false
+	}
+
+	s := attr(n, "class") + " " + attr(n, "id")
+	return unlikely.MatchString(s) && !maybe.MatchString(s)
+}
+
+// paragraph reports whether an element's text is scored, divs are only
+// scored when they have no blocks of their own
+func paragraph(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	if paragraphs[n.Data] {
+		return true
+	}
+
+	if n.Data != "div" {
+		return false
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blocks[c.Data] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// initialScore scores an element by what it is and by its class and ID
+func initialScore(n *html.Node) float64 {
+	var score float64
+
+	switch n.Data {
+	case "article":
+		score = 10
+	case "div":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+
+	for _, s := range []string{attr(n, "class"), attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+
+		if negative.MatchString(s) {
+			score -= 25
+		}
+
+		if positive.MatchString(s) {
+			score += 25
+		}
+	}
+
+	return score
+}
+
+// linkDensity returns how much of an element's text is in links
+func linkDensity(n *html.Node) float64 {
+	length := len(text(n))
+	if length == 0 {
+		return 0
+	}
+
+	links := 0
+	walk(n, func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			links += len(text(c))
+		}
+	})
+
+	return float64(links) / float64(length)
+}
+
+// text returns the text of a node with whitespace collapsed
+func text(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+			b.WriteString(" ")
+		}
+	})
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// walk calls fn for a node and everything inside it, parents first
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func find(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, name); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
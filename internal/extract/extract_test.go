@@ -0,0 +1,102 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+)
+
+const sentence = "The quick brown fox jumps over the lazy dog, again and again, until the dog finally gets up and walks away from the fox."
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		contains []string
+		excludes []string
+		wantErr  error
+	}{
+		{
+			"article",
+			`<html><head><title>Article</title><script>track()</script></head><body>
+<header><nav><a href="/">Home</a> <a href="/news">News</a></nav></header>
+<main><article>
+<h1>Headline</h1>
+<div data-component="text-block"><p>` + sentence + `</p></div>
+<div data-component="text-block"><p>` + sentence + `</p></div>
+<div data-component="text-block"><p>` + sentence + `</p></div>
+<div class="share-tools"><a href="https://social.local/share">Share this article with your friends and family</a></div>
+</article></main>
+<section class="related-stories"><p><a href="/1">Another story about something else entirely</a></p></section>
+<footer><p>Copyright, all rights reserved, do not copy this page anywhere.</p></footer>
+</body></html>`,
+			[]string{"<article>", "<h1>Headline</h1>", sentence},
+			[]string{"Home", "Share", "Another story", "Copyright", "track()"},
+			nil,
+		},
+		{
+			"paragraphs in a div",
+			`<html><body>
+<div class="sidebar"><p>Most read, most read, most read, most read, most read, most read.</p></div>
+<div class="sdc-article-body">
+<p>` + sentence + `</p>
+<p>` + sentence + `</p>
+<p>` + sentence + `</p>
+<div class="sdc-article-widget"><ul><li><a href="/video">Watch the video of what happened next</a></li></ul></div>
+</div>
+<div id="comments"><p>` + sentence + `</p></div>
+</body></html>`,
+			[]string{`<div class="sdc-article-body">`, sentence},
+			[]string{"Most read", "comments"},
+			nil,
+		},
+		{
+			"sibling paragraphs",
+			`<html><body><div>
+<p>Introduction to the story, which is not wrapped in the same element as the rest.</p>
+<div class="story-body"><p>` + sentence + `</p><p>` + sentence + `</p><p>` + sentence + `</p></div>
+<p><a href="/1">Link</a> <a href="/2">Link</a> <a href="/3">Link</a> <a href="/4">Link</a></p>
+</div></body></html>`,
+			[]string{"Introduction to the story", `<div class="story-body">`},
+			[]string{`href="/1"`},
+			nil,
+		},
+		{
+			"links only",
+			`<html><body><ul>
+<li><p><a href="/1">` + sentence + `</a></p></li>
+<li><p><a href="/2">` + sentence + `</a></p></li>
+<li><p><a href="/3">` + sentence + `</a></p></li>
+</ul></body></html>`,
+			nil,
+			nil,
+			ErrNoContent,
+		},
+		{
+			"teaser",
+			`<html><body><div class="content"><p>Only a single short sentence on this page.</p></div></body></html>`,
+			nil,
+			nil,
+			ErrNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(strings.NewReader(tt.page))
+			if err != tt.wantErr {
+				t.Fatalf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("Extract() got = %v, want it to contain %v", got, s)
+				}
+			}
+
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("Extract() got = %v, want it not to contain %v", got, s)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/google/uuid"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -13,6 +14,23 @@ type Feed struct {
 	ModifiedAt time.Time
 	Title      string
 	Link       string
+
+	// Validators returned by the feed server on the last successful
+	// request, kept verbatim so they can be sent back to the server.
+	ETag         string
+	LastModified string
+
+	// ID keeps the UUID of a feed which has moved to a new feed link, as
+	// the UUID would otherwise change along with the link. We don't show
+	// it when outputting to JSON because the UUID is shown instead.
+	ID uuid.UUID `json:"-"`
+
+	// Inactive feeds are no longer read, such as feeds which are gone
+	Inactive bool
+
+	// FullContent feeds only publish a summary of each article, so the
+	// content of their articles is fetched from the article link instead
+	FullContent bool
 }
 
 type JSONFeed Feed
@@ -30,6 +48,10 @@ func (f *Feed) MarshalJSON() ([]byte, error) {
 }
 
 func (f *Feed) UUID() uuid.UUID {
+	if f.ID != uuid.Nil {
+		return f.ID
+	}
+
 	return UUIDFromString(f.FeedLink.String())
 }
 
@@ -38,30 +60,133 @@ type Image struct {
 	URL   string
 }
 
+// Person is an author of an article
+type Person struct {
+	Name  string
+	Email string
+}
+
+// Enclosure is a file attached to an article, such as a podcast episode
+type Enclosure struct {
+	URL  string
+	Type string
+
+	// Length of the file in bytes, or 0 when not known
+	Length int64
+
+	// Duration of audio or video in seconds, or 0 when not known
+	Duration uint
+}
+
+// Media reports whether the enclosure is audio or video
+func (e *Enclosure) Media() bool {
+	t := strings.ToLower(e.Type)
+	return strings.HasPrefix(t, "audio/") || strings.HasPrefix(t, "video/")
+}
+
+// State is how far a reader has got with an article
+type State struct {
+	Read    bool
+	Starred bool
+
+	// Position in seconds the reader has got to playing the audio or
+	// video of an article, such as a podcast episode
+	Position uint
+}
+
 type Article struct {
 	// We don't show GUID when outputting to JSON
 	// because we calculate a UUID from a GUID or
 	// Link instead.
-	GUID        string `json:"-"`
-	Link        string
+	GUID string `json:"-"`
+	Link string
+
+	// Published falls back to when the article was updated, and storage
+	// fills in when it was first stored for articles without either
 	Published   time.Time
+	Updated     time.Time
 	Title       string
 	Description string
 	Image       *Image
+
+	// Content is the full content of the article when the feed gives
+	// it as well as a description, such as with content:encoded.
+	Content string
+
+	// ContentFetched is when the content was fetched from the article
+	// link, for feeds which only publish a summary. It is zero when the
+	// content is from the feed itself.
+	ContentFetched time.Time
+
+	Authors    []*Person
+	Categories []string
+	Enclosures []*Enclosure
+
+	// Description and content as published when they were changed by
+	// sanitising them. We don't show them when outputting to JSON, see
+	// Raw for getting the article as it was published.
+	RawDescription string `json:"-"`
+	RawContent     string `json:"-"`
+
+	// State is not part of the feed itself, it is filled
+	// in by storage when articles are retrieved.
+	State
 }
 
 type JSONArticle Article
 
 func (a *Article) MarshalJSON() ([]byte, error) {
+	ja := JSONArticle(*a)
+
+	// Lists are always output as arrays, even for articles without any
+	if ja.Authors == nil {
+		ja.Authors = []*Person{}
+	}
+
+	if ja.Categories == nil {
+		ja.Categories = []string{}
+	}
+
+	if ja.Enclosures == nil {
+		ja.Enclosures = []*Enclosure{}
+	}
+
 	return json.Marshal(struct {
 		JSONArticle
 		UUID string
 	}{
-		JSONArticle(*a),
+		ja,
 		a.UUID().String(),
 	})
 }
 
+// Raw returns a copy of the article with its description and content
+// as they were published, before they were sanitised
+func (a *Article) Raw() *Article {
+	c := *a
+
+	if a.RawDescription != "" {
+		c.Description = a.RawDescription
+	}
+
+	if a.RawContent != "" {
+		c.Content = a.RawContent
+	}
+
+	return &c
+}
+
+// Media reports whether the article has audio or video enclosures
+func (a *Article) Media() bool {
+	for _, e := range a.Enclosures {
+		if e.Media() {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (a *Article) UUID() uuid.UUID {
 	if a.GUID != "" {
 		return UUIDFromString(a.GUID)
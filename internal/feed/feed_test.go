@@ -2,6 +2,7 @@ package feed
 
 import (
 	"github.com/google/uuid"
+	"net/url"
 	"reflect"
 	"testing"
 )
@@ -42,4 +43,17 @@ func Test_uuidFromString(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestFeed_UUID(t *testing.T) {
+	link := &url.URL{Scheme: "https", Host: "rss.local"}
+	id := UUIDFromString("https://old.local")
+
+	if got := (&Feed{FeedLink: link}).UUID(); got != UUIDFromString(link.String()) {
+		t.Errorf("UUID() got = %v, want %v", got, UUIDFromString(link.String()))
+	}
+
+	if got := (&Feed{FeedLink: link, ID: id}).UUID(); got != id {
+		t.Errorf("UUID() of moved feed got = %v, want %v", got, id)
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/storage"
+	"strings"
+)
+
+const apiKeyKey contextKey = "apiKey"
+
+// APIKeyHeader is the request header an API key can be given in
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyParam is the query parameter an API key can be given in for
+// streams, as browsers can't set headers on EventSource and WebSocket
+// requests
+const APIKeyParam = "api_key"
+
+// APIKey authenticates requests by the API key given in the APIKeyHeader
+// or as a bearer token. The given lookup returns the stored key for a key
+// given in a request, and the request is made by the user the key belongs to.
+func APIKey(lookup func(key string) (*storage.APIKey, error)) func(http.Handler) http.Handler {
+	return authenticate(lookup, apiKeyFromRequest)
+}
+
+// StreamAPIKey authenticates requests like APIKey but also accepts the
+// API key in the APIKeyParam query parameter. It should only be used for
+// streams, since query parameters are more likely to end up in logs.
+func StreamAPIKey(lookup func(key string) (*storage.APIKey, error)) func(http.Handler) http.Handler {
+	return authenticate(lookup, func(r *http.Request) string {
+		if key := apiKeyFromRequest(r); key != "" {
+			return key
+		}
+
+		return r.URL.Query().Get(APIKeyParam)
+	})
+}
+
+// authenticate authenticates requests by the API key the given function
+// finds in a request
+func authenticate(lookup func(key string) (*storage.APIKey, error), find func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := find(r)
+			if key == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				response.WithMessage(w, http.StatusUnauthorized, "API key required")
+				return
+			}
+
+			k, err := lookup(key)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				response.WithMessage(w, http.StatusUnauthorized, "invalid API key")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, k.User)
+			ctx = context.WithValue(ctx, apiKeyKey, k)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests made with an API key which does not
+// grant the given scope. It must be used after APIKey.
+func RequireScope(scope storage.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, ok := r.Context().Value(apiKeyKey).(*storage.APIKey)
+			if !ok || !k.Allows(scope) {
+				response.WithMessage(w, http.StatusForbidden, "API key does not allow this request")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyFromRequest returns the API key given in a request, if any
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
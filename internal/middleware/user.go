@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"reader/internal/api/response"
+	"reader/internal/storage"
+)
+
+const userKey contextKey = "user"
+
+// UserHeader is the request header which an admin can give to make a
+// request as another user
+const UserHeader = "X-User"
+
+// User identifies the user making a request. Requests are made by the user
+// their API key belongs to, or by the given default user when they are not
+// authenticated. Only requests authenticated by a key with admin scope may
+// act as another user given in the UserHeader, as the header would
+// otherwise let anyone act as any user. It must be used after APIKey when
+// requests are authenticated.
+func User(defaultUser uuid.UUID, known func(uuid.UUID) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, ok := r.Context().Value(userKey).(uuid.UUID)
+			if !ok {
+				u = defaultUser
+			}
+
+			if h := r.Header.Get(UserHeader); h != "" {
+				k, ok := r.Context().Value(apiKeyKey).(*storage.APIKey)
+				if !ok || !k.Allows(storage.ScopeAdmin) {
+					response.WithMessage(w, http.StatusForbidden, "only admin API keys can act as another user")
+					return
+				}
+
+				id, err := uuid.Parse(h)
+				if err != nil || !known(id) {
+					response.WithMessage(w, http.StatusUnauthorized, "unknown user")
+					return
+				}
+
+				u = id
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, u)))
+		})
+	}
+}
+
+func UserFromContext(ctx context.Context) (uuid.UUID, error) {
+	u, ok := ctx.Value(userKey).(uuid.UUID)
+	if !ok {
+		return uuid.UUID{}, errors.New("no user found")
+	}
+
+	return u, nil
+}
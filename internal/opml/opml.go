@@ -0,0 +1,169 @@
+package opml
+
+import (
+	"encoding/xml"
+	"io"
+	"reader/internal/feed"
+	"strings"
+	"time"
+)
+
+// OPML is an outline document, the format readers use to exchange
+// their subscriptions.
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+type Head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is either a feed, when it has an XML URL, or a folder
+// holding further outlines.
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Entry is a single feed found in an OPML document
+type Entry struct {
+	FeedLink string
+	Title    string
+	SiteLink string
+
+	// Names of the folders the feed was found in, outermost first
+	Folders []string
+}
+
+// FolderSeparator joins the names of nested folders, as only a single
+// level of folders is kept for feeds
+const FolderSeparator = " / "
+
+// Folder returns the name of the folder the entry is kept in, which is
+// empty when the feed was not in any folder
+func (e Entry) Folder() string {
+	return strings.Join(e.Folders, FolderSeparator)
+}
+
+// Parse decodes an OPML document
+func Parse(r io.Reader) (*OPML, error) {
+	var o OPML
+
+	d := xml.NewDecoder(r)
+
+	// OPML files in the wild commonly declare encodings other than UTF-8,
+	// which are close enough to be read as they are.
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	if err := d.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// Entries returns every feed in the document, in document order,
+// along with the folders it was found in.
+func (o *OPML) Entries() []Entry {
+	return entries(o.Body.Outlines, nil)
+}
+
+func entries(outlines []Outline, folders []string) []Entry {
+	found := []Entry{}
+
+	for _, ol := range outlines {
+		title := ol.Title
+		if title == "" {
+			title = ol.Text
+		}
+
+		if ol.XMLURL != "" {
+			found = append(found, Entry{
+				FeedLink: strings.TrimSpace(ol.XMLURL),
+				Title:    title,
+				SiteLink: ol.HTMLURL,
+				Folders:  folders,
+			})
+			continue
+		}
+
+		// Copy the folders so that sibling folders do not share a backing array
+		nested := append(append([]string{}, folders...), title)
+		found = append(found, entries(ol.Outlines, nested)...)
+	}
+
+	return found
+}
+
+// New creates an OPML document listing the given feeds
+func New(title string, feeds []*feed.Feed) *OPML {
+	o := &OPML{
+		Version: "2.0",
+		Head: Head{
+			Title:       title,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, f := range feeds {
+		o.Body.Outlines = append(o.Body.Outlines, outline(f))
+	}
+
+	return o
+}
+
+// AddFolder adds a folder holding the given feeds to the document
+func (o *OPML) AddFolder(name string, feeds []*feed.Feed) {
+	folder := Outline{
+		Text:  name,
+		Title: name,
+	}
+
+	for _, f := range feeds {
+		folder.Outlines = append(folder.Outlines, outline(f))
+	}
+
+	o.Body.Outlines = append(o.Body.Outlines, folder)
+}
+
+// outline returns the outline of a single feed
+func outline(f *feed.Feed) Outline {
+	title := f.Title
+	if title == "" {
+		title = f.FeedLink.String()
+	}
+
+	return Outline{
+		Text:    title,
+		Title:   title,
+		Type:    "rss",
+		XMLURL:  f.FeedLink.String(),
+		HTMLURL: f.Link,
+	}
+}
+
+// Write encodes the document to the given writer
+func (o *OPML) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+
+	return e.Encode(o)
+}
@@ -0,0 +1,118 @@
+package opml
+
+import (
+	"bytes"
+	"net/url"
+	"reader/internal/feed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const nested = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="1.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Top" type="rss" xmlUrl="https://top.local/rss" htmlUrl="https://top.local"/>
+    <outline text="News">
+      <outline text="World" title="World News" type="rss" xmlUrl=" https://world.local/rss "/>
+      <outline text="Local">
+        <outline text="Town" type="rss" xmlUrl="https://town.local/rss"/>
+      </outline>
+    </outline>
+    <outline text="Tech">
+      <outline text="Go" type="rss" xmlUrl="https://go.local/rss"/>
+    </outline>
+    <outline text="Empty folder"/>
+  </body>
+</opml>`
+
+func TestOPML_Entries(t *testing.T) {
+	o, err := Parse(strings.NewReader(nested))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []Entry{
+		{FeedLink: "https://top.local/rss", Title: "Top", SiteLink: "https://top.local"},
+		{FeedLink: "https://world.local/rss", Title: "World News", Folders: []string{"News"}},
+		{FeedLink: "https://town.local/rss", Title: "Town", Folders: []string{"News", "Local"}},
+		{FeedLink: "https://go.local/rss", Title: "Go", Folders: []string{"Tech"}},
+	}
+
+	if got := o.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() got = %+v, want %+v", got, want)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse(strings.NewReader("not opml")); err == nil {
+		t.Errorf("Parse() of invalid document returned no error")
+	}
+}
+
+func TestOPML_Write(t *testing.T) {
+	feeds := []*feed.Feed{
+		{
+			FeedLink: &url.URL{Scheme: "https", Host: "mock.local", Path: "/rss"},
+			Title:    "Mock & Feed",
+			Link:     "https://mock.local",
+		},
+		{
+			FeedLink: &url.URL{Scheme: "https", Host: "untitled.local"},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := New("Subscriptions", feeds).Write(&b); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// Written documents must be read back as the same feeds
+	o, err := Parse(&b)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []Entry{
+		{FeedLink: "https://mock.local/rss", Title: "Mock & Feed", SiteLink: "https://mock.local"},
+		{FeedLink: "https://untitled.local", Title: "https://untitled.local"},
+	}
+
+	if got := o.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() got = %+v, want %+v", got, want)
+	}
+
+	if o.Head.Title != "Subscriptions" {
+		t.Errorf("Head.Title got = %v, want %v", o.Head.Title, "Subscriptions")
+	}
+}
+
+func TestOPML_AddFolder(t *testing.T) {
+	top := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "top.local"}, Title: "Top"}
+	world := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "world.local"}, Title: "World"}
+
+	o := New("Subscriptions", []*feed.Feed{top})
+	o.AddFolder("News / World", []*feed.Feed{world})
+
+	var b bytes.Buffer
+	if err := o.Write(&b); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	o, err := Parse(&b)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	entries := o.Entries()
+	folders := make([]string, 0, len(entries))
+	for _, e := range entries {
+		folders = append(folders, e.Folder())
+	}
+
+	want := []string{"", "News / World"}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("Folder() got = %v, want %v", folders, want)
+	}
+}
@@ -0,0 +1,329 @@
+package reader
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reader/internal/extract"
+	"reader/internal/feed"
+	"time"
+)
+
+const (
+	// Largest article page read when fetching the full content of an
+	// article
+	maxPageSize = 5 << 20
+
+	// How long an article page is given to respond
+	contentTimeout = 30 * time.Second
+
+	// How long to wait before fetching the content of an article again
+	// when its page could not be fetched or had no content to extract
+	contentRetryAfterError = 1 * time.Hour
+)
+
+// fetchedContent is the content extracted from the page an article links
+// to. When the page could not be fetched it holds no content and the
+// time until which the page should not be fetched again.
+type fetchedContent struct {
+	link    string
+	content string
+	raw     string
+
+	// When the article was last updated as of fetching its page, pages
+	// are fetched again when the article is updated after that
+	updated time.Time
+	fetched time.Time
+
+	retry time.Time
+}
+
+// contentCache holds the content most recently fetched from article
+// links so that each article page is only fetched once. It is guarded
+// by the reader's mutex.
+type contentCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newContentCache(size uint) *contentCache {
+	return &contentCache{
+		size:    int(size),
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the content fetched from the given link, marking it as the
+// most recently used
+func (c *contentCache) get(link string) (*fetchedContent, bool) {
+	e, ok := c.entries[link]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+
+	return e.Value.(*fetchedContent), true
+}
+
+// put adds fetched content to the cache, evicting the least recently
+// used content once the cache is full
+func (c *contentCache) put(fc *fetchedContent) {
+	if e, ok := c.entries[fc.link]; ok {
+		e.Value = fc
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[fc.link] = c.order.PushFront(fc)
+
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*fetchedContent).link)
+	}
+}
+
+// WithMaxContentFetches sets the maximum number of article pages fetched
+// each time a full content feed is read. Articles over the limit keep the
+// content from the feed until the feed is next read.
+func WithMaxContentFetches(max uint) Option {
+	return func(reader *Reader) {
+		reader.maxContentFetches = max
+	}
+}
+
+// WithContentInterval sets the minimum time between the start of two
+// requests for article pages on the same host. It is separate from the
+// limits on reading feeds as article pages are often on other hosts.
+func WithContentInterval(interval time.Duration) Option {
+	return func(reader *Reader) {
+		reader.contentInterval = interval
+	}
+}
+
+// WithContentCacheSize sets the number of articles whose content fetched
+// from their pages is kept in memory.
+func WithContentCacheSize(size uint) Option {
+	return func(reader *Reader) {
+		if size == 0 {
+			reader.contentCacheSize = 1
+			return
+		}
+
+		reader.contentCacheSize = size
+	}
+}
+
+// fullContent fills in the content of the articles of a full content
+// feed from the pages they link to. Content is taken from the cache, or
+// from storage after a restart, so that pages are only fetched for new
+// or updated articles. Articles whose page isn't fetched keep the
+// content from the feed.
+func (r *Reader) fullContent(ctx context.Context, f *feed.Feed, articles []*feed.Article) {
+	if !f.FullContent {
+		return
+	}
+
+	fetches := uint(0)
+	for _, a := range articles {
+		if a.Link == "" {
+			continue
+		}
+
+		fc, ok := r.cachedContent(f, a)
+		if !ok && fetches < r.maxContentFetches && ctx.Err() == nil {
+			fetches++
+			fc, ok = r.fetchContent(ctx, a)
+		}
+
+		if !ok || fc.content == "" {
+			continue
+		}
+
+		a.Content = fc.content
+		a.RawContent = fc.raw
+		a.ContentFetched = fc.fetched
+	}
+}
+
+// cachedContent returns the content already fetched for an article and
+// reports whether its page does not need to be fetched.
+func (r *Reader) cachedContent(f *feed.Feed, a *feed.Article) (*fetchedContent, bool) {
+	r.mu.Lock()
+	if r.contents == nil {
+		r.contents = newContentCache(r.contentCacheSize)
+	}
+
+	fc, ok := r.contents.get(a.Link)
+	r.mu.Unlock()
+
+	if !ok {
+		fc, ok = r.storedContent(f, a)
+		if !ok {
+			return nil, false
+		}
+
+		r.mu.Lock()
+		r.contents.put(fc)
+		r.mu.Unlock()
+	}
+
+	if !fc.retry.IsZero() {
+		return fc, time.Now().Before(fc.retry)
+	}
+
+	return fc, !a.Updated.After(fc.updated)
+}
+
+// storedContent returns the content of an article which was fetched
+// before the reader was restarted, as marked by when it was fetched
+func (r *Reader) storedContent(f *feed.Feed, a *feed.Article) (*fetchedContent, bool) {
+	stored, err := r.s.FeedArticle(f.UUID(), a.UUID())
+	if err != nil || stored.ContentFetched.IsZero() {
+		return nil, false
+	}
+
+	return &fetchedContent{
+		link:    a.Link,
+		content: stored.Content,
+		raw:     stored.RawContent,
+		updated: stored.Updated,
+		fetched: stored.ContentFetched,
+	}, true
+}
+
+// fetchContent fetches the page an article links to and extracts its
+// main content, caching the result. It reports false when the page
+// should be fetched again the next time the feed is read, such as when
+// the page's host asked us to back off.
+func (r *Reader) fetchContent(ctx context.Context, a *feed.Article) (*fetchedContent, bool) {
+	u, err := url.Parse(a.Link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return r.failedContent(a, errors.New("invalid link"))
+	}
+
+	if _, blocked := r.hostBlocked(u.Host); blocked {
+		return nil, false
+	}
+
+	if !r.waitContentHost(ctx, u.Host) {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, contentTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return r.failedContent(a, err)
+	}
+
+	resp, err := r.c.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		return r.failedContent(a, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			d = r.retryAfterError
+		}
+
+		r.blockHost(u.Host, time.Now().Add(d))
+		return nil, false
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return r.failedContent(a, fmt.Errorf("unexpected status: %s", resp.Status))
+	}
+
+	content, err := extract.Extract(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return r.failedContent(a, err)
+	}
+
+	// Relative links are resolved against the page once any redirects
+	// have been followed
+	base := u
+	if resp.Request != nil {
+		base = resp.Request.URL
+	}
+
+	fc := &fetchedContent{
+		link:    a.Link,
+		content: content,
+		updated: a.Updated,
+		fetched: time.Now(),
+	}
+
+	if r.policy != nil {
+		if c := r.policy.Sanitize(content, base); c != content {
+			fc.content = c
+			fc.raw = content
+		}
+	}
+
+	r.mu.Lock()
+	r.contents.put(fc)
+	r.mu.Unlock()
+
+	return fc, true
+}
+
+// failedContent caches that the page of an article could not be fetched
+// so that it isn't fetched again until the retry time has passed
+func (r *Reader) failedContent(a *feed.Article, err error) (*fetchedContent, bool) {
+	log.Printf("could not fetch content of article %s: %v", a.Link, err)
+
+	fc := &fetchedContent{
+		link:  a.Link,
+		retry: time.Now().Add(contentRetryAfterError),
+	}
+
+	r.mu.Lock()
+	r.contents.put(fc)
+	r.mu.Unlock()
+
+	return fc, true
+}
+
+// waitContentHost waits until an article page can be requested from the
+// given host, reserving the next start time so that concurrent requests
+// are still spread out by the content interval. It returns false if the
+// context closed while waiting.
+func (r *Reader) waitContentHost(ctx context.Context, host string) bool {
+	r.mu.Lock()
+	if r.contentHosts == nil {
+		r.contentHosts = map[string]time.Time{}
+	}
+
+	start := time.Now()
+	if next := r.contentHosts[host]; next.After(start) {
+		start = next
+	}
+	r.contentHosts[host] = start.Add(r.contentInterval)
+	r.mu.Unlock()
+
+	t := time.NewTimer(start.Sub(time.Now()))
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,274 @@
+package reader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPage = `<html><head><title>Article</title></head><body>
+<nav><a href="/">Home</a></nav>
+<article>
+<p onclick="track()">The quick brown fox jumps over the lazy dog, again and again, until the dog finally gets up and walks away.</p>
+<p>The quick brown fox jumps over the lazy dog, again and again, until the dog finally gets up and walks away.</p>
+<p>The quick brown fox jumps over the lazy dog, again and again, until the dog <a href="/more">finally</a> gets up and walks away.</p>
+</article>
+</body></html>`
+
+// pages serves article pages and counts the requests for each of them
+type pages struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (p *pages) client() Option {
+	return WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			p.mu.Lock()
+			p.requests[r.URL.Path]++
+			p.mu.Unlock()
+
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(testPage)),
+				Request:    r,
+			}
+
+			switch r.URL.Path {
+			case "/missing":
+				resp.StatusCode = http.StatusNotFound
+			case "/busy":
+				resp.StatusCode = http.StatusTooManyRequests
+				resp.Header.Set("Retry-After", "3600")
+			}
+
+			return resp
+		}),
+	})
+}
+
+func (p *pages) count(path string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.requests[path]
+}
+
+func testFullContentFeed(t *testing.T, s storage.Storage) *feed.Feed {
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "feeds.local"}, FullContent: true}
+
+	if err := s.Store(f, nil); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("error occurred creating mock storage: %v", err)
+	}
+
+	return f
+}
+
+// summaries returns articles as they are in a feed which only publishes
+// a summary of them
+func summaries(links ...string) []*feed.Article {
+	articles := []*feed.Article{}
+	for _, link := range links {
+		articles = append(articles, &feed.Article{Link: link, Description: "Summary"})
+	}
+
+	return articles
+}
+
+func TestReader_fullContent(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	p := &pages{requests: map[string]int{}}
+	r := NewReader(s, p.client(), WithContentInterval(0), WithMaxContentFetches(2))
+
+	articles := summaries("https://news.local/1", "https://news.local/missing", "https://news.local/3")
+	r.fullContent(context.Background(), f, articles)
+
+	a := articles[0]
+	if !strings.Contains(a.Content, `<p>The quick brown fox`) || !strings.Contains(a.Content, `<a href="https://news.local/more">`) {
+		t.Errorf("Content got = %v, want sanitised article", a.Content)
+	}
+
+	if !strings.Contains(a.RawContent, `onclick="track()"`) || strings.Contains(a.Content, "Home") {
+		t.Errorf("RawContent got = %v, want extracted article", a.RawContent)
+	}
+
+	if articles[1].Content != "" || articles[2].Content != "" {
+		t.Errorf("Content got = %v %v, want none", articles[1].Content, articles[2].Content)
+	}
+
+	// Articles over the limit are fetched the next time, whereas fetched
+	// and missing pages are not fetched again
+	articles = summaries("https://news.local/1", "https://news.local/missing", "https://news.local/3")
+	r.fullContent(context.Background(), f, articles)
+
+	if articles[0].Content != a.Content || articles[2].Content == "" {
+		t.Errorf("Content got = %v %v, want cached and fetched content", articles[0].Content, articles[2].Content)
+	}
+
+	for _, path := range []string{"/1", "/missing", "/3"} {
+		if got := p.count(path); got != 1 {
+			t.Errorf("requests for %v got = %v, want 1", path, got)
+		}
+	}
+
+	// Updated articles are fetched again
+	articles = summaries("https://news.local/1")
+	articles[0].Updated = time.Now()
+	r.fullContent(context.Background(), f, articles)
+
+	if got := p.count("/1"); got != 2 {
+		t.Errorf("requests for updated article got = %v, want 2", got)
+	}
+}
+
+func TestReader_fullContent_Stored(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	p := &pages{requests: map[string]int{}}
+
+	articles := summaries("https://news.local/1")
+	NewReader(s, p.client(), WithContentInterval(0)).fullContent(context.Background(), f, articles)
+
+	if err := s.Store(f, articles); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Content fetched before a restart is taken from storage
+	restarted := summaries("https://news.local/1")
+	NewReader(s, p.client(), WithContentInterval(0)).fullContent(context.Background(), f, restarted)
+
+	if restarted[0].Content != articles[0].Content || restarted[0].RawContent != articles[0].RawContent {
+		t.Errorf("Content got = %v, want %v", restarted[0].Content, articles[0].Content)
+	}
+
+	if got := p.count("/1"); got != 1 {
+		t.Errorf("requests got = %v, want 1", got)
+	}
+
+	// Content from the feed is not taken as fetched, even when the feed
+	// has since changed it
+	fromFeed := summaries("https://news.local/2")
+	fromFeed[0].Content = "Content from the feed"
+	if err := s.Store(f, fromFeed); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	restarted = summaries("https://news.local/2")
+	NewReader(s, p.client(), WithContentInterval(0)).fullContent(context.Background(), f, restarted)
+
+	if restarted[0].ContentFetched.IsZero() || p.count("/2") != 1 {
+		t.Errorf("Content got = %v, want content fetched from the page", restarted[0].Content)
+	}
+}
+
+func TestReader_fullContent_Summaries(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	f.FullContent = false
+	p := &pages{requests: map[string]int{}}
+
+	articles := summaries("https://news.local/1")
+	NewReader(s, p.client()).fullContent(context.Background(), f, articles)
+
+	if articles[0].Content != "" || p.count("/1") != 0 {
+		t.Errorf("Content got = %v, want pages of summary feeds not to be fetched", articles[0].Content)
+	}
+}
+
+func TestReader_fullContent_HostLimits(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	p := &pages{requests: map[string]int{}}
+	r := NewReader(s, p.client(), WithContentInterval(100*time.Millisecond))
+
+	start := time.Now()
+	r.fullContent(context.Background(), f, summaries("https://news.local/1", "https://news.local/2", "https://news.local/3"))
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("pages were fetched in %v, want them spread out by the content interval", elapsed)
+	}
+
+	// Hosts which ask us to back off are not sent any more requests and
+	// their pages are fetched once they are ready again
+	articles := summaries("https://busy.local/busy", "https://busy.local/busy")
+	r.fullContent(context.Background(), f, articles)
+
+	if got := p.count("/busy"); got != 1 {
+		t.Errorf("requests to busy host got = %v, want 1", got)
+	}
+
+	if _, blocked := r.hostBlocked("busy.local"); !blocked {
+		t.Errorf("busy host was not blocked")
+	}
+
+	r.mu.Lock()
+	_, cached := r.contents.get("https://busy.local/busy")
+	r.mu.Unlock()
+
+	if cached {
+		t.Errorf("page of busy host was cached")
+	}
+}
+
+func TestReader_Update_FullContent(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>News</title>
+ <link>https://news.local</link>
+ <item>
+   <title>Article</title>
+   <link>https://news.local/1</link>
+   <description>Summary</description>
+ </item>
+</channel>
+</rss>
+`
+
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			body := testPage
+			if r.URL.Host == "feeds.local" {
+				body = xml
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+				Request:    r,
+			}
+		}),
+	})
+
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	r := NewReader(s, c, WithContentInterval(0))
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+
+	r.Update(ctx, []*feed.Feed{f})
+	<-time.After(100 * time.Millisecond)
+
+	a, err := s.Article(storage.DefaultUser, (&feed.Article{Link: "https://news.local/1"}).UUID())
+	if err != nil {
+		t.Fatalf("Article() error = %v", err)
+	}
+
+	if a.Description != "Summary" || !strings.Contains(a.Content, "The quick brown fox") {
+		t.Errorf("article got = %v %v, want summary and full content", a.Description, a.Content)
+	}
+}
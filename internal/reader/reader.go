@@ -1,20 +1,32 @@
 package reader
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/mmcdole/gofeed"
 	"github.com/pquerna/cachecontrol/cacheobject"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"reader/internal/feed"
+	"reader/internal/sanitize"
 	"reader/internal/storage"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	ErrNotModified = errors.New("304 not modified")
+	ErrNotModified      = errors.New("304 not modified")
+	ErrFeedNotScheduled = errors.New("feed not scheduled")
+	ErrFeedGone         = errors.New("410 gone")
 )
 
 type Reader struct {
@@ -26,20 +38,137 @@ type Reader struct {
 	retry            time.Duration
 	retryNotModified time.Duration
 	retryAfterError  time.Duration
+	maxBackoff       time.Duration
+
+	mu    sync.Mutex
+	feeds map[uuid.UUID]*scheduledFeed
+	run   *run
+
+	// Time until which each host should not be sent any requests
+	// because it asked us to back off.
+	hosts map[string]time.Time
+
+	// Limits on how often and how many concurrent requests are sent
+	// to each host so we are polite to publishers hosting many feeds.
+	maxHostRequests uint
+	minHostInterval time.Duration
+	hostLimits      map[string]*hostLimit
+
+	// URL hubs call back to, WebSub is not used when it is nil. Feeds
+	// subscribed to a hub are kept in subs, guarded by the mutex.
+	callback *url.URL
+	subs     map[uuid.UUID]*subscription
+
+	// Policy descriptions and content are sanitised with, they are kept
+	// as published when it is nil
+	policy *sanitize.Policy
+
+	// Limits on fetching the pages of articles in full content feeds and
+	// the content already fetched from them, see content.go. The cache
+	// and the time each host may next be sent a request are guarded by
+	// the mutex.
+	maxContentFetches uint
+	contentInterval   time.Duration
+	contentCacheSize  uint
+	contents          *contentCache
+	contentHosts      map[string]time.Time
 }
 
-type queuedFeed struct {
-	f *feed.Feed
-	d time.Duration
+// hostLimit tracks the requests currently being sent to a host.
+// A slot must be taken from slots before a request is sent and next
+// holds the earliest time the next request may be sent.
+type hostLimit struct {
+	slots chan struct{}
+	next  time.Time
 }
 
-func newQueuedFeed(f *feed.Feed, d time.Duration) queuedFeed {
-	return queuedFeed{f: f, d: d}
+// scheduledFeed is a feed which is known to the reader. Its done
+// channel is closed once the feed is removed so that any goroutines
+// waiting on the feed can clean up.
+type scheduledFeed struct {
+	f    *feed.Feed
+	done chan struct{}
+
+	// wake is signalled whenever the feed is paused, resumed or
+	// refreshed so that a waiting goroutine can re-evaluate the state.
+	// Paused and refresh are guarded by the reader's mutex.
+	wake    chan struct{}
+	paused  bool
+	refresh bool
+
+	// Number of consecutive failed reads, used for exponential backoff.
+	// Only accessed by the worker reading the feed.
+	failures uint
+
+	// Host the feed holds a request slot for while it is being read
+	host string
+}
+
+func newScheduledFeed(f *feed.Feed) *scheduledFeed {
+	return &scheduledFeed{
+		f:    f,
+		done: make(chan struct{}),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// feedOf returns the feed of a scheduled feed. The feed is replaced
+// under the mutex whenever it is read, so must not be read without it.
+func (r *Reader) feedOf(sf *scheduledFeed) *feed.Feed {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sf.f
+}
+
+// signal wakes up the goroutine waiting on the feed without blocking
+func (sf *scheduledFeed) signal() {
+	select {
+	case sf.wake <- struct{}{}:
+	default:
+	}
+}
+
+// removed reports whether the feed has been removed from the reader
+func (sf *scheduledFeed) removed() bool {
+	select {
+	case <-sf.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run holds the state of a running Update so that feeds can be
+// added to the reader while it is running.
+type run struct {
+	ctx     context.Context
+	wg      sync.WaitGroup
+	work    chan *scheduledFeed
+	errs    chan error
+	stopped bool
 }
 
 type cachedParsedFeed struct {
 	f *gofeed.Feed
 	d time.Duration
+
+	// Validators returned by the feed server which are sent back
+	// on the next request so that the server can return a 304.
+	etag         string
+	lastModified string
+
+	// Set when the server responded with 429 or 503 along with
+	// how long the server asked us to wait through Retry-After.
+	throttled  bool
+	retryAfter time.Duration
+
+	// WebSub hub advertised by the feed and the topic to subscribe to
+	hub   string
+	topic string
+
+	// Set when the feed link permanently redirected to a new feed link
+	moved *url.URL
 }
 
 type Option func(*Reader)
@@ -79,6 +208,44 @@ func WithRetryAfterErrorDuration(retry time.Duration) Option {
 	}
 }
 
+// WithMaxBackoffDuration sets the maximum time to wait before reading
+// a feed which keeps failing. The wait starts at the retry after error
+// duration and doubles after every consecutive failure.
+func WithMaxBackoffDuration(max time.Duration) Option {
+	return func(reader *Reader) {
+		reader.maxBackoff = max
+	}
+}
+
+// WithMaxHostRequests sets the maximum number of concurrent
+// requests sent to any one host.
+func WithMaxHostRequests(max uint) Option {
+	return func(reader *Reader) {
+		if max <= 0 {
+			reader.maxHostRequests = 1
+			return
+		}
+
+		reader.maxHostRequests = max
+	}
+}
+
+// WithMinHostInterval sets the minimum time between the start of
+// two requests sent to the same host.
+func WithMinHostInterval(interval time.Duration) Option {
+	return func(reader *Reader) {
+		reader.minHostInterval = interval
+	}
+}
+
+// WithPolicy sets the policy article descriptions and content are
+// sanitised with. A nil policy keeps them as they were published.
+func WithPolicy(policy *sanitize.Policy) Option {
+	return func(reader *Reader) {
+		reader.policy = policy
+	}
+}
+
 // NewReader will instantiate a reader with default options
 // which can be overridden by a select number of option functions.
 func NewReader(s storage.Storage, options ...Option) *Reader {
@@ -93,6 +260,13 @@ func NewReader(s storage.Storage, options ...Option) *Reader {
 		WithRetryDuration(60 * time.Second),
 		WithRetryNotModifiedDuration(120 * time.Second),
 		WithRetryAfterErrorDuration(300 * time.Second),
+		WithMaxBackoffDuration(6 * time.Hour),
+		WithMaxHostRequests(2),
+		WithMinHostInterval(1 * time.Second),
+		WithPolicy(sanitize.DefaultPolicy()),
+		WithMaxContentFetches(10),
+		WithContentInterval(2 * time.Second),
+		WithContentCacheSize(1000),
 	}
 
 	for _, opt := range append(defaultOptions, options...) {
@@ -108,83 +282,522 @@ func NewReader(s storage.Storage, options ...Option) *Reader {
 // also utilises a worker pool pattern to ensure we do not
 // make too many concurrent requests.
 // An error channel is provided so that we can keep track
-// of any errors that occur when processing feeds.
+// of any errors that occur when processing feeds. The channel
+// is closed once the given context is closed and all workers
+// have stopped.
+// Feeds can be added and removed with Add and Remove while
+// Update is running.
 func (r *Reader) Update(ctx context.Context, feeds []*feed.Feed) <-chan error {
-	errChan := make(chan error)
-	queuedChan := make(chan queuedFeed, len(feeds))
-	feedChan := make(chan *feed.Feed)
+	rn := &run{
+		ctx:  ctx,
+		work: make(chan *scheduledFeed),
+		errs: make(chan error),
+	}
+
+	r.mu.Lock()
+	r.run = rn
+
+	// Spawn n number of workers to allow for concurrent processing
+	// of given feeds. Once a feed is processed, it is then queued
+	// again with an appropriate delay.
+	for i := uint(0); i < r.workers; i++ {
+		rn.wg.Add(1)
+		go r.work(rn)
+	}
+
+	// Queue any feeds which were added before Update was called
+	for _, sf := range r.feeds {
+		r.queue(rn, sf, sf.f.ModifiedAt.Add(r.retry))
+	}
+	r.mu.Unlock()
 
-	// Queue initial feeds into queued feed channel with default retry timeout
 	for _, f := range feeds {
-		queuedChan <- newQueuedFeed(f, r.retry)
+		r.Add(f)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		// Stop any further feeds being queued before waiting for
+		// all goroutines to finish so the error channel can be closed.
+		r.mu.Lock()
+		rn.stopped = true
+		r.mu.Unlock()
+
+		rn.wg.Wait()
+		close(rn.errs)
+	}()
+
+	return rn.errs
+}
+
+// Add will schedule the given feed to be read. If Update is running
+// the feed is queued straight away, otherwise it will be queued once
+// Update is called. Adding a feed which is already scheduled or which
+// is inactive does nothing.
+func (r *Reader) Add(f *feed.Feed) {
+	if f.Inactive {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.feeds == nil {
+		r.feeds = map[uuid.UUID]*scheduledFeed{}
+	}
+
+	if _, ok := r.feeds[f.UUID()]; ok {
+		return
+	}
+
+	sf := newScheduledFeed(f)
+	r.feeds[f.UUID()] = sf
+
+	if r.run != nil && !r.run.stopped {
+		r.queue(r.run, sf, f.ModifiedAt.Add(r.retry))
+	}
+}
+
+// Remove will stop the feed with the given UUID from being read.
+// Any pending delay for the feed is cancelled and a feed which is
+// currently being read will not be stored.
+func (r *Reader) Remove(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sf, ok := r.feeds[id]
+	if !ok {
+		return
+	}
+
+	close(sf.done)
+	delete(r.feeds, id)
+
+	// Hubs are asked to stop pushing content for the feed
+	if sub, ok := r.subs[id]; ok {
+		if sub.active(time.Now()) {
+			sub.pending = modeUnsubscribe
+			go r.unsubscribeHub(id, sub)
+		} else {
+			delete(r.subs, id)
+		}
 	}
+}
+
+// Pause will stop the feed with the given UUID from being read until
+// it is resumed. The feed stays scheduled and can still be refreshed.
+func (r *Reader) Pause(id uuid.UUID) error {
+	return r.update(id, func(sf *scheduledFeed) {
+		sf.paused = true
+	})
+}
+
+// Resume will continue reading a paused feed. If the feed was due to
+// be read while it was paused it will be read straight away.
+func (r *Reader) Resume(id uuid.UUID) error {
+	return r.update(id, func(sf *scheduledFeed) {
+		sf.paused = false
+	})
+}
+
+// Refresh will read the feed with the given UUID as soon as a worker is
+// available rather than waiting for its delay to pass. A paused feed is
+// read once and then stays paused.
+func (r *Reader) Refresh(id uuid.UUID) error {
+	return r.update(id, func(sf *scheduledFeed) {
+		sf.refresh = true
+	})
+}
+
+// update applies the given change to a scheduled feed and wakes up
+// any goroutine waiting on it.
+func (r *Reader) update(id uuid.UUID, fn func(sf *scheduledFeed)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sf, ok := r.feeds[id]
+	if !ok {
+		return ErrFeedNotScheduled
+	}
+
+	fn(sf)
+	sf.signal()
+
+	return nil
+}
+
+// ready reports whether a waiting feed should now be handed to a
+// worker given whether its delay has passed.
+func (r *Reader) ready(sf *scheduledFeed, due bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sf.refresh {
+		sf.refresh = false
+		return true
+	}
+
+	return due && !sf.paused
+}
+
+// queue waits until the given time before handing the feed to a
+// worker. Goroutines are cheap so we can use one per feed to wait
+// for the given delay.
+func (r *Reader) queue(rn *run, sf *scheduledFeed, at time.Time) {
+	rn.wg.Add(1)
 
 	go func() {
-		defer close(queuedChan)
-		defer close(feedChan)
-		defer close(errChan)
-
-		// Goroutines are cheap so we can use them to wait for a given
-		// request timeout before we pass the feed to the main processing
-		// queue.
-		for qf := range queuedChan {
+		defer rn.wg.Done()
+
+		duration := at.Sub(time.Now())
+		log.Printf("queuing feed %s in %s", r.feedOf(sf).UUID(), duration)
+
+		t := time.NewTimer(duration)
+		defer t.Stop()
+
+		// Wait until the delay has passed and the feed is not paused,
+		// or until the feed is explicitly refreshed.
+		due := false
+		for !r.ready(sf, due) {
 			select {
-			case <-ctx.Done():
+			case <-rn.ctx.Done():
+				return
+			case <-sf.done:
 				return
-			default:
+			case <-t.C:
+				due = true
+			case <-sf.wake:
 			}
+		}
 
-			go func(qf queuedFeed) {
-				duration := qf.f.ModifiedAt.Add(qf.d).Sub(time.Now())
-				log.Printf("queuing feed %s in %s", qf.f.UUID(), duration)
+		if !r.acquireHost(rn, sf) {
+			return
+		}
 
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(duration):
-				}
+		select {
+		case <-rn.ctx.Done():
+			r.releaseHost(sf)
+		case <-sf.done:
+			r.releaseHost(sf)
+		case rn.work <- sf:
+		}
+	}()
+}
+
+// acquireHost waits until a request can be sent to the feed's host,
+// taking one of the host's request slots and respecting the minimum
+// interval between requests. It returns false if the feed was removed
+// or the context closed while waiting, in which case no slot is held.
+func (r *Reader) acquireHost(rn *run, sf *scheduledFeed) bool {
+	host := r.feedOf(sf).FeedLink.Host
+
+	r.mu.Lock()
+	if r.hostLimits == nil {
+		r.hostLimits = map[string]*hostLimit{}
+	}
+
+	h, ok := r.hostLimits[host]
+	if !ok {
+		h = &hostLimit{slots: make(chan struct{}, r.maxHostRequests)}
+		r.hostLimits[host] = h
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-rn.ctx.Done():
+		return false
+	case <-sf.done:
+		return false
+	case h.slots <- struct{}{}:
+	}
+
+	sf.host = host
 
-				feedChan <- qf.f
-			}(qf)
+	// Reserve the next start time for this host so that concurrent
+	// requests are still spread out by the minimum interval.
+	r.mu.Lock()
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(r.minHostInterval)
+	r.mu.Unlock()
+
+	t := time.NewTimer(start.Sub(time.Now()))
+	defer t.Stop()
+
+	select {
+	case <-rn.ctx.Done():
+		r.releaseHost(sf)
+		return false
+	case <-sf.done:
+		r.releaseHost(sf)
+		return false
+	case <-t.C:
+	}
+
+	return true
+}
+
+// releaseHost gives back the request slot held by the feed
+func (r *Reader) releaseHost(sf *scheduledFeed) {
+	r.mu.Lock()
+	h := r.hostLimits[sf.host]
+	r.mu.Unlock()
+
+	<-h.slots
+}
+
+// work processes feeds handed to it until the context is closed
+func (r *Reader) work(rn *run) {
+	defer rn.wg.Done()
+
+	for {
+		var sf *scheduledFeed
+
+		// if our context is closed, don't process anymore feeds
+		select {
+		case <-rn.ctx.Done():
+			return
+		case sf = <-rn.work:
+		}
+
+		// If the feed's host asked us to back off, wait until it is
+		// ready again rather than sending another request.
+		if until, ok := r.hostBlocked(r.feedOf(sf).FeedLink.Host); ok {
+			r.releaseHost(sf)
+			r.mu.Lock()
+			if !rn.stopped && !sf.removed() {
+				r.queue(rn, sf, until)
+			}
+			r.mu.Unlock()
+			continue
+		}
+
+		d, err := r.process(rn.ctx, sf)
+		r.releaseHost(sf)
+
+		// Feeds removed while being processed are not queued again, but
+		// their errors are still sent, such as the feed being gone
+		if !sf.removed() {
+			d = r.pollDelay(r.feedOf(sf).UUID(), d)
+
+			r.mu.Lock()
+			if !rn.stopped {
+				r.queue(rn, sf, time.Now().Add(d))
+			}
+			r.mu.Unlock()
+		}
+
+		if err != nil {
+			select {
+			case <-rn.ctx.Done():
+				return
+			case rn.errs <- err:
+			}
 		}
+	}
+}
+
+// process reads and stores a single feed, returning the delay
+// before the feed should be read again.
+func (r *Reader) process(ctx context.Context, sf *scheduledFeed) (time.Duration, error) {
+	// Changes are made to a copy of the feed as it is also read when a
+	// hub pushes its content
+	r.mu.Lock()
+	f := *sf.f
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		sf.f = &f
+		r.mu.Unlock()
 	}()
 
-	// Spawn n number of workers to allow for concurrent processing
-	// of given feeds. Once a feed is processed, it is then pushed
-	// to the queued feed with an appropriate delay.
-	for i := uint(0); i < r.workers; i++ {
-		go func() {
-			for f := range feedChan {
-
-				// if our context is closed, don't process anymore feeds
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
+	cf, err := r.getFeedContent(ctx, &f)
+	f.ModifiedAt = time.Now()
 
-				cf, err := r.getFeedContent(ctx, f)
-				f.ModifiedAt = time.Now()
-				if err != nil {
-					queuedChan <- newQueuedFeed(f, cf.d)
-					errChan <- err
-					continue
-				}
+	var herr gofeed.HTTPError
+	if errors.As(err, &herr) && herr.StatusCode == http.StatusGone {
+		return cf.d, r.gone(sf, &f)
+	}
 
-				f, articles := r.mapParsedFeedToFeedAndArticles(cf.f, f)
+	// Feeds which have permanently moved keep their UUID so that their
+	// articles and subscriptions stay with them
+	moved := cf.moved != nil && cf.moved.String() != f.FeedLink.String()
+	if moved {
+		f.ID = f.UUID()
+		f.FeedLink = cf.moved
+	}
 
-				if err := r.s.Store(f, articles); err != nil {
-					queuedChan <- newQueuedFeed(f, cf.d)
-					errChan <- err
-					continue
-				}
+	if err == ErrNotModified {
+		sf.failures = 0
 
-				queuedChan <- newQueuedFeed(f, cf.d)
+		if moved && !sf.removed() {
+			if err := r.s.Store(&f, nil); err != nil {
+				return cf.d, err
 			}
-		}()
+		}
+
+		return cf.d, err
 	}
 
-	return errChan
+	if err != nil {
+		return r.backoff(sf, cf), err
+	}
+
+	sf.failures = 0
+
+	_, articles := r.mapParsedFeedToFeedAndArticles(cf.f, &f)
+	r.fullContent(ctx, &f, articles)
+	f.ETag = cf.etag
+	f.LastModified = cf.lastModified
+
+	// Don't store a feed which was removed whilst we were reading it
+	if sf.removed() {
+		return cf.d, nil
+	}
+
+	if err := r.s.Store(&f, articles); err != nil {
+		return cf.d, err
+	}
+
+	if err := r.subscribeHub(ctx, &f, cf.hub, cf.topic); err != nil {
+		return cf.d, err
+	}
+
+	return cf.d, nil
+}
+
+// gone marks a feed which the server says is gone as inactive and
+// stops reading it.
+func (r *Reader) gone(sf *scheduledFeed, f *feed.Feed) error {
+	if sf.removed() {
+		return nil
+	}
+
+	f.Inactive = true
+	if err := r.s.Store(f, nil); err != nil {
+		return err
+	}
+
+	r.Remove(f.UUID())
+
+	return fmt.Errorf("feed %v is no longer read: %w", f.FeedLink, ErrFeedGone)
+}
+
+// backoff works out how long to wait before reading a failed feed
+// again. The wait doubles with every consecutive failure up to the
+// maximum backoff and is jittered so that feeds which failed together
+// are not retried together. A longer Retry-After from the server is
+// always respected, and if the server is throttling us every feed on
+// the same host is made to wait.
+func (r *Reader) backoff(sf *scheduledFeed, cf cachedParsedFeed) time.Duration {
+	sf.failures++
+
+	d := r.retryAfterError
+	for i := uint(1); i < sf.failures && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+
+	d = jitter(d)
+
+	if cf.retryAfter > d {
+		d = cf.retryAfter
+	}
+
+	if cf.throttled {
+		r.blockHost(r.feedOf(sf).FeedLink.Host, time.Now().Add(d))
+	}
+
+	return d
+}
+
+// jitter returns a random duration between half of and the whole
+// given duration.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// blockHost stops any requests being sent to the given host until
+// the given time.
+func (r *Reader) blockHost(host string, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hosts == nil {
+		r.hosts = map[string]time.Time{}
+	}
+
+	if until.After(r.hosts[host]) {
+		r.hosts[host] = until
+	}
+}
+
+// hostBlocked reports whether the given host asked us to back off
+// and, if so, until when.
+func (r *Reader) hostBlocked(host string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.hosts[host]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if !until.After(time.Now()) {
+		delete(r.hosts, host)
+		return time.Time{}, false
+	}
+
+	return until, true
+}
+
+// parseRetryAfter parses a Retry-After header which can either be
+// a number of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+
+	return 0, true
+}
+
+// parse parses a feed with a parser of its own, as parsers keep state
+// while parsing and cannot be shared between workers
+func (r *Reader) parse(body []byte) (*gofeed.Feed, error) {
+	p := gofeed.NewParser()
+	p.AtomTranslator = r.p.AtomTranslator
+	p.RSSTranslator = r.p.RSSTranslator
+	p.JSONTranslator = r.p.JSONTranslator
+
+	return p.Parse(bytes.NewReader(body))
 }
 
 func (r *Reader) mapParsedFeedToFeedAndArticles(pf *gofeed.Feed, f *feed.Feed) (*feed.Feed, []*feed.Article) {
@@ -194,7 +807,15 @@ func (r *Reader) mapParsedFeedToFeedAndArticles(pf *gofeed.Feed, f *feed.Feed) (
 	articles := make([]*feed.Article, 0, len(pf.Items))
 
 	for _, a := range pf.Items {
-		published := time.Time{}
+		updated := time.Time{}
+		if a.UpdatedParsed != nil {
+			updated = *a.UpdatedParsed
+		}
+
+		// Articles which were never published are taken to have been
+		// published when they were last updated. Storage fills in the
+		// time for articles without either.
+		published := updated
 		if a.PublishedParsed != nil {
 			published = *a.PublishedParsed
 		}
@@ -202,9 +823,14 @@ func (r *Reader) mapParsedFeedToFeedAndArticles(pf *gofeed.Feed, f *feed.Feed) (
 		article := &feed.Article{
 			GUID:        a.GUID,
 			Published:   published,
+			Updated:     updated,
 			Title:       a.Title,
 			Description: a.Description,
 			Link:        a.Link,
+			Content:     a.Content,
+			Authors:     authors(a),
+			Categories:  a.Categories,
+			Enclosures:  enclosures(a, pf.FeedType),
 		}
 
 		// If an image was parsed from the article, add it here
@@ -231,12 +857,190 @@ func (r *Reader) mapParsedFeedToFeedAndArticles(pf *gofeed.Feed, f *feed.Feed) (
 			}
 		}
 
+		r.sanitize(article, f)
+
 		articles = append(articles, article)
 	}
 
 	return f, articles
 }
 
+// sanitize cleans the description and content of an article, keeping
+// the variants as published when sanitising removed anything from them.
+// Relative URLs are resolved against the article link, or otherwise the
+// feed's.
+func (r *Reader) sanitize(a *feed.Article, f *feed.Feed) {
+	if r.policy == nil {
+		return
+	}
+
+	base := f.FeedLink
+	if f.Link != "" {
+		if u, err := f.FeedLink.Parse(f.Link); err == nil {
+			base = u
+		}
+	}
+
+	if a.Link != "" {
+		if u, err := base.Parse(a.Link); err == nil {
+			base = u
+		}
+	}
+
+	// Only keep the raw HTML when sanitising removed something from it,
+	// rather than only escaping its text or resolving its links
+	d, removed := r.policy.SanitizeRemoved(a.Description, base)
+	if removed {
+		a.RawDescription = a.Description
+	}
+	a.Description = d
+
+	c, removed := r.policy.SanitizeRemoved(a.Content, base)
+	if removed {
+		a.RawContent = a.Content
+	}
+	a.Content = c
+}
+
+// authors returns the authors of an item. Only the first author is
+// parsed, so any other Dublin Core creators are added after it.
+func authors(item *gofeed.Item) []*feed.Person {
+	var people []*feed.Person
+	seen := map[string]bool{}
+
+	add := func(name string, email string) {
+		if (name == "" && email == "") || seen[name+email] {
+			return
+		}
+
+		seen[name+email] = true
+		people = append(people, &feed.Person{Name: name, Email: email})
+	}
+
+	if item.Author != nil {
+		add(item.Author.Name, item.Author.Email)
+	}
+
+	if item.DublinCoreExt != nil {
+		for _, creator := range item.DublinCoreExt.Creator {
+			if item.Author == nil || creator != item.Author.Name {
+				add(creator, "")
+			}
+		}
+	}
+
+	return people
+}
+
+// enclosures returns the files attached to an item, from enclosures
+// as well as from media:content. The iTunes duration of an item is the
+// duration of its enclosure.
+func enclosures(item *gofeed.Item, feedType string) []*feed.Enclosure {
+	var files []*feed.Enclosure
+	byURL := map[string]*feed.Enclosure{}
+
+	add := func(e *feed.Enclosure) {
+		if e.URL == "" {
+			return
+		}
+
+		// The same file is often given as both an enclosure and as
+		// media:content, each with some of its details
+		if existing, ok := byURL[e.URL]; ok {
+			if existing.Type == "" {
+				existing.Type = e.Type
+			}
+
+			if existing.Length == 0 {
+				existing.Length = e.Length
+			}
+
+			if existing.Duration == 0 {
+				existing.Duration = e.Duration
+			}
+
+			return
+		}
+
+		byURL[e.URL] = e
+		files = append(files, e)
+	}
+
+	var duration uint
+	if item.ITunesExt != nil {
+		duration = parseDuration(item.ITunesExt.Duration)
+	}
+
+	for _, e := range item.Enclosures {
+		enc := &feed.Enclosure{
+			URL:      e.URL,
+			Type:     e.Type,
+			Length:   parseLength(e.Length),
+			Duration: duration,
+		}
+
+		// The length of JSON Feed attachments is parsed from their
+		// duration rather than their size
+		if feedType == "json" {
+			enc.Duration = uint(enc.Length)
+			enc.Length = 0
+		}
+
+		add(enc)
+	}
+
+	media := item.Extensions["media"]
+
+	contents := media["content"]
+	for _, g := range media["group"] {
+		contents = append(contents, g.Children["content"]...)
+	}
+
+	for _, c := range contents {
+		add(&feed.Enclosure{
+			URL:      c.Attrs["url"],
+			Type:     c.Attrs["type"],
+			Length:   parseLength(c.Attrs["fileSize"]),
+			Duration: parseDuration(c.Attrs["duration"]),
+		})
+	}
+
+	return files
+}
+
+// parseLength parses the length of a file in bytes, returning 0 when
+// the length is not known
+func parseLength(s string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+
+	return length
+}
+
+// parseDuration parses a duration in seconds which is given either as a
+// number of seconds or as hours, minutes and seconds such as 1:02:03.
+// Returns 0 when the duration can't be parsed.
+func parseDuration(s string) uint {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+
+	var seconds float64
+	for _, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || !(n >= 0) || math.IsInf(n, 0) {
+			return 0
+		}
+
+		seconds = seconds*60 + n
+	}
+
+	return uint(seconds)
+}
+
 // getFeedContent will try to get content of given feed
 // and pass back a cached feed with a retry timeout
 // which is hopefully controlled by the feed server's
@@ -251,8 +1055,16 @@ func (r *Reader) getFeedContent(ctx context.Context, f *feed.Feed) (feed cachedP
 		return feed, err
 	}
 
-	// Send If-Modified-Since to allow for server to return 304 if needed
-	req.Header.Set("If-Modified-Since", f.ModifiedAt.Format(time.RFC1123))
+	// Send back the validators the server gave us last time to allow
+	// for the server to return 304 if needed. We use the server's own
+	// values as servers and CDNs often compare them verbatim.
+	if f.ETag != "" {
+		req.Header.Set("If-None-Match", f.ETag)
+	}
+
+	if f.LastModified != "" {
+		req.Header.Set("If-Modified-Since", f.LastModified)
+	}
 
 	resp, err := r.c.Do(req)
 	if err != nil {
@@ -283,6 +1095,7 @@ func (r *Reader) getFeedContent(ctx context.Context, f *feed.Feed) (feed cachedP
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		if resp.StatusCode == http.StatusNotModified {
+			feed.moved = permanentRedirect(resp)
 
 			// If timeout for 304 is greater than given max-age, respect
 			// that value instead.
@@ -293,14 +1106,66 @@ func (r *Reader) getFeedContent(ctx context.Context, f *feed.Feed) (feed cachedP
 			return feed, ErrNotModified
 		}
 
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			feed.throttled = true
+			feed.retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+
 		return feed, gofeed.HTTPError{
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
 		}
 	}
 
-	pf, err := r.p.Parse(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	feed.moved = permanentRedirect(resp)
+
+	pf, err := r.parse(body)
 	feed.f = pf
+	feed.etag = resp.Header.Get("ETag")
+	feed.lastModified = resp.Header.Get("Last-Modified")
+
+	if err == nil && r.callback != nil {
+		feed.hub, feed.topic = discoverHub(resp.Header, body, pf, f)
+	}
 
 	return
 }
+
+// permanentRedirect returns where the feed link has permanently moved
+// to. Only the redirects which were all permanent from the feed link
+// onwards are followed, as a temporary redirect could later change.
+func permanentRedirect(resp *http.Response) *url.URL {
+	// Each request made while following redirects holds the response
+	// which redirected to it
+	reqs := []*http.Request{}
+	for req := resp.Request; req != nil; {
+		reqs = append([]*http.Request{req}, reqs...)
+
+		if req.Response == nil {
+			break
+		}
+
+		req = req.Response.Request
+	}
+
+	if len(reqs) < 2 {
+		return nil
+	}
+
+	var moved *url.URL
+	for _, req := range reqs[1:] {
+		code := req.Response.StatusCode
+		if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			break
+		}
+
+		moved = req.URL
+	}
+
+	return moved
+}
@@ -2,14 +2,18 @@ package reader
 
 import (
 	"context"
+	"errors"
 	"github.com/mmcdole/gofeed"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reader/internal/feed"
+	"reader/internal/sanitize"
 	"reader/internal/storage"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -31,13 +35,20 @@ func TestNewReader(t *testing.T) {
 				nil,
 			},
 			&Reader{
-				s:                storage.NewInMemoryStorage(1),
-				p:                gofeed.NewParser(),
-				c:                &http.Client{},
-				workers:          8,
-				retry:            60 * time.Second,
-				retryNotModified: 120 * time.Second,
-				retryAfterError:  300 * time.Second,
+				s:                 storage.NewInMemoryStorage(1),
+				p:                 gofeed.NewParser(),
+				c:                 &http.Client{},
+				workers:           8,
+				retry:             60 * time.Second,
+				retryNotModified:  120 * time.Second,
+				retryAfterError:   300 * time.Second,
+				maxBackoff:        6 * time.Hour,
+				maxHostRequests:   2,
+				minHostInterval:   1 * time.Second,
+				policy:            sanitize.DefaultPolicy(),
+				maxContentFetches: 10,
+				contentInterval:   2 * time.Second,
+				contentCacheSize:  1000,
 			},
 		},
 		{
@@ -49,16 +60,29 @@ func TestNewReader(t *testing.T) {
 					WithRetryDuration(40 * time.Second),
 					WithRetryNotModifiedDuration(80 * time.Second),
 					WithRetryAfterErrorDuration(120 * time.Second),
+					WithMaxBackoffDuration(1 * time.Hour),
+					WithMaxHostRequests(4),
+					WithMinHostInterval(500 * time.Millisecond),
+					WithPolicy(nil),
+					WithMaxContentFetches(5),
+					WithContentInterval(5 * time.Second),
+					WithContentCacheSize(0),
 				},
 			},
 			&Reader{
-				s:                storage.NewInMemoryStorage(3),
-				p:                gofeed.NewParser(),
-				c:                &http.Client{},
-				workers:          10,
-				retry:            40 * time.Second,
-				retryNotModified: 80 * time.Second,
-				retryAfterError:  120 * time.Second,
+				s:                 storage.NewInMemoryStorage(3),
+				p:                 gofeed.NewParser(),
+				c:                 &http.Client{},
+				workers:           10,
+				retry:             40 * time.Second,
+				retryNotModified:  80 * time.Second,
+				retryAfterError:   120 * time.Second,
+				maxBackoff:        1 * time.Hour,
+				maxHostRequests:   4,
+				minHostInterval:   500 * time.Millisecond,
+				maxContentFetches: 5,
+				contentInterval:   5 * time.Second,
+				contentCacheSize:  1,
 			},
 		},
 		{
@@ -70,13 +94,20 @@ func TestNewReader(t *testing.T) {
 				},
 			},
 			&Reader{
-				s:                storage.NewInMemoryStorage(1),
-				p:                gofeed.NewParser(),
-				c:                &http.Client{},
-				workers:          1,
-				retry:            60 * time.Second,
-				retryNotModified: 120 * time.Second,
-				retryAfterError:  300 * time.Second,
+				s:                 storage.NewInMemoryStorage(1),
+				p:                 gofeed.NewParser(),
+				c:                 &http.Client{},
+				workers:           1,
+				retry:             60 * time.Second,
+				retryNotModified:  120 * time.Second,
+				retryAfterError:   300 * time.Second,
+				maxBackoff:        6 * time.Hour,
+				maxHostRequests:   2,
+				minHostInterval:   1 * time.Second,
+				policy:            sanitize.DefaultPolicy(),
+				maxContentFetches: 10,
+				contentInterval:   2 * time.Second,
+				contentCacheSize:  1000,
 			},
 		},
 	}
@@ -182,6 +213,208 @@ func TestReader_getFeedContent(t *testing.T) {
 			60 * time.Second,
 			false,
 		},
+		{
+			"article details",
+			fields{
+				nil,
+				nil,
+			},
+			args{
+				context.Background(),
+				&feed.Feed{
+					FeedLink: &url.URL{
+						Scheme: "http",
+						Host:   "rss.local",
+					},
+				},
+			},
+			nil,
+			`<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+ <title>W3Schools Home Page</title>
+ <link>https://www.w3schools.com</link>
+ <item>
+   <title>RSS Tutorial</title>
+   <link>https://www.w3schools.com/xml/xml_rss.asp</link>
+   <description>New RSS tutorial on W3Schools</description>
+   <content:encoded><![CDATA[<p>The whole RSS tutorial</p>]]></content:encoded>
+   <pubDate>Mon, 06 Jan 2020 10:00:00 +0000</pubDate>
+   <dc:creator>Jane Doe</dc:creator>
+   <dc:creator>John Doe</dc:creator>
+   <category>XML</category>
+   <category>Tutorials</category>
+   <enclosure url="https://www.w3schools.com/rss.mp3" length="1024" type="audio/mpeg"/>
+ </item>
+</channel>
+</rss>
+`,
+			&feed.Feed{
+				FeedLink: &url.URL{
+					Scheme: "http",
+					Host:   "rss.local",
+				},
+				Title: "W3Schools Home Page",
+				Link:  "https://www.w3schools.com",
+			},
+			[]*feed.Article{
+				{
+					Published:   time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC),
+					Title:       "RSS Tutorial",
+					Description: "New RSS tutorial on W3Schools",
+					Link:        "https://www.w3schools.com/xml/xml_rss.asp",
+					Content:     "<p>The whole RSS tutorial</p>",
+					Authors:     []*feed.Person{{Name: "Jane Doe"}, {Name: "John Doe"}},
+					Categories:  []string{"XML", "Tutorials"},
+					Enclosures: []*feed.Enclosure{
+						{URL: "https://www.w3schools.com/rss.mp3", Type: "audio/mpeg", Length: 1024},
+					},
+				},
+			},
+			60 * time.Second,
+			false,
+		},
+		{
+			"updated without published",
+			fields{
+				nil,
+				nil,
+			},
+			args{
+				context.Background(),
+				&feed.Feed{
+					FeedLink: &url.URL{
+						Scheme: "http",
+						Host:   "rss.local",
+					},
+				},
+			},
+			nil,
+			`<?xml version="1.0" encoding="UTF-8" ?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+ <title>W3Schools Home Page</title>
+ <link href="https://www.w3schools.com"/>
+ <entry>
+   <title>Atom Tutorial</title>
+   <link href="https://www.w3schools.com/xml/atom.asp"/>
+   <updated>2020-01-06T10:00:00Z</updated>
+ </entry>
+</feed>
+`,
+			&feed.Feed{
+				FeedLink: &url.URL{
+					Scheme: "http",
+					Host:   "rss.local",
+				},
+				Title: "W3Schools Home Page",
+				Link:  "https://www.w3schools.com",
+			},
+			[]*feed.Article{
+				{
+					Published: time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC),
+					Updated:   time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC),
+					Title:     "Atom Tutorial",
+					Link:      "https://www.w3schools.com/xml/atom.asp",
+				},
+			},
+			60 * time.Second,
+			false,
+		},
+		{
+			"sanitised description",
+			fields{
+				nil,
+				nil,
+			},
+			args{
+				context.Background(),
+				&feed.Feed{
+					FeedLink: &url.URL{
+						Scheme: "http",
+						Host:   "rss.local",
+					},
+				},
+			},
+			nil,
+			`<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+ <link>https://www.w3schools.com</link>
+ <item>
+   <title>RSS Tutorial</title>
+   <link>https://www.w3schools.com/xml/xml_rss.asp</link>
+   <description><![CDATA[<p onclick="track()">New <a href="rss_tag_title.asp">RSS</a> tutorial<script>track()</script><img src="https://track.local/p.gif" width="1" height="1"></p>]]></description>
+ </item>
+</channel>
+</rss>
+`,
+			&feed.Feed{
+				FeedLink: &url.URL{
+					Scheme: "http",
+					Host:   "rss.local",
+				},
+				Title: "W3Schools Home Page",
+				Link:  "https://www.w3schools.com",
+			},
+			[]*feed.Article{
+				{
+					Title:          "RSS Tutorial",
+					Link:           "https://www.w3schools.com/xml/xml_rss.asp",
+					Description:    `<p>New <a href="https://www.w3schools.com/xml/rss_tag_title.asp">RSS</a> tutorial</p>`,
+					RawDescription: `<p onclick="track()">New <a href="rss_tag_title.asp">RSS</a> tutorial<script>track()</script><img src="https://track.local/p.gif" width="1" height="1"></p>`,
+				},
+			},
+			60 * time.Second,
+			false,
+		},
+		{
+			"plain text description is not kept raw",
+			fields{
+				nil,
+				nil,
+			},
+			args{
+				context.Background(),
+				&feed.Feed{
+					FeedLink: &url.URL{
+						Scheme: "http",
+						Host:   "rss.local",
+					},
+				},
+			},
+			nil,
+			`<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+ <link>https://www.w3schools.com</link>
+ <item>
+   <title>RSS Tutorial</title>
+   <link>https://www.w3schools.com/xml/xml_rss.asp</link>
+   <description><![CDATA[Learn "RSS" & <b>XML</b>]]></description>
+ </item>
+</channel>
+</rss>
+`,
+			&feed.Feed{
+				FeedLink: &url.URL{
+					Scheme: "http",
+					Host:   "rss.local",
+				},
+				Title: "W3Schools Home Page",
+				Link:  "https://www.w3schools.com",
+			},
+			[]*feed.Article{
+				{
+					Title:       "RSS Tutorial",
+					Link:        "https://www.w3schools.com/xml/xml_rss.asp",
+					Description: `Learn &#34;RSS&#34; &amp; <b>XML</b>`,
+				},
+			},
+			60 * time.Second,
+			false,
+		},
 		{
 			"invalid feed",
 			fields{
@@ -403,4 +636,588 @@ func TestReader_Update_ConcurrentWorkers(t *testing.T) {
 	if len(f) != 2 {
 		t.Errorf("feed count incorrect want %v, got %v", 2, len(f))
 	}
-}
\ No newline at end of file
+}
+
+func TestReader_AddRemove(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+ <link>https://www.w3schools.com</link>
+</channel>
+</rss>
+`
+
+	// Requests to the slow host take long enough for us to remove
+	// the feed whilst it is still being read.
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			if r.URL.Host == "slow.local" {
+				<-time.After(200 * time.Millisecond)
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+			}
+		}),
+	})
+
+	s := storage.NewInMemoryStorage(10)
+	r := NewReader(s, c, WithWorkers(2))
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+
+	// Start the reader without any feeds and add them once it is running
+	r.Update(ctx, nil)
+
+	fast := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "fast.local"}}
+	slow := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "slow.local"}}
+
+	r.Add(fast)
+	r.Add(slow)
+
+	<-time.After(50 * time.Millisecond)
+	r.Remove(slow.UUID())
+	<-time.After(300 * time.Millisecond)
+
+	if _, err := s.Feed(fast.UUID()); err != nil {
+		t.Errorf("added feed was not stored: %v", err)
+	}
+
+	if _, err := s.Feed(slow.UUID()); err == nil {
+		t.Errorf("removed feed was stored")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.feeds[slow.UUID()]; ok {
+		t.Errorf("removed feed is still scheduled")
+	}
+}
+
+func TestReader_PauseResumeRefresh(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+</channel>
+</rss>
+`
+
+	requests := make(chan struct{}, 10)
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			requests <- struct{}{}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+			}
+		}),
+	})
+
+	// A long retry duration means feeds are only read again when refreshed
+	r := NewReader(storage.NewInMemoryStorage(10), c, WithRetryDuration(time.Hour), WithMinHostInterval(0))
+
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local"}}
+	r.Add(f)
+
+	if err := r.Pause(f.UUID()); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+
+	if err := r.Pause(feed.UUIDFromString("oops")); err != ErrFeedNotScheduled {
+		t.Errorf("Pause() of unknown feed error = %v, want %v", err, ErrFeedNotScheduled)
+	}
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+	r.Update(ctx, nil)
+
+	expect := func(name string, want bool) {
+		select {
+		case <-requests:
+			if !want {
+				t.Errorf("%s: feed was read unexpectedly", name)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if want {
+				t.Errorf("%s: feed was not read", name)
+			}
+		}
+	}
+
+	expect("paused", false)
+
+	if err := r.Refresh(f.UUID()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	expect("refreshed while paused", true)
+	expect("paused after refresh", false)
+
+	if err := r.Resume(f.UUID()); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	expect("resumed within retry duration", false)
+
+	if err := r.Refresh(f.UUID()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	expect("refreshed", true)
+}
+
+func TestReader_ConditionalRequests(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+</channel>
+</rss>
+`
+	etag := `"abc123"`
+	lastModified := "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	// The fake server only returns 304 when both validators it
+	// handed out are sent back verbatim.
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+				return &http.Response{
+					StatusCode: http.StatusNotModified,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+				Header: http.Header{
+					"Etag":          {etag},
+					"Last-Modified": {lastModified},
+				},
+			}
+		}),
+	})
+
+	s := storage.NewInMemoryStorage(10)
+	r := NewReader(s, c)
+	sf := newScheduledFeed(&feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local"}})
+
+	if _, err := r.process(context.Background(), sf); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+
+	stored, err := s.Feed(sf.f.UUID())
+	if err != nil {
+		t.Fatalf("Feed() error = %v", err)
+	}
+
+	if stored.ETag != etag || stored.LastModified != lastModified {
+		t.Errorf("stored validators got = %q %q, want %q %q", stored.ETag, stored.LastModified, etag, lastModified)
+	}
+
+	if _, err := r.process(context.Background(), sf); err != ErrNotModified {
+		t.Errorf("process() with validators error = %v, want %v", err, ErrNotModified)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "120", 120 * time.Second, true},
+		{"negative seconds", "-1", 0, false},
+		{"http date", "Wed, 21 Oct 2015 07:30:00 GMT", 2 * time.Minute, true},
+		{"http date in the past", "Wed, 21 Oct 2015 07:00:00 GMT", 0, true},
+		{"invalid", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_parseDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  uint
+	}{
+		{"empty", "", 0},
+		{"seconds", "3723", 3723},
+		{"fractional seconds", "3723.5", 3723},
+		{"minutes and seconds", "62:03", 3723},
+		{"hours, minutes and seconds", "1:02:03", 3723},
+		{"negative", "-1:00", 0},
+		{"too many parts", "1:1:02:03", 0},
+		{"invalid", "an hour", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDuration(tt.value); got != tt.want {
+				t.Errorf("parseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_enclosures(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+ <title>Mock Podcast</title>
+ <item>
+   <title>Episode 1</title>
+   <enclosure url="https://podcast.local/1.mp3" length="1024" type="audio/mpeg"/>
+   <itunes:duration>1:02:03</itunes:duration>
+   <media:content url="https://podcast.local/1.mp3" duration="3723" fileSize="2048"/>
+   <media:group>
+    <media:content url="https://podcast.local/1.mp4" type="video/mp4" fileSize="4096" duration="60"/>
+   </media:group>
+ </item>
+</channel>
+</rss>
+`
+	pf, err := gofeed.NewParser().Parse(strings.NewReader(xml))
+	if err != nil {
+		t.Fatalf("could not parse feed: %v", err)
+	}
+
+	want := []*feed.Enclosure{
+		{URL: "https://podcast.local/1.mp3", Type: "audio/mpeg", Length: 1024, Duration: 3723},
+		{URL: "https://podcast.local/1.mp4", Type: "video/mp4", Length: 4096, Duration: 60},
+	}
+
+	if got := enclosures(pf.Items[0], pf.FeedType); !reflect.DeepEqual(got, want) {
+		t.Errorf("enclosures() got = %v, want %v", got, want)
+	}
+
+	json := `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Mock Podcast",
+  "items": [{"id": "1", "attachments": [{"url": "https://podcast.local/1.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1024, "duration_in_seconds": 3723}]}]
+}`
+	pf, err = gofeed.NewParser().Parse(strings.NewReader(json))
+	if err != nil {
+		t.Fatalf("could not parse feed: %v", err)
+	}
+
+	want = []*feed.Enclosure{{URL: "https://podcast.local/1.mp3", Type: "audio/mpeg", Duration: 3723}}
+	if got := enclosures(pf.Items[0], pf.FeedType); !reflect.DeepEqual(got, want) {
+		t.Errorf("enclosures() of JSON Feed got = %v, want %v", got, want)
+	}
+}
+
+func TestReader_backoff(t *testing.T) {
+	r := NewReader(nil, WithRetryAfterErrorDuration(time.Minute), WithMaxBackoffDuration(5*time.Minute))
+	sf := newScheduledFeed(&feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local"}})
+
+	// Each failure doubles the wait up to the maximum, with jitter
+	// taking off at most half of the wait.
+	for i, max := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		d := r.backoff(sf, cachedParsedFeed{})
+		if d < max/2 || d > max {
+			t.Errorf("backoff() after %d failures = %v, want between %v and %v", i+1, d, max/2, max)
+		}
+	}
+
+	if _, ok := r.hostBlocked("rss.local"); ok {
+		t.Errorf("host blocked without being throttled")
+	}
+
+	// A longer Retry-After from a throttling server must be respected
+	// and must apply to every feed on the same host.
+	d := r.backoff(sf, cachedParsedFeed{throttled: true, retryAfter: time.Hour})
+	if d != time.Hour {
+		t.Errorf("backoff() with Retry-After = %v, want %v", d, time.Hour)
+	}
+
+	if until, ok := r.hostBlocked("rss.local"); !ok || until.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("hostBlocked() = %v, %v, want blocked for an hour", until, ok)
+	}
+
+	if _, ok := r.hostBlocked("other.local"); ok {
+		t.Errorf("unrelated host blocked")
+	}
+}
+
+func TestReader_Update_HostBackoff(t *testing.T) {
+	requests := make(chan string, 10)
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			requests <- r.URL.Path
+
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Status:     "429 Too Many Requests",
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Header:     http.Header{"Retry-After": {"3600"}},
+			}
+		}),
+	})
+
+	// A single worker means the second feed is only read once the
+	// first one has been throttled.
+	r := NewReader(storage.NewInMemoryStorage(10), c, WithWorkers(1), WithMinHostInterval(0))
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+
+	errs := r.Update(ctx, []*feed.Feed{
+		{FeedLink: &url.URL{Scheme: "https", Host: "rss.local", Path: "/1"}},
+		{FeedLink: &url.URL{Scheme: "https", Host: "rss.local", Path: "/2"}},
+	})
+	go func() {
+		for range errs {
+		}
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	if len(requests) != 1 {
+		t.Errorf("requests to throttled host want %v got %v", 1, len(requests))
+	}
+}
+
+func TestReader_Update_HostLimits(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+</channel>
+</rss>
+`
+
+	var mu sync.Mutex
+	var active, maxActive int
+	var starts []time.Time
+
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			starts = append(starts, time.Now())
+			mu.Unlock()
+
+			<-time.After(50 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+			}
+		}),
+	})
+
+	r := NewReader(storage.NewInMemoryStorage(10), c,
+		WithWorkers(4),
+		WithMaxHostRequests(2),
+		WithMinHostInterval(20*time.Millisecond),
+	)
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+
+	feeds := []*feed.Feed{}
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		feeds = append(feeds, &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local", Path: p}})
+	}
+
+	r.Update(ctx, feeds)
+	<-time.After(300 * time.Millisecond)
+	cf()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(starts) != 4 {
+		t.Fatalf("requests want %v got %v", 4, len(starts))
+	}
+
+	if maxActive > 2 {
+		t.Errorf("concurrent requests to host want at most %v got %v", 2, maxActive)
+	}
+
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	for i := 1; i < len(starts); i++ {
+		if d := starts[i].Sub(starts[i-1]); d < 15*time.Millisecond {
+			t.Errorf("interval between requests to host want at least %v got %v", 20*time.Millisecond, d)
+		}
+	}
+}
+
+func TestReader_Redirects(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+ <item>
+  <title>RSS Tutorial</title>
+  <link>https://www.w3schools.com/xml/xml_rss.asp</link>
+ </item>
+</channel>
+</rss>
+`
+	// Responses hold the request they answer as a real transport's do
+	redirect := func(r *http.Request, code int, location string) *http.Response {
+		return &http.Response{
+			Request:    r,
+			StatusCode: code,
+			Header:     http.Header{"Location": {location}},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}
+	}
+
+	// Feeds on old.local permanently move to new.local, except for the
+	// temporary feed which temporarily redirects to its next location
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			switch r.URL.String() {
+			case "https://old.local/feed":
+				return redirect(r, http.StatusMovedPermanently, "https://older.local/feed")
+			case "https://older.local/feed":
+				return redirect(r, http.StatusPermanentRedirect, "https://new.local/feed")
+			case "https://old.local/temporary":
+				return redirect(r, http.StatusFound, "https://new.local/temporary")
+			case "https://old.local/partly":
+				return redirect(r, http.StatusMovedPermanently, "https://older.local/partly")
+			case "https://older.local/partly":
+				return redirect(r, http.StatusTemporaryRedirect, "https://new.local/partly")
+			case "https://old.local/gone":
+				return &http.Response{
+					StatusCode: http.StatusGone,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}
+			}
+
+			return &http.Response{
+				Request:    r,
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+			}
+		}),
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantLink string
+	}{
+		{"permanent redirects", "/feed", "https://new.local/feed"},
+		{"temporary redirect", "/temporary", "https://old.local/temporary"},
+		{"permanent then temporary redirect", "/partly", "https://older.local/partly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewInMemoryStorage(10)
+			r := NewReader(s, c)
+
+			f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "old.local", Path: tt.path}}
+			id := f.UUID()
+			sf := newScheduledFeed(f)
+
+			s.Store(f, nil)
+			if err := s.Subscribe(storage.DefaultUser, id); err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+
+			if _, err := r.process(context.Background(), sf); err != nil {
+				t.Fatalf("process() error = %v", err)
+			}
+
+			stored, err := s.Feed(id)
+			if err != nil {
+				t.Fatalf("Feed() error = %v", err)
+			}
+
+			if stored.FeedLink.String() != tt.wantLink || stored.UUID() != id {
+				t.Errorf("stored feed got = %v %v, want %v %v", stored.FeedLink, stored.UUID(), tt.wantLink, id)
+			}
+
+			article := &feed.Article{Link: "https://www.w3schools.com/xml/xml_rss.asp"}
+			if _, err := s.Article(storage.DefaultUser, article.UUID()); err != nil {
+				t.Errorf("article of moved feed was not stored: %v", err)
+			}
+		})
+	}
+
+	t.Run("gone", func(t *testing.T) {
+		s := storage.NewInMemoryStorage(10)
+		r := NewReader(s, c)
+
+		f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "old.local", Path: "/gone"}}
+		r.Add(f)
+
+		r.mu.Lock()
+		sf := r.feeds[f.UUID()]
+		r.mu.Unlock()
+
+		if _, err := r.process(context.Background(), sf); !errors.Is(err, ErrFeedGone) {
+			t.Fatalf("process() error = %v, want %v", err, ErrFeedGone)
+		}
+
+		stored, err := s.Feed(f.UUID())
+		if err != nil {
+			t.Fatalf("Feed() error = %v", err)
+		}
+
+		if !stored.Inactive {
+			t.Errorf("gone feed is not inactive")
+		}
+
+		if !sf.removed() {
+			t.Errorf("gone feed is still scheduled")
+		}
+
+		// Inactive feeds are not scheduled again
+		r.Add(stored)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if _, ok := r.feeds[f.UUID()]; ok {
+			t.Errorf("inactive feed was scheduled")
+		}
+	})
+
+	t.Run("gone while updating", func(t *testing.T) {
+		r := NewReader(storage.NewInMemoryStorage(10), c)
+
+		ctx, cf := context.WithCancel(context.Background())
+		defer cf()
+
+		f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "old.local", Path: "/gone"}}
+		errs := r.Update(ctx, []*feed.Feed{f})
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrFeedGone) {
+				t.Errorf("Update() error = %v, want %v", err, ErrFeedGone)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Update() did not send %v", ErrFeedGone)
+		}
+	})
+}
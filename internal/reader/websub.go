@@ -0,0 +1,540 @@
+package reader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmcdole/gofeed"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"reader/internal/feed"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	modeSubscribe   = "subscribe"
+	modeUnsubscribe = "unsubscribe"
+	modeDenied      = "denied"
+
+	// How long a hub is given to verify a subscription before it is
+	// requested again
+	websubVerifyTimeout = 10 * time.Minute
+
+	// Largest body accepted when a hub pushes content
+	maxPushSize = 10 << 20
+)
+
+// subscription is a WebSub subscription to the hub of a feed. While the
+// lease is active the hub pushes new content and the feed is only polled
+// again once the lease expires.
+type subscription struct {
+	hub   string
+	topic string
+
+	// Secret the hub signs pushed content with, only given to hubs
+	// reached over HTTPS
+	secret string
+
+	// Mode the hub has yet to verify, empty once it has been verified
+	pending   string
+	requested time.Time
+
+	expires time.Time
+}
+
+// active reports whether the hub has verified the subscription and
+// its lease has not yet expired
+func (sub *subscription) active(now time.Time) bool {
+	return sub.pending == "" && sub.expires.After(now)
+}
+
+// WithWebSub subscribes to the hubs which feeds advertise. Hubs call back
+// to the given URL followed by the UUID of the feed, which must be served
+// by the handler returned from WebSub.
+func WithWebSub(callback *url.URL) Option {
+	return func(reader *Reader) {
+		reader.callback = callback
+	}
+}
+
+// WebSub returns the handler for callbacks from hubs, which verify
+// subscriptions and push new content
+func (r *Reader) WebSub() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := uuid.Parse(path.Base(req.URL.Path))
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			r.verify(w, req, id)
+		case http.MethodPost:
+			r.push(w, req, id)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// callbackURL returns the URL a hub calls back to for the given feed
+func (r *Reader) callbackURL(id uuid.UUID) string {
+	u := *r.callback
+	u.Path = path.Join(u.Path, id.String())
+
+	return u.String()
+}
+
+// subscribeHub subscribes a feed to the hub it advertises, unless it is
+// already subscribed or the hub has yet to verify an earlier request
+func (r *Reader) subscribeHub(ctx context.Context, f *feed.Feed, hub string, topic string) error {
+	if r.callback == nil || hub == "" {
+		return nil
+	}
+
+	id := f.UUID()
+	now := time.Now()
+
+	r.mu.Lock()
+	if sub, ok := r.subs[id]; ok && sub.hub == hub && sub.topic == topic {
+		waiting := sub.pending == modeSubscribe && now.Sub(sub.requested) < websubVerifyTimeout
+		if sub.active(now) || waiting {
+			r.mu.Unlock()
+			return nil
+		}
+	}
+
+	sub := &subscription{
+		hub:       hub,
+		topic:     topic,
+		pending:   modeSubscribe,
+		requested: now,
+	}
+
+	// Secrets are only sent over HTTPS so that they cannot be read
+	if strings.HasPrefix(hub, "https://") {
+		secret, err := newSecret()
+		if err != nil {
+			r.mu.Unlock()
+			return err
+		}
+
+		sub.secret = secret
+	}
+
+	if r.subs == nil {
+		r.subs = map[uuid.UUID]*subscription{}
+	}
+	r.subs[id] = sub
+	r.mu.Unlock()
+
+	if err := r.requestSubscription(ctx, id, sub, modeSubscribe); err != nil {
+		r.mu.Lock()
+		if r.subs[id] == sub {
+			delete(r.subs, id)
+		}
+		r.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// unsubscribeHub asks the hub to stop pushing content for a feed which
+// has been removed
+func (r *Reader) unsubscribeHub(id uuid.UUID, sub *subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := r.requestSubscription(ctx, id, sub, modeUnsubscribe); err != nil {
+		log.Printf("could not unsubscribe from hub: %v", err)
+
+		r.mu.Lock()
+		if r.subs[id] == sub {
+			delete(r.subs, id)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// requestSubscription sends a subscription request to a hub. The hub
+// verifies the request by calling back before it takes effect.
+func (r *Reader) requestSubscription(ctx context.Context, id uuid.UUID, sub *subscription, mode string) error {
+	form := url.Values{
+		"hub.callback": {r.callbackURL(id)},
+		"hub.mode":     {mode},
+		"hub.topic":    {sub.topic},
+	}
+
+	if mode == modeSubscribe && sub.secret != "" {
+		form.Set("hub.secret", sub.secret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("hub %s refused to %s to %s: %s", sub.hub, mode, sub.topic, resp.Status)
+	}
+
+	return nil
+}
+
+// verify answers a hub verifying the intent of a subscription request,
+// or telling us that it denied a subscription
+func (r *Reader) verify(w http.ResponseWriter, req *http.Request, id uuid.UUID) {
+	q := req.URL.Query()
+	mode := q.Get("hub.mode")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.subs[id]
+	if !ok || sub.topic != q.Get("hub.topic") {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch {
+	case mode == modeDenied:
+		// The feed is polled as it was before subscribing
+		log.Printf("hub %s denied subscription to %s: %s", sub.hub, sub.topic, q.Get("hub.reason"))
+		delete(r.subs, id)
+		w.WriteHeader(http.StatusOK)
+		return
+	case mode == "" || mode != sub.pending:
+		http.NotFound(w, req)
+		return
+	case mode == modeSubscribe:
+		lease, err := strconv.Atoi(q.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			http.NotFound(w, req)
+			return
+		}
+
+		sub.pending = ""
+		sub.expires = time.Now().Add(time.Duration(lease) * time.Second)
+	case mode == modeUnsubscribe:
+		delete(r.subs, id)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(q.Get("hub.challenge")))
+}
+
+// push stores content pushed by the hub of a subscribed feed
+func (r *Reader) push(w http.ResponseWriter, req *http.Request, id uuid.UUID) {
+	r.mu.Lock()
+	sub, subscribed := r.subs[id]
+	active := subscribed && sub.active(time.Now())
+
+	var f feed.Feed
+	sf, scheduled := r.feeds[id]
+	if scheduled {
+		f = *sf.f
+	}
+
+	var secret string
+	if active {
+		secret = sub.secret
+	}
+	r.mu.Unlock()
+
+	if !active || !scheduled {
+		http.NotFound(w, req)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxPushSize+1))
+	if err != nil {
+		http.Error(w, "could not read content", http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > maxPushSize {
+		http.Error(w, "content too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Content which is not signed by the hub is acknowledged so that the
+	// hub does not retry it, but is otherwise ignored
+	if secret != "" && !validSignature(secret, body, req.Header.Get("X-Hub-Signature")) {
+		log.Printf("ignoring content for feed %s with invalid signature", id)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	pf, err := r.parse(body)
+	if err != nil {
+		http.Error(w, "could not parse content", http.StatusBadRequest)
+		return
+	}
+
+	pushed, articles := r.mapParsedFeedToFeedAndArticles(pf, &f)
+
+	// The pages of full content feeds are fetched once the push has been
+	// acknowledged so that the hub isn't kept waiting on them
+	r.mu.Lock()
+	rn := r.run
+	fetch := pushed.FullContent && rn != nil && !rn.stopped
+	if fetch {
+		rn.wg.Add(1)
+	}
+	r.mu.Unlock()
+
+	if fetch {
+		go r.storePushed(rn, sf, pushed, articles)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Don't store a feed which was removed whilst its content was pushed
+	if sf.removed() {
+		http.NotFound(w, req)
+		return
+	}
+
+	if err := r.s.Store(pushed, articles); err != nil {
+		http.Error(w, "could not store content", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// storePushed fetches the full content of articles pushed by a hub
+// before storing them, sending any error on to the run as a worker does
+func (r *Reader) storePushed(rn *run, sf *scheduledFeed, f *feed.Feed, articles []*feed.Article) {
+	defer rn.wg.Done()
+
+	r.fullContent(rn.ctx, f, articles)
+
+	// Don't store a feed which was removed whilst fetching its content
+	if sf.removed() {
+		return
+	}
+
+	if err := r.s.Store(f, articles); err != nil {
+		select {
+		case <-rn.ctx.Done():
+		case rn.errs <- err:
+		}
+	}
+}
+
+// pollDelay returns how long to wait before polling a feed again. While
+// a hub is pushing the feed's content it is not polled until the lease
+// expires, at which point polling renews the subscription.
+func (r *Reader) pollDelay(id uuid.UUID, d time.Duration) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if sub, ok := r.subs[id]; ok && sub.active(now) {
+		if until := sub.expires.Sub(now); until > d {
+			return until
+		}
+	}
+
+	return d
+}
+
+// discoverHub returns the hub a feed advertises along with the topic to
+// subscribe to, which is the feed's self link when it has one. Link
+// headers take precedence over links in the feed itself.
+func discoverHub(header http.Header, body []byte, pf *gofeed.Feed, f *feed.Feed) (hub string, topic string) {
+	hub, topic = linkHeaderHub(header.Values("Link"))
+
+	if hub == "" {
+		var self string
+		if pf.FeedType == "json" {
+			hub, self = jsonFeedHub(body)
+		} else {
+			hub, self = xmlFeedHub(body)
+		}
+
+		if topic == "" {
+			topic = self
+		}
+	}
+
+	if topic == "" {
+		topic = f.FeedLink.String()
+	}
+
+	return hub, topic
+}
+
+// linkHeaderHub returns the hub and self links from Link headers such as
+// <https://hub.example.com/>; rel="hub"
+func linkHeaderHub(values []string) (hub string, self string) {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = strings.Trim(target, "<>")
+
+			for _, p := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					switch {
+					case strings.EqualFold(rel, "hub") && hub == "":
+						hub = target
+					case strings.EqualFold(rel, "self") && self == "":
+						self = target
+					}
+				}
+			}
+		}
+	}
+
+	return hub, self
+}
+
+// xmlFeedHub returns the hub and self links of an RSS or Atom feed, which
+// are link elements in the channel or feed before any items or entries
+func xmlFeedHub(body []byte) (hub string, self string) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return hub, self
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "item", "entry":
+			return hub, self
+		case "link":
+			var rel, href string
+			for _, attr := range se.Attr {
+				switch attr.Name.Local {
+				case "rel":
+					rel = attr.Value
+				case "href":
+					href = attr.Value
+				}
+			}
+
+			for _, r := range strings.Fields(rel) {
+				switch {
+				case r == "hub" && hub == "":
+					hub = href
+				case r == "self" && self == "":
+					self = href
+				}
+			}
+		}
+	}
+}
+
+// jsonFeedHub returns the WebSub hub and feed URL of a JSON Feed
+func jsonFeedHub(body []byte) (hub string, self string) {
+	var jf struct {
+		FeedURL string `json:"feed_url"`
+		Hubs    []struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+		} `json:"hubs"`
+	}
+
+	if err := json.Unmarshal(body, &jf); err != nil {
+		return "", ""
+	}
+
+	for _, h := range jf.Hubs {
+		if strings.EqualFold(h.Type, "websub") {
+			return h.URL, jf.FeedURL
+		}
+	}
+
+	return "", jf.FeedURL
+}
+
+// validSignature reports whether pushed content was signed by the hub
+// with the subscription's secret, as method=<hex> in X-Hub-Signature
+func validSignature(secret string, body []byte, signature string) bool {
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	var h func() hash.Hash
+	switch parts[0] {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+
+	want, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// newSecret returns a random secret for a hub to sign content with
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
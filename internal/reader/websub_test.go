@@ -0,0 +1,327 @@
+package reader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"github.com/mmcdole/gofeed"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReader_WebSub(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+ <title>W3Schools Home Page</title>
+ <atom:link rel="hub" href="https://hub.local/"/>
+ <atom:link rel="self" href="https://rss.local/feed"/>
+</channel>
+</rss>
+`
+	pushed := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>W3Schools Home Page</title>
+ <item>
+  <title>Pushed</title>
+  <link>https://rss.local/pushed</link>
+ </item>
+</channel>
+</rss>
+`
+
+	// Requests to the hub are sent on so the test can check them
+	requests := make(chan url.Values, 10)
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			if r.URL.Host == "hub.local" {
+				r.ParseForm()
+				requests <- r.PostForm
+
+				return &http.Response{
+					StatusCode: http.StatusAccepted,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(xml)),
+			}
+		}),
+	})
+
+	s := storage.NewInMemoryStorage(10)
+	callback := &url.URL{Scheme: "https", Host: "reader.local", Path: "/websub"}
+	r := NewReader(s, c, WithWebSub(callback))
+	h := r.WebSub()
+
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local", Path: "/feed"}}
+	r.Add(f)
+
+	r.mu.Lock()
+	sf := r.feeds[f.UUID()]
+	r.mu.Unlock()
+
+	d, err := r.process(context.Background(), sf)
+	if err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	var sub url.Values
+	select {
+	case sub = <-requests:
+	default:
+		t.Fatalf("feed was not subscribed to its hub")
+	}
+
+	wantCallback := "https://reader.local/websub/" + f.UUID().String()
+	if sub.Get("hub.mode") != "subscribe" || sub.Get("hub.topic") != "https://rss.local/feed" || sub.Get("hub.callback") != wantCallback || sub.Get("hub.secret") == "" {
+		t.Errorf("subscription request got %v", sub)
+	}
+
+	// Reading the feed again does not subscribe again while the hub has
+	// yet to verify the subscription
+	if _, err := r.process(context.Background(), sf); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+
+	select {
+	case <-requests:
+		t.Errorf("feed was subscribed to its hub twice")
+	default:
+	}
+
+	if got := r.pollDelay(f.UUID(), d); got != d {
+		t.Errorf("pollDelay() before verification got %v, want %v", got, d)
+	}
+
+	serve := func(method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	verify := func(mode string, topic string) *httptest.ResponseRecorder {
+		q := url.Values{
+			"hub.mode":          {mode},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"challenge"},
+			"hub.lease_seconds": {"3600"},
+		}
+
+		return serve("GET", "/websub/"+f.UUID().String()+"?"+q.Encode(), "", nil)
+	}
+
+	if resp := verify("subscribe", "https://other.local/feed"); resp.Code != http.StatusNotFound {
+		t.Errorf("verifying other topic StatusCode want %v got %v", http.StatusNotFound, resp.Code)
+	}
+
+	if resp := verify("unsubscribe", "https://rss.local/feed"); resp.Code != http.StatusNotFound {
+		t.Errorf("verifying unrequested mode StatusCode want %v got %v", http.StatusNotFound, resp.Code)
+	}
+
+	if resp := verify("subscribe", "https://rss.local/feed"); resp.Code != http.StatusOK || resp.Body.String() != "challenge" {
+		t.Errorf("verifying subscription got %v %q, want %v %q", resp.Code, resp.Body.String(), http.StatusOK, "challenge")
+	}
+
+	// The feed is not polled until the lease expires
+	if got := r.pollDelay(f.UUID(), d); got < 59*time.Minute {
+		t.Errorf("pollDelay() while subscribed got %v, want lease", got)
+	}
+
+	sign := func(secret string) http.Header {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(pushed))
+
+		return http.Header{"X-Hub-Signature": {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}
+	}
+
+	if resp := serve("POST", "/websub/"+f.UUID().String(), pushed, sign("wrong")); resp.Code != http.StatusAccepted {
+		t.Errorf("pushing with invalid signature StatusCode want %v got %v", http.StatusAccepted, resp.Code)
+	}
+
+	article := &feed.Article{Link: "https://rss.local/pushed"}
+	if _, err := s.Article(storage.DefaultUser, article.UUID()); err == nil {
+		t.Errorf("content with invalid signature was stored")
+	}
+
+	if resp := serve("POST", "/websub/"+feed.UUIDFromString("oops").String(), pushed, sign(sub.Get("hub.secret"))); resp.Code != http.StatusNotFound {
+		t.Errorf("pushing to unknown feed StatusCode want %v got %v", http.StatusNotFound, resp.Code)
+	}
+
+	if resp := serve("POST", "/websub/"+f.UUID().String(), pushed, sign(sub.Get("hub.secret"))); resp.Code != http.StatusAccepted {
+		t.Errorf("pushing StatusCode want %v got %v", http.StatusAccepted, resp.Code)
+	}
+
+	if _, err := s.Article(storage.DefaultUser, article.UUID()); err != nil {
+		t.Errorf("pushed article was not stored: %v", err)
+	}
+
+	// Removing the feed unsubscribes it from its hub
+	r.Remove(f.UUID())
+
+	select {
+	case unsub := <-requests:
+		if unsub.Get("hub.mode") != "unsubscribe" || unsub.Get("hub.topic") != "https://rss.local/feed" {
+			t.Errorf("unsubscription request got %v", unsub)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("removed feed was not unsubscribed from its hub")
+	}
+
+	if resp := verify("unsubscribe", "https://rss.local/feed"); resp.Code != http.StatusOK {
+		t.Errorf("verifying unsubscription StatusCode want %v got %v", http.StatusOK, resp.Code)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subs[f.UUID()]; ok {
+		t.Errorf("unsubscribed feed still has a subscription")
+	}
+}
+
+func TestReader_WebSub_FullContent(t *testing.T) {
+	pushed := `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+ <title>News</title>
+ <item>
+  <title>Article</title>
+  <link>https://news.local/1</link>
+  <description>Summary</description>
+ </item>
+</channel>
+</rss>
+`
+
+	// Article pages are held until the push has been acknowledged
+	release := make(chan struct{})
+	c := WithHTTPClient(&http.Client{
+		Transport: rtf(func(r *http.Request) *http.Response {
+			<-release
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(testPage)),
+				Request:    r,
+			}
+		}),
+	})
+
+	s := storage.NewInMemoryStorage(10)
+	f := testFullContentFeed(t, s)
+	f.ModifiedAt = time.Now()
+
+	callback := &url.URL{Scheme: "https", Host: "reader.local", Path: "/websub"}
+	r := NewReader(s, c, WithWebSub(callback), WithContentInterval(0))
+	r.subs = map[uuid.UUID]*subscription{f.UUID(): {expires: time.Now().Add(time.Hour)}}
+
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+
+	r.Update(ctx, []*feed.Feed{f})
+
+	done := make(chan int)
+	go func() {
+		resp := httptest.NewRecorder()
+		r.WebSub().ServeHTTP(resp, httptest.NewRequest("POST", "/websub/"+f.UUID().String(), strings.NewReader(pushed)))
+		done <- resp.Code
+	}()
+
+	select {
+	case code := <-done:
+		if code != http.StatusAccepted {
+			t.Errorf("pushing StatusCode want %v got %v", http.StatusAccepted, code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("push was not acknowledged until article pages were fetched")
+	}
+
+	close(release)
+	<-time.After(100 * time.Millisecond)
+
+	a, err := s.Article(storage.DefaultUser, (&feed.Article{Link: "https://news.local/1"}).UUID())
+	if err != nil {
+		t.Fatalf("Article() error = %v", err)
+	}
+
+	if !strings.Contains(a.Content, "The quick brown fox") {
+		t.Errorf("Content got = %v, want content fetched from the page", a.Content)
+	}
+}
+
+func Test_discoverHub(t *testing.T) {
+	f := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "rss.local", Path: "/feed"}}
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		body      string
+		feedType  string
+		wantHub   string
+		wantTopic string
+	}{
+		{
+			"link headers",
+			http.Header{"Link": {`<https://hub.local/>; rel="hub", <https://rss.local/self>; rel="self"`}},
+			`<rss><channel><link rel="hub" href="https://other.local/"/></channel></rss>`,
+			"rss",
+			"https://hub.local/",
+			"https://rss.local/self",
+		},
+		{
+			"atom links",
+			http.Header{},
+			`<feed xmlns="http://www.w3.org/2005/Atom"><link rel="hub" href="https://hub.local/"/><entry><link rel="hub" href="https://other.local/"/></entry></feed>`,
+			"atom",
+			"https://hub.local/",
+			"https://rss.local/feed",
+		},
+		{
+			"json feed hubs",
+			http.Header{},
+			`{"feed_url": "https://rss.local/feed.json", "hubs": [{"type": "rssCloud", "url": "https://cloud.local/"}, {"type": "WebSub", "url": "https://hub.local/"}]}`,
+			"json",
+			"https://hub.local/",
+			"https://rss.local/feed.json",
+		},
+		{
+			"without hub",
+			http.Header{},
+			`<rss><channel><title>No hub</title></channel></rss>`,
+			"rss",
+			"",
+			"https://rss.local/feed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, topic := discoverHub(tt.header, []byte(tt.body), &gofeed.Feed{FeedType: tt.feedType}, f)
+			if hub != tt.wantHub || topic != tt.wantTopic {
+				t.Errorf("discoverHub() got = %v %v, want %v %v", hub, topic, tt.wantHub, tt.wantTopic)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package sanitize
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Policy is an allow-list of the HTML which is kept when sanitising.
+// Elements which aren't allowed are removed but their text is kept,
+// apart from elements such as scripts whose content is removed too
+// unless the policy allows them.
+type Policy struct {
+	// Elements maps each allowed element to its allowed attributes
+	Elements map[string][]string
+
+	// Schemes allowed in links and image sources. Relative URLs are
+	// always allowed as they are resolved before being checked.
+	Schemes []string
+}
+
+// Elements removed along with everything inside them
+var dropped = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"frame":    true,
+	"frameset": true,
+	"object":   true,
+	"embed":    true,
+	"applet":   true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"math":     true,
+	"head":     true,
+	"title":    true,
+	"textarea": true,
+	"select":   true,
+}
+
+// Elements which never have any content or end tag
+var void = map[string]bool{
+	"area":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// Attributes which hold a URL
+var urlAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"cite":   true,
+	"poster": true,
+}
+
+// DefaultPolicy returns a policy which keeps text formatting, links,
+// lists, tables, images, audio and video
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Elements: map[string][]string{
+			"a":          {"href", "title"},
+			"abbr":       {"title"},
+			"audio":      {"src", "controls"},
+			"b":          nil,
+			"blockquote": {"cite"},
+			"br":         nil,
+			"caption":    nil,
+			"code":       nil,
+			"dd":         nil,
+			"del":        nil,
+			"div":        nil,
+			"dl":         nil,
+			"dt":         nil,
+			"em":         nil,
+			"figcaption": nil,
+			"figure":     nil,
+			"h1":         nil,
+			"h2":         nil,
+			"h3":         nil,
+			"h4":         nil,
+			"h5":         nil,
+			"h6":         nil,
+			"hr":         nil,
+			"i":          nil,
+			"img":        {"src", "alt", "title", "width", "height"},
+			"ins":        nil,
+			"li":         nil,
+			"ol":         {"start"},
+			"p":          nil,
+			"pre":        nil,
+			"q":          {"cite"},
+			"s":          nil,
+			"small":      nil,
+			"source":     {"src", "type"},
+			"span":       nil,
+			"strong":     nil,
+			"sub":        nil,
+			"sup":        nil,
+			"table":      nil,
+			"tbody":      nil,
+			"td":         {"colspan", "rowspan"},
+			"tfoot":      nil,
+			"th":         {"colspan", "rowspan"},
+			"thead":      nil,
+			"tr":         nil,
+			"u":          nil,
+			"ul":         nil,
+			"video":      {"src", "poster", "controls"},
+		},
+		Schemes: []string{"http", "https", "mailto"},
+	}
+}
+
+// Sanitize returns the given HTML with only the elements and attributes
+// allowed by the policy. Relative URLs are resolved against the given
+// base, which may be nil, and tracking pixels are removed.
+func (p *Policy) Sanitize(s string, base *url.URL) string {
+	clean, _ := p.SanitizeRemoved(s, base)
+	return clean
+}
+
+// SanitizeRemoved sanitises HTML like Sanitize and also reports whether
+// anything was removed from it. HTML which was only normalised, such as
+// by escaping its text or closing its elements, was not removed from.
+func (p *Policy) SanitizeRemoved(s string, base *url.URL) (string, bool) {
+	var b bytes.Buffer
+	removed := false
+
+	// Allowed elements which are still open so that they can be closed
+	// at the end and so that stray end tags are ignored
+	open := []string{}
+
+	// Name and depth of a dropped element whose content is being skipped
+	skip := ""
+	depth := 0
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		t := z.Token()
+
+		if skip != "" {
+			removed = true
+			switch {
+			case tt == html.StartTagToken && t.Data == skip:
+				depth++
+			case tt == html.EndTagToken && t.Data == skip:
+				depth--
+				if depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.CommentToken, html.DoctypeToken:
+			removed = true
+		case html.TextToken:
+			b.WriteString(html.EscapeString(t.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			allowed, ok := p.Elements[t.Data]
+			if !ok && dropped[t.Data] {
+				removed = true
+				if tt == html.StartTagToken && !void[t.Data] {
+					skip = t.Data
+					depth = 1
+				}
+				continue
+			}
+
+			if !ok || (t.Data == "img" && trackingPixel(t)) {
+				removed = true
+				continue
+			}
+
+			attrs := p.attrs(t.Attr, allowed, base)
+			if len(attrs) != len(t.Attr) {
+				removed = true
+			}
+
+			t.Attr = attrs
+			if t.Data == "img" && !hasAttr(t, "src") {
+				continue
+			}
+
+			if void[t.Data] {
+				t.Type = html.SelfClosingTagToken
+			} else {
+				t.Type = html.StartTagToken
+				open = append(open, t.Data)
+			}
+
+			b.WriteString(t.String())
+		case html.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != t.Data {
+					continue
+				}
+
+				// Elements left open inside the closed one are closed too
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+
+				open = open[:i]
+				break
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+
+	return b.String(), removed
+}
+
+// attrs returns the allowed attributes, with URLs resolved against the
+// base. Attributes with a URL whose scheme isn't allowed are removed.
+func (p *Policy) attrs(attrs []html.Attribute, allowed []string, base *url.URL) []html.Attribute {
+	kept := []html.Attribute{}
+
+	for _, a := range attrs {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+
+		if urlAttrs[a.Key] {
+			u, ok := p.resolve(a.Val, base)
+			if !ok {
+				continue
+			}
+
+			a.Val = u
+		}
+
+		kept = append(kept, a)
+	}
+
+	return kept
+}
+
+// resolve resolves a URL against the base and reports whether its
+// scheme is allowed
+func (p *Policy) resolve(s string, base *url.URL) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", false
+	}
+
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	// Fragments and relative URLs which could not be resolved are
+	// kept as they are
+	if u.Scheme == "" {
+		return u.String(), u.Opaque == ""
+	}
+
+	for _, scheme := range p.Schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u.String(), true
+		}
+	}
+
+	return "", false
+}
+
+// trackingPixel reports whether an image is at most a pixel in size,
+// which is used to track when an article has been read
+func trackingPixel(t html.Token) bool {
+	small := func(key string) bool {
+		for _, a := range t.Attr {
+			if a.Key == key {
+				n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(a.Val), "px"))
+				return err == nil && n <= 1
+			}
+		}
+
+		return false
+	}
+
+	return small("width") && small("height")
+}
+
+func hasAttr(t html.Token, key string) bool {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
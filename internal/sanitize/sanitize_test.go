@@ -0,0 +1,130 @@
+package sanitize
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPolicy_Sanitize(t *testing.T) {
+	base, _ := url.Parse("https://mock.local/posts/1")
+
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			"allowed formatting",
+			`<p>Some <b>bold</b> and <em class="x">emphasised</em> text</p>`,
+			`<p>Some <b>bold</b> and <em>emphasised</em> text</p>`,
+		},
+		{
+			"scripts and styles",
+			`<p>Hello<script>alert("hi")</script><style>p { color: red }</style></p>`,
+			`<p>Hello</p>`,
+		},
+		{
+			"iframes and their content",
+			`<iframe src="https://evil.local"><p>Fallback</p></iframe><p>Kept</p>`,
+			`<p>Kept</p>`,
+		},
+		{
+			"event handlers",
+			`<img src="/a.png" onerror="alert(1)" alt="A">`,
+			`<img src="https://mock.local/a.png" alt="A"/>`,
+		},
+		{
+			"unknown elements keep their text",
+			`<font color="red">Red <blink>text</blink></font>`,
+			`Red text`,
+		},
+		{
+			"relative links",
+			`<a href="../about" target="_blank">About</a> <a href="#top">Top</a>`,
+			`<a href="https://mock.local/about">About</a> <a href="https://mock.local/posts/1#top">Top</a>`,
+		},
+		{
+			"javascript links",
+			`<a href="JavaScript:alert(1)">Click</a> <a href="&#106;avascript:alert(1)">Me</a>`,
+			`<a>Click</a> <a>Me</a>`,
+		},
+		{
+			"mailto links",
+			`<a href="mailto:me@mock.local">Mail</a>`,
+			`<a href="mailto:me@mock.local">Mail</a>`,
+		},
+		{
+			"tracking pixels",
+			`<p>Text<img src="https://track.local/p.gif" width="1" height="1"><img src="/b.png" width="1" height="100"></p>`,
+			`<p>Text<img src="https://mock.local/b.png" width="1" height="100"/></p>`,
+		},
+		{
+			"images without a source",
+			`<img src="data:image/png;base64,AAAA" alt="Data">`,
+			``,
+		},
+		{
+			"unclosed and stray tags",
+			`<div><p>One <b>two</p></i></div><ul><li>Three`,
+			`<div><p>One <b>two</b></p></div><ul><li>Three</li></ul>`,
+		},
+		{
+			"escaped text",
+			`1 &lt; 2 &amp;&amp; <b>"quoted"</b>`,
+			`1 &lt; 2 &amp;&amp; <b>&#34;quoted&#34;</b>`,
+		},
+		{
+			"comments",
+			`<p>Text<!-- <script>alert(1)</script> --></p>`,
+			`<p>Text</p>`,
+		},
+		{
+			"plain text",
+			`Just some text`,
+			`Just some text`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultPolicy().Sanitize(tt.html, base); got != tt.want {
+				t.Errorf("Sanitize() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Sanitize_Custom(t *testing.T) {
+	p := &Policy{
+		Elements: map[string][]string{"a": {"href"}, "iframe": {"src"}},
+		Schemes:  []string{"https"},
+	}
+
+	got := p.Sanitize(`<p><a href="http://mock.local/">Insecure</a> <a href="/relative">Relative</a><iframe src="https://video.local/1"></iframe></p>`, nil)
+	if want := `<a>Insecure</a> <a href="/relative">Relative</a><iframe src="https://video.local/1"></iframe>`; got != want {
+		t.Errorf("Sanitize() got = %v, want %v", got, want)
+	}
+}
+
+func TestPolicy_SanitizeRemoved(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want bool
+	}{
+		{"plain text", `Fish & "chips"`, false},
+		{"unclosed elements", `<p>One <b>two`, false},
+		{"relative links", `<a href="/a">A</a>`, false},
+		{"attributes", `<p class="x">Text</p>`, true},
+		{"elements", `<font>Text</font>`, true},
+		{"scripts", `Text<script>alert(1)</script>`, true},
+		{"comments", `Text<!-- hidden -->`, true},
+		{"tracking pixels", `<img src="/p.gif" width="1" height="1">`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := DefaultPolicy().SanitizeRemoved(tt.html, nil); got != tt.want {
+				t.Errorf("SanitizeRemoved() removed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package search
+
+import (
+	"github.com/google/uuid"
+	"strings"
+)
+
+// Clause is a single part of a search query. A clause with more than
+// one term is a phrase, and a clause with a single prefix term matches
+// every term starting with it.
+type Clause struct {
+	Terms  []string
+	Prefix bool
+}
+
+// Query is a parsed search query
+type Query struct {
+	Clauses []Clause
+
+	// Only return articles belonging to these feeds, if any are given
+	Feeds []uuid.UUID
+
+	// Maximum number of results to return, 0 returns all results
+	Limit uint
+}
+
+// ParseQuery parses a search query. Words in double quotes are
+// matched as a phrase and a word ending in * matches any word
+// starting with it, e.g. `"climate change" elect*`.
+func ParseQuery(q string) (Query, error) {
+	query := Query{}
+
+	for n, part := range strings.Split(q, `"`) {
+
+		// Every odd part of the query was inside double quotes
+		if n%2 == 1 {
+			if terms := Tokenize(part); len(terms) > 0 {
+				query.Clauses = append(query.Clauses, Clause{Terms: terms})
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			terms := Tokenize(word)
+
+			// Only the last term of a word such as e-mail* is a prefix
+			for n, term := range terms {
+				query.Clauses = append(query.Clauses, Clause{
+					Terms:  []string{term},
+					Prefix: prefix && n == len(terms)-1,
+				})
+			}
+		}
+	}
+
+	if len(query.Clauses) == 0 {
+		return query, ErrEmptyQuery
+	}
+
+	return query, nil
+}
@@ -0,0 +1,357 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/uuid"
+	"html"
+	"math"
+	"reader/internal/feed"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("empty search query")
+
+// Ranking parameters for BM25. Terms found in an article's title
+// count more than those found in its description.
+const (
+	k1          = 1.2
+	b           = 0.75
+	titleWeight = 2
+)
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// Tokenize splits given text into lower case terms. HTML tags are
+// removed and entities decoded as descriptions commonly contain HTML.
+func Tokenize(text string) []string {
+	text = html.UnescapeString(tagPattern.ReplaceAllString(text, " "))
+
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// posting records where a term appears in a single article
+type posting struct {
+	title     int
+	positions []int
+}
+
+// document is an indexed article. The same article can be in more than
+// one feed, so a document belongs to every feed it was added to.
+type document struct {
+	feeds     map[uuid.UUID]bool
+	published time.Time
+	length    int
+	terms     []string
+}
+
+// Index is an inverted index over the title and description of
+// articles. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[uuid.UUID]*posting
+	docs     map[uuid.UUID]*document
+	length   int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[uuid.UUID]*posting{},
+		docs:     map[uuid.UUID]*document{},
+	}
+}
+
+// Add will index the given article as belonging to the given feed.
+// An article which is already indexed is re-indexed and keeps the other
+// feeds it belongs to.
+func (i *Index) Add(feedID uuid.UUID, a *feed.Article) {
+	id := a.UUID()
+
+	title := Tokenize(a.Title)
+	description := Tokenize(a.Description)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	feeds := map[uuid.UUID]bool{}
+	if d, ok := i.docs[id]; ok {
+		feeds = d.feeds
+	}
+	feeds[feedID] = true
+
+	i.remove(id)
+
+	d := &document{
+		feeds:     feeds,
+		published: a.Published,
+		length:    len(title) + len(description),
+	}
+
+	add := func(term string, position int, inTitle bool) {
+		docs, ok := i.postings[term]
+		if !ok {
+			docs = map[uuid.UUID]*posting{}
+			i.postings[term] = docs
+		}
+
+		p, ok := docs[id]
+		if !ok {
+			p = &posting{}
+			docs[id] = p
+			d.terms = append(d.terms, term)
+		}
+
+		p.positions = append(p.positions, position)
+		if inTitle {
+			p.title++
+		}
+	}
+
+	for pos, term := range title {
+		add(term, pos, true)
+	}
+
+	// Leave a gap between title and description positions so that
+	// phrases never match across the two.
+	offset := len(title) + 1
+	for pos, term := range description {
+		add(term, offset+pos, false)
+	}
+
+	i.docs[id] = d
+	i.length += d.length
+}
+
+// Remove will remove the article with the given UUID from the given
+// feed. The article is removed from the index once it is in no feeds.
+func (i *Index) Remove(feedID uuid.UUID, id uuid.UUID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	d, ok := i.docs[id]
+	if !ok {
+		return
+	}
+
+	delete(d.feeds, feedID)
+	if len(d.feeds) == 0 {
+		i.remove(id)
+	}
+}
+
+// Move will change the feed an indexed article belongs to from one feed
+// to another
+func (i *Index) Move(id uuid.UUID, from uuid.UUID, to uuid.UUID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if d, ok := i.docs[id]; ok && d.feeds[from] {
+		delete(d.feeds, from)
+		d.feeds[to] = true
+	}
+}
+
+func (i *Index) remove(id uuid.UUID) {
+	d, ok := i.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range d.terms {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+
+	i.length -= d.length
+	delete(i.docs, id)
+}
+
+// Result is a single matching article along with its relevance score
+type Result struct {
+	Article uuid.UUID
+	Feed    uuid.UUID
+	Score   float64
+}
+
+// Search returns the UUIDs of all articles matching the given query,
+// most relevant first. Every term, prefix and phrase of the query
+// must match for an article to be returned.
+func (i *Index) Search(q Query) []Result {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if len(q.Clauses) == 0 || len(i.docs) == 0 {
+		return []Result{}
+	}
+
+	feeds := map[uuid.UUID]bool{}
+	for _, f := range q.Feeds {
+		feeds[f] = true
+	}
+
+	var scores map[uuid.UUID]float64
+	for _, c := range q.Clauses {
+		cs := i.clause(c)
+
+		// Intersect with the scores of the previous clauses
+		if scores == nil {
+			scores = cs
+			continue
+		}
+
+		for id, s := range scores {
+			if n, ok := cs[id]; ok {
+				scores[id] = s + n
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := []Result{}
+	for id, s := range scores {
+		f, ok := i.docs[id].feedIn(feeds)
+		if !ok {
+			continue
+		}
+
+		results = append(results, Result{Article: id, Feed: f, Score: s})
+	}
+
+	// Sort by relevance, falling back to the newest article first
+	sort.Slice(results, func(x, y int) bool {
+		if results[x].Score != results[y].Score {
+			return results[x].Score > results[y].Score
+		}
+
+		return i.docs[results[x].Article].published.After(i.docs[results[y].Article].published)
+	})
+
+	if q.Limit > 0 && uint(len(results)) > q.Limit {
+		results = results[:q.Limit]
+	}
+
+	return results
+}
+
+// feedIn returns a feed the document belongs to which is one of the
+// given feeds, or any of its feeds when none are given. The feed with the
+// lowest UUID is returned so that results are always the same.
+func (d *document) feedIn(feeds map[uuid.UUID]bool) (uuid.UUID, bool) {
+	var found uuid.UUID
+	ok := false
+
+	for f := range d.feeds {
+		if len(feeds) > 0 && !feeds[f] {
+			continue
+		}
+
+		if !ok || bytes.Compare(f[:], found[:]) < 0 {
+			found = f
+			ok = true
+		}
+	}
+
+	return found, ok
+}
+
+// clause scores every article matching a single clause
+func (i *Index) clause(c Clause) map[uuid.UUID]float64 {
+	scores := map[uuid.UUID]float64{}
+
+	switch {
+	case len(c.Terms) > 1:
+		for id := range i.phrase(c.Terms) {
+			for _, term := range c.Terms {
+				scores[id] += i.score(term, id)
+			}
+		}
+	case c.Prefix:
+		for term, docs := range i.postings {
+			if !strings.HasPrefix(term, c.Terms[0]) {
+				continue
+			}
+
+			for id := range docs {
+				scores[id] += i.score(term, id)
+			}
+		}
+	default:
+		for id := range i.postings[c.Terms[0]] {
+			scores[id] = i.score(c.Terms[0], id)
+		}
+	}
+
+	return scores
+}
+
+// phrase returns all articles where the given terms appear in order
+func (i *Index) phrase(terms []string) map[uuid.UUID]bool {
+	matches := map[uuid.UUID]bool{}
+
+	for id, first := range i.postings[terms[0]] {
+		for _, start := range first.positions {
+			if i.follows(id, terms[1:], start) {
+				matches[id] = true
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// follows reports whether the given terms appear in article id
+// directly after the given position.
+func (i *Index) follows(id uuid.UUID, terms []string, position int) bool {
+	for n, term := range terms {
+		p, ok := i.postings[term][id]
+		if !ok {
+			return false
+		}
+
+		found := false
+		for _, pos := range p.positions {
+			if pos == position+n+1 {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// score calculates the BM25 score of a term for a single article
+func (i *Index) score(term string, id uuid.UUID) float64 {
+	docs := i.postings[term]
+	p, ok := docs[id]
+	if !ok {
+		return 0
+	}
+
+	n := float64(len(i.docs))
+	df := float64(len(docs))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	tf := float64(len(p.positions) + (titleWeight-1)*p.title)
+	avg := float64(i.length) / n
+	if avg == 0 {
+		avg = 1
+	}
+
+	return idf * (tf * (k1 + 1)) / (tf + k1*(1-b+b*float64(i.docs[id].length)/avg))
+}
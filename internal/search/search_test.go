@@ -0,0 +1,192 @@
+package search
+
+import (
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"words", "Hello World", []string{"hello", "world"}},
+		{"punctuation", "e-mail, isn't it?", []string{"e", "mail", "isn", "t", "it"}},
+		{"html", "<p>Breaking <b>news</b> &amp; more</p>", []string{"breaking", "news", "more"}},
+		{"empty", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.text)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       string
+		want    []Clause
+		wantErr bool
+	}{
+		{
+			"terms",
+			"climate Change",
+			[]Clause{{Terms: []string{"climate"}}, {Terms: []string{"change"}}},
+			false,
+		},
+		{
+			"phrase and prefix",
+			`"climate change" elect*`,
+			[]Clause{{Terms: []string{"climate", "change"}}, {Terms: []string{"elect"}, Prefix: true}},
+			false,
+		},
+		{
+			"prefix on hyphenated word",
+			"e-ma*",
+			[]Clause{{Terms: []string{"e"}}, {Terms: []string{"ma"}, Prefix: true}},
+			false,
+		},
+		{
+			"empty",
+			`  "" * `,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuery(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got.Clauses, tt.want) {
+				t.Errorf("ParseQuery() = %v, want %v", got.Clauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	f1 := feed.UUIDFromString("https://one.local")
+	f2 := feed.UUIDFromString("https://two.local")
+
+	a1 := &feed.Article{
+		Link:        "https://one.local/1",
+		Title:       "Election results",
+		Description: "The general election results are in",
+		Published:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	a2 := &feed.Article{
+		Link:        "https://one.local/2",
+		Title:       "Weather",
+		Description: "Results of the election may be affected by rain",
+		Published:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	a3 := &feed.Article{
+		Link:        "https://two.local/1",
+		Title:       "Electric cars",
+		Description: "Sales of electric cars continue to grow",
+		Published:   time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	i := NewIndex()
+	i.Add(f1, a1)
+	i.Add(f1, a2)
+	i.Add(f2, a3)
+
+	tests := []struct {
+		name  string
+		q     string
+		feeds []uuid.UUID
+		want  []uuid.UUID
+	}{
+		{"term ranked by relevance", "election", nil, []uuid.UUID{a1.UUID(), a2.UUID()}},
+		{"all terms must match", "election rain", nil, []uuid.UUID{a2.UUID()}},
+		{"phrase", `"election results"`, nil, []uuid.UUID{a1.UUID()}},
+		{"phrase does not cross title and description", `"weather results"`, nil, []uuid.UUID{}},
+		{"prefix", "elect*", nil, []uuid.UUID{a3.UUID(), a1.UUID(), a2.UUID()}},
+		{"prefix within feed", "elect*", []uuid.UUID{f2}, []uuid.UUID{a3.UUID()}},
+		{"no matches", "football", nil, []uuid.UUID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuery(tt.q)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			q.Feeds = tt.feeds
+
+			got := []uuid.UUID{}
+			for _, r := range i.Search(q) {
+				got = append(got, r.Article)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_Remove(t *testing.T) {
+	a := &feed.Article{Link: "https://one.local/1", Title: "Election results"}
+
+	i := NewIndex()
+	i.Add(feed.UUIDFromString("https://one.local"), a)
+
+	// Re-indexing an article must not leave its old terms behind
+	a.Title = "Weather"
+	i.Add(feed.UUIDFromString("https://one.local"), a)
+
+	if got := i.Search(Query{Clauses: []Clause{{Terms: []string{"election"}}}}); len(got) != 0 {
+		t.Errorf("Search() after re-index = %v, want no results", got)
+	}
+
+	i.Remove(feed.UUIDFromString("https://one.local"), a.UUID())
+
+	if len(i.postings) != 0 || len(i.docs) != 0 || i.length != 0 {
+		t.Errorf("index not empty after Remove()")
+	}
+}
+
+func TestIndex_SharedArticle(t *testing.T) {
+	one := feed.UUIDFromString("https://one.local")
+	two := feed.UUIDFromString("https://two.local")
+	a := &feed.Article{Link: "https://news.local/1", Title: "Election results"}
+
+	i := NewIndex()
+	i.Add(one, a)
+	i.Add(two, a)
+
+	q := Query{Clauses: []Clause{{Terms: []string{"election"}}}, Feeds: []uuid.UUID{two}}
+	if got := i.Search(q); len(got) != 1 || got[0].Feed != two {
+		t.Errorf("Search() of second feed = %v, want article in %v", got, two)
+	}
+
+	// Removing the article from one feed keeps it in the other
+	i.Remove(one, a.UUID())
+
+	if got := i.Search(q); len(got) != 1 {
+		t.Errorf("Search() after Remove() from other feed = %v, want article", got)
+	}
+
+	i.Remove(two, a.UUID())
+
+	if len(i.docs) != 0 {
+		t.Errorf("index not empty after Remove() from every feed")
+	}
+}
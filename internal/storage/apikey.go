@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// Scope is what an API key is allowed to do
+type Scope string
+
+const (
+	// ScopeRead allows reading feeds and articles
+	ScopeRead Scope = "read"
+
+	// ScopeWrite allows changing subscriptions and article state
+	ScopeWrite Scope = "write"
+
+	// ScopeAdmin allows managing users and API keys
+	ScopeAdmin Scope = "admin"
+)
+
+// APIKey identifies the user making a request. The key itself is never
+// stored, only its hash, so that a leaked database does not leak keys.
+type APIKey struct {
+	UUID      uuid.UUID
+	Name      string
+	User      uuid.UUID
+	Scopes    []Scope
+	Hash      string
+	CreatedAt time.Time
+}
+
+// Allows reports whether the key grants the given scope. Write access
+// implies read access and admin access implies every other scope.
+func (k *APIKey) Allows(scope Scope) bool {
+	for _, s := range k.Scopes {
+		switch {
+		case s == scope, s == ScopeAdmin:
+			return true
+		case s == ScopeWrite && scope == ScopeRead:
+			return true
+		}
+	}
+
+	return false
+}
+
+// HashAPIKey returns the hash an API key is stored and looked up by
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// sortAPIKeys sorts API keys by when they were created, oldest first
+func sortAPIKeys(keys []*APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+}
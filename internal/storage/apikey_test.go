@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestAPIKey_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []Scope
+		scope  Scope
+		want   bool
+	}{
+		{"read allows read", []Scope{ScopeRead}, ScopeRead, true},
+		{"read does not allow write", []Scope{ScopeRead}, ScopeWrite, false},
+		{"write allows read", []Scope{ScopeWrite}, ScopeRead, true},
+		{"write does not allow admin", []Scope{ScopeWrite}, ScopeAdmin, false},
+		{"admin allows write", []Scope{ScopeAdmin}, ScopeWrite, true},
+		{"no scopes", nil, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &APIKey{Scopes: tt.scopes}
+			if got := k.Allows(tt.scope); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorage_APIKeys(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			k1 := &APIKey{UUID: uuid.New(), Name: "first", Scopes: []Scope{ScopeRead}, Hash: HashAPIKey("first"), CreatedAt: now}
+			k2 := &APIKey{UUID: uuid.New(), Name: "second", Scopes: []Scope{ScopeWrite}, Hash: HashAPIKey("second"), CreatedAt: now.Add(time.Second)}
+
+			for _, k := range []*APIKey{k2, k1} {
+				if err := s.AddAPIKey(k); err != nil {
+					t.Fatalf("AddAPIKey() error = %v", err)
+				}
+			}
+
+			got, err := s.APIKey(HashAPIKey("second"))
+			if err != nil {
+				t.Fatalf("APIKey() error = %v", err)
+			}
+
+			if got.UUID != k2.UUID || !got.Allows(ScopeWrite) {
+				t.Errorf("APIKey() got = %+v, want %+v", got, k2)
+			}
+
+			if _, err := s.APIKey(HashAPIKey("oops")); err != ErrAPIKeyNotFound {
+				t.Errorf("APIKey() of unknown key error = %v, want %v", err, ErrAPIKeyNotFound)
+			}
+
+			keys, err := s.APIKeys()
+			if err != nil {
+				t.Fatalf("APIKeys() error = %v", err)
+			}
+
+			if len(keys) != 2 || keys[0].UUID != k1.UUID || keys[1].UUID != k2.UUID {
+				t.Errorf("APIKeys() got = %v, want oldest first", keys)
+			}
+
+			if err := s.DeleteAPIKey(k1.UUID); err != nil {
+				t.Fatalf("DeleteAPIKey() error = %v", err)
+			}
+
+			if err := s.DeleteAPIKey(k1.UUID); err != ErrAPIKeyNotFound {
+				t.Errorf("DeleteAPIKey() twice error = %v, want %v", err, ErrAPIKeyNotFound)
+			}
+
+			if _, err := s.APIKey(k1.Hash); err != ErrAPIKeyNotFound {
+				t.Errorf("APIKey() of deleted key error = %v, want %v", err, ErrAPIKeyNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,1673 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/search"
+	"time"
+)
+
+var (
+	feedsBucket         = []byte("feeds")
+	articlesBucket      = []byte("articles")
+	articleIndexBucket  = []byte("article_index")
+	evictedBucket       = []byte("evicted")
+	usersBucket         = []byte("users")
+	apiKeysBucket       = []byte("api_keys")
+	subscriptionsBucket = []byte("subscriptions")
+	foldersBucket       = []byte("folders")
+	webhooksBucket      = []byte("webhooks")
+	deliveriesBucket    = []byte("deliveries")
+	statesBucket        = []byte("states")
+)
+
+// boltFeed is the on-disk representation of a feed. The feed link
+// is kept as a plain string so that it can be parsed back into a URL.
+type boltFeed struct {
+	feed.JSONFeed
+	FeedLink string
+	ID       uuid.UUID
+}
+
+// boltArticle is the on-disk representation of an article. Unlike the
+// API representation we must keep the GUID as the article UUID is
+// derived from it.
+type boltArticle struct {
+	feed.JSONArticle
+	GUID           string
+	RawDescription string `json:",omitempty"`
+	RawContent     string `json:",omitempty"`
+
+	// State belongs to each user and is kept in the states bucket, not
+	// with the article every user shares. These hide the fields of the
+	// embedded state so they are never encoded, and ignore any state
+	// stored with articles before.
+	Read     *bool `json:",omitempty"`
+	Starred  *bool `json:",omitempty"`
+	Position *uint `json:",omitempty"`
+}
+
+// BoltStorage is a durable storage backend which keeps feeds and
+// articles in a single bolt database file so that they survive restarts.
+type BoltStorage struct {
+	db *bolt.DB
+
+	// Minimum number articles to show when viewing latest.
+	// See InMemoryStorage for why this is a minimum.
+	minLatest uint
+
+	// Full text index of all stored articles. The index is kept in
+	// memory and rebuilt from the database when it is opened.
+	index *search.Index
+
+	// Hooks called when articles are added
+	*hooks
+}
+
+func NewBoltStorage(path string, maxLatest uint) (*BoltStorage, error) {
+	if maxLatest == 0 {
+		maxLatest = 10
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure all top level buckets exist so that read only
+	// transactions can rely on them.
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{feedsBucket, articlesBucket, articleIndexBucket, evictedBucket, usersBucket, apiKeysBucket, subscriptionsBucket, foldersBucket, webhooksBucket, deliveriesBucket, statesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return migrateIndex(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &BoltStorage{
+		db:        db,
+		minLatest: maxLatest,
+		index:     search.NewIndex(),
+		hooks:     &hooks{},
+	}
+
+	if err := s.buildIndex(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// buildIndex adds every stored article to the search index
+func (s *BoltStorage) buildIndex() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		articles := tx.Bucket(articlesBucket)
+
+		return articles.ForEach(func(k, v []byte) error {
+			fid, err := uuid.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			a, err := decodeArticles(articles.Bucket(k))
+			if err != nil {
+				return err
+			}
+
+			for _, article := range a {
+				s.index.Add(fid, article)
+			}
+
+			return nil
+		})
+	})
+}
+
+// Close will release the underlying database file.
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStorage) Store(f *feed.Feed, articles []*feed.Article) error {
+	id := f.UUID()
+	c := Change{Feed: id}
+	seen := time.Now()
+
+	// Articles as they were stored, with their published time filled in
+	var stored []*feed.Article
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		// Retried transactions must not report articles twice
+		c.Added, c.Updated = nil, nil
+		stored = make([]*feed.Article, 0, len(articles))
+
+		v, err := encodeFeed(f)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(feedsBucket).Put(id[:], v); err != nil {
+			return err
+		}
+
+		ab, err := tx.Bucket(articlesBucket).CreateBucketIfNotExists(id[:])
+		if err != nil {
+			return err
+		}
+
+		index := tx.Bucket(articleIndexBucket)
+
+		evicted, err := keepEvicted(tx, id, articles)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range articles {
+			aid := a.UUID()
+			if evicted[aid] {
+				continue
+			}
+
+			prev := ab.Get(aid[:])
+			if prev != nil && a.Published.IsZero() {
+				// An article which can't be decoded is replaced
+				pa, _ := decodeArticle(prev)
+				a = withPublished(pa, a, seen)
+			} else {
+				a = withPublished(nil, a, seen)
+			}
+
+			stored = append(stored, a)
+
+			v, err := encodeArticle(a)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case prev == nil:
+				c.Added = append(c.Added, aid)
+			case !bytes.Equal(prev, v):
+				c.Updated = append(c.Updated, aid)
+			}
+
+			if err := ab.Put(aid[:], v); err != nil {
+				return err
+			}
+
+			if err := index.Put(indexKey(aid[:], id[:]), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only index articles once they have been written to disk
+	for _, a := range stored {
+		s.index.Add(id, a)
+	}
+
+	s.notify(c)
+
+	return nil
+}
+
+// keepEvicted returns which of the given articles of a feed were evicted
+// by compaction. Articles are only kept evicted while they are still in
+// the feed, once they have left it they are forgotten.
+func keepEvicted(tx *bolt.Tx, id uuid.UUID, articles []*feed.Article) (map[uuid.UUID]bool, error) {
+	evicted := map[uuid.UUID]bool{}
+
+	b := tx.Bucket(evictedBucket).Bucket(id[:])
+	if b == nil || len(articles) == 0 {
+		return evicted, nil
+	}
+
+	for _, a := range articles {
+		aid := a.UUID()
+		if b.Get(aid[:]) != nil {
+			evicted[aid] = true
+		}
+	}
+
+	// Keys can't be deleted while iterating over the bucket
+	forgotten := [][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		if aid, err := uuid.FromBytes(k); err != nil || !evicted[aid] {
+			forgotten = append(forgotten, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range forgotten {
+		if err := b.Delete(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return evicted, nil
+}
+
+func (s *BoltStorage) Feeds() ([]*feed.Feed, error) {
+	feeds := []*feed.Feed{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(feedsBucket).ForEach(func(k, v []byte) error {
+			f, err := decodeFeed(v)
+			if err != nil {
+				return err
+			}
+
+			feeds = append(feeds, f)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFeeds(feeds)
+
+	return feeds, nil
+}
+
+func (s *BoltStorage) Feed(id uuid.UUID) (*feed.Feed, error) {
+	var f *feed.Feed
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(feedsBucket).Get(id[:])
+		if v == nil {
+			return ErrFeedNotFound
+		}
+
+		var err error
+		f, err = decodeFeed(v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// UpdateFeed will replace the feed with the given UUID. As a feed UUID
+// is derived from its feed link, any stored articles and subscriptions
+// are moved over to the UUID of the updated feed.
+func (s *BoltStorage) UpdateFeed(id uuid.UUID, updated *feed.Feed) error {
+	nid := updated.UUID()
+	moved := [][]byte{}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		feeds := tx.Bucket(feedsBucket)
+		if feeds.Get(id[:]) == nil {
+			return ErrFeedNotFound
+		}
+
+		if nid != id && feeds.Get(nid[:]) != nil {
+			return ErrFeedExists
+		}
+
+		v, err := encodeFeed(updated)
+		if err != nil {
+			return err
+		}
+
+		if err := feeds.Put(nid[:], v); err != nil {
+			return err
+		}
+
+		if nid == id {
+			return nil
+		}
+
+		articles := tx.Bucket(articlesBucket)
+		index := tx.Bucket(articleIndexBucket)
+
+		nb, err := articles.CreateBucketIfNotExists(nid[:])
+		if err != nil {
+			return err
+		}
+
+		if ob := articles.Bucket(id[:]); ob != nil {
+			err := ob.ForEach(func(k, v []byte) error {
+				if err := nb.Put(k, v); err != nil {
+					return err
+				}
+
+				moved = append(moved, append([]byte{}, k...))
+				if err := index.Delete(indexKey(k, id[:])); err != nil {
+					return err
+				}
+
+				return index.Put(indexKey(k, nid[:]), []byte{})
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := articles.DeleteBucket(id[:]); err != nil {
+				return err
+			}
+		}
+
+		if err := moveEvicted(tx, id, nid); err != nil {
+			return err
+		}
+
+		err = forEachBucket(tx.Bucket(subscriptionsBucket), func(b *bolt.Bucket) error {
+			folder := b.Get(id[:])
+			if folder == nil {
+				return nil
+			}
+
+			if err := b.Put(nid[:], append([]byte{}, folder...)); err != nil {
+				return err
+			}
+
+			return b.Delete(id[:])
+		})
+		if err != nil {
+			return err
+		}
+
+		return feeds.Delete(id[:])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range moved {
+		if aid, err := uuid.FromBytes(k); err == nil {
+			s.index.Move(aid, id, nid)
+		}
+	}
+
+	return nil
+}
+
+// moveEvicted moves the articles evicted from a feed over to the new
+// UUID of the feed
+func moveEvicted(tx *bolt.Tx, id uuid.UUID, nid uuid.UUID) error {
+	evicted := tx.Bucket(evictedBucket)
+
+	ob := evicted.Bucket(id[:])
+	if ob == nil {
+		return nil
+	}
+
+	nb, err := evicted.CreateBucketIfNotExists(nid[:])
+	if err != nil {
+		return err
+	}
+
+	err = ob.ForEach(func(k, v []byte) error {
+		return nb.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return evicted.DeleteBucket(id[:])
+}
+
+// DeleteFeed will remove the feed with the given UUID along with
+// all of its articles and subscriptions.
+func (s *BoltStorage) DeleteFeed(id uuid.UUID) error {
+	removed := []uuid.UUID{}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		feeds := tx.Bucket(feedsBucket)
+		if feeds.Get(id[:]) == nil {
+			return ErrFeedNotFound
+		}
+
+		if err := feeds.Delete(id[:]); err != nil {
+			return err
+		}
+
+		err := forEachBucket(tx.Bucket(subscriptionsBucket), func(b *bolt.Bucket) error {
+			return b.Delete(id[:])
+		})
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(evictedBucket).Bucket(id[:]) != nil {
+			if err := tx.Bucket(evictedBucket).DeleteBucket(id[:]); err != nil {
+				return err
+			}
+		}
+
+		articles := tx.Bucket(articlesBucket)
+		b := articles.Bucket(id[:])
+		if b == nil {
+			return nil
+		}
+
+		index := tx.Bucket(articleIndexBucket)
+		err = b.ForEach(func(k, v []byte) error {
+			if aid, err := uuid.FromBytes(k); err == nil {
+				removed = append(removed, aid)
+			}
+
+			if err := index.Delete(indexKey(k, id[:])); err != nil {
+				return err
+			}
+
+			// Articles which are still in other feeds keep their state
+			if len(articleFeeds(tx, k)) > 0 {
+				return nil
+			}
+
+			return deleteStates(tx, k)
+		})
+		if err != nil {
+			return err
+		}
+
+		return articles.DeleteBucket(id[:])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, aid := range removed {
+		s.index.Remove(id, aid)
+	}
+
+	return nil
+}
+
+// AddUser will store a new user
+func (s *BoltStorage) AddUser(u *User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		if users.Get(u.UUID[:]) != nil {
+			return ErrUserExists
+		}
+
+		v, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+
+		return users.Put(u.UUID[:], v)
+	})
+}
+
+func (s *BoltStorage) User(id uuid.UUID) (*User, error) {
+	var u User
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(usersBucket).Get(id[:])
+		if v == nil {
+			return ErrUserNotFound
+		}
+
+		return json.Unmarshal(v, &u)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// AddAPIKey will store a new API key
+func (s *BoltStorage) AddAPIKey(k *APIKey) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(apiKeysBucket).Put([]byte(k.Hash), v)
+	})
+}
+
+// APIKey returns the API key with the given hash
+func (s *BoltStorage) APIKey(hash string) (*APIKey, error) {
+	var k APIKey
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(apiKeysBucket).Get([]byte(hash))
+		if v == nil {
+			return ErrAPIKeyNotFound
+		}
+
+		return json.Unmarshal(v, &k)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
+
+// APIKeys returns every stored API key, oldest first
+func (s *BoltStorage) APIKeys() ([]*APIKey, error) {
+	keys := []*APIKey{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(k, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+
+			keys = append(keys, &key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortAPIKeys(keys)
+
+	return keys, nil
+}
+
+// DeleteAPIKey will remove the API key with the given UUID
+func (s *BoltStorage) DeleteAPIKey(id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(apiKeysBucket)
+
+		var hash []byte
+		err := keys.ForEach(func(k, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+
+			if key.UUID == id {
+				hash = append([]byte{}, k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if hash == nil {
+			return ErrAPIKeyNotFound
+		}
+
+		return keys.Delete(hash)
+	})
+}
+
+// AddWebhook will store a new webhook
+func (s *BoltStorage) AddWebhook(w *Webhook) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(webhooksBucket).Put(w.UUID[:], v)
+	})
+}
+
+// Webhooks returns every stored webhook, oldest first
+func (s *BoltStorage) Webhooks() ([]*Webhook, error) {
+	hooks := []*Webhook{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(k, v []byte) error {
+			var w Webhook
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+
+			hooks = append(hooks, &w)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortWebhooks(hooks)
+
+	return hooks, nil
+}
+
+func (s *BoltStorage) Webhook(id uuid.UUID) (*Webhook, error) {
+	var w Webhook
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(webhooksBucket).Get(id[:])
+		if v == nil {
+			return ErrWebhookNotFound
+		}
+
+		return json.Unmarshal(v, &w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// DeleteWebhook will remove a webhook along with its deliveries
+func (s *BoltStorage) DeleteWebhook(id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		hooks := tx.Bucket(webhooksBucket)
+		if hooks.Get(id[:]) == nil {
+			return ErrWebhookNotFound
+		}
+
+		deliveries := tx.Bucket(deliveriesBucket)
+		if deliveries.Bucket(id[:]) != nil {
+			if err := deliveries.DeleteBucket(id[:]); err != nil {
+				return err
+			}
+		}
+
+		return hooks.Delete(id[:])
+	})
+}
+
+// AddDelivery will store an attempt at delivering to a webhook. Only
+// the most recent attempts are kept.
+func (s *BoltStorage) AddDelivery(d *Delivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(webhooksBucket).Get(d.Webhook[:]) == nil {
+			return ErrWebhookNotFound
+		}
+
+		b, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists(d.Webhook[:])
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+
+		// Deliveries are keyed by sequence so that they are kept in the
+		// order they were added
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, seq)
+
+		if err := b.Put(k, v); err != nil {
+			return err
+		}
+
+		// Remove the oldest attempts once there are too many
+		c := b.Cursor()
+
+		n := 0
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			n++
+		}
+
+		for ; n > maxDeliveries; n-- {
+			k, _ := c.First()
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Deliveries returns the most recent attempts at delivering to a
+// webhook, newest first
+func (s *BoltStorage) Deliveries(id uuid.UUID) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(webhooksBucket).Get(id[:]) == nil {
+			return ErrWebhookNotFound
+		}
+
+		b := tx.Bucket(deliveriesBucket).Bucket(id[:])
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+
+			deliveries = append(deliveries, &d)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newestFirst(deliveries), nil
+}
+
+// Subscribe will subscribe the given user to a stored feed
+func (s *BoltStorage) Subscribe(user uuid.UUID, id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(feedsBucket).Get(id[:]) == nil {
+			return ErrFeedNotFound
+		}
+
+		b, err := tx.Bucket(subscriptionsBucket).CreateBucketIfNotExists(user[:])
+		if err != nil {
+			return err
+		}
+
+		if b.Get(id[:]) != nil {
+			return ErrSubscribed
+		}
+
+		return b.Put(id[:], []byte{})
+	})
+}
+
+// Unsubscribe will remove a feed from the subscriptions of the given
+// user. The feed itself is kept, even when no one is subscribed to it.
+func (s *BoltStorage) Unsubscribe(user uuid.UUID, id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if !subscribed(tx, user, id[:]) {
+			return ErrFeedNotFound
+		}
+
+		return tx.Bucket(subscriptionsBucket).Bucket(user[:]).Delete(id[:])
+	})
+}
+
+// Subscriptions returns every feed the given user is subscribed to
+func (s *BoltStorage) Subscriptions(user uuid.UUID) ([]*feed.Feed, error) {
+	feeds := []*feed.Feed{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachSubscription(tx, user, func(k []byte) error {
+			v := tx.Bucket(feedsBucket).Get(k)
+			if v == nil {
+				return nil
+			}
+
+			f, err := decodeFeed(v)
+			if err != nil {
+				return err
+			}
+
+			feeds = append(feeds, f)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFeeds(feeds)
+
+	return feeds, nil
+}
+
+// Subscribers returns the UUID of every user subscribed to the given feed
+func (s *BoltStorage) Subscribers(id uuid.UUID) ([]uuid.UUID, error) {
+	users := []uuid.UUID{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(feedsBucket).Get(id[:]) == nil {
+			return ErrFeedNotFound
+		}
+
+		subscriptions := tx.Bucket(subscriptionsBucket)
+
+		return subscriptions.ForEach(func(k, v []byte) error {
+			b := subscriptions.Bucket(k)
+			if b == nil || b.Get(id[:]) == nil {
+				return nil
+			}
+
+			u, err := uuid.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			users = append(users, u)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// AddFolder will store a new folder for the given user. Folder names
+// are unique for each user.
+func (s *BoltStorage) AddFolder(user uuid.UUID, f *Folder) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(foldersBucket).CreateBucketIfNotExists(user[:])
+		if err != nil {
+			return err
+		}
+
+		if b.Get(f.UUID[:]) != nil {
+			return ErrFolderExists
+		}
+
+		err = b.ForEach(func(k, v []byte) error {
+			var existing Folder
+			if err := json.Unmarshal(v, &existing); err != nil {
+				return err
+			}
+
+			if existing.Name == f.Name {
+				return ErrFolderExists
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(Folder{UUID: f.UUID, Name: f.Name})
+		if err != nil {
+			return err
+		}
+
+		return b.Put(f.UUID[:], v)
+	})
+}
+
+// Folders returns every folder of the given user along with their feeds
+func (s *BoltStorage) Folders(user uuid.UUID) ([]*Folder, error) {
+	folders := []*Folder{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(foldersBucket).Bucket(user[:])
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			f, err := decodeFolder(tx, user, v)
+			if err != nil {
+				return err
+			}
+
+			folders = append(folders, f)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFolders(folders)
+
+	return folders, nil
+}
+
+func (s *BoltStorage) Folder(user uuid.UUID, id uuid.UUID) (*Folder, error) {
+	var f *Folder
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := folderOf(tx, user, id[:])
+		if v == nil {
+			return ErrFolderNotFound
+		}
+
+		var err error
+		f, err = decodeFolder(tx, user, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// DeleteFolder will remove a folder of the given user. The feeds
+// in the folder are kept but are no longer in any folder.
+func (s *BoltStorage) DeleteFolder(user uuid.UUID, id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if folderOf(tx, user, id[:]) == nil {
+			return ErrFolderNotFound
+		}
+
+		feeds, err := folderFeeds(tx, user, id[:])
+		if err != nil {
+			return err
+		}
+
+		subscriptions := tx.Bucket(subscriptionsBucket).Bucket(user[:])
+		for _, fid := range feeds {
+			if err := subscriptions.Put(fid[:], []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(foldersBucket).Bucket(user[:]).Delete(id[:])
+	})
+}
+
+// SetFolder will move a feed the given user is subscribed to into a
+// folder. Feeds are removed from their folder with uuid.Nil.
+func (s *BoltStorage) SetFolder(user uuid.UUID, id uuid.UUID, folder uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if !subscribed(tx, user, id[:]) {
+			return ErrFeedNotFound
+		}
+
+		v := []byte{}
+		if folder != uuid.Nil {
+			if folderOf(tx, user, folder[:]) == nil {
+				return ErrFolderNotFound
+			}
+
+			v = folder[:]
+		}
+
+		return tx.Bucket(subscriptionsBucket).Bucket(user[:]).Put(id[:], v)
+	})
+}
+
+// folderOf returns the encoded folder of a user with the given key
+func folderOf(tx *bolt.Tx, user uuid.UUID, k []byte) []byte {
+	b := tx.Bucket(foldersBucket).Bucket(user[:])
+	if b == nil {
+		return nil
+	}
+
+	return b.Get(k)
+}
+
+// folderFeeds returns the UUIDs of every feed a user has in a folder
+func folderFeeds(tx *bolt.Tx, user uuid.UUID, k []byte) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+
+	b := tx.Bucket(subscriptionsBucket).Bucket(user[:])
+	if b == nil {
+		return ids, nil
+	}
+
+	err := b.ForEach(func(fk, v []byte) error {
+		if !bytes.Equal(v, k) {
+			return nil
+		}
+
+		id, err := uuid.FromBytes(fk)
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		return nil
+	})
+
+	return ids, err
+}
+
+// decodeFolder decodes a folder and fills in its feeds
+func decodeFolder(tx *bolt.Tx, user uuid.UUID, v []byte) (*Folder, error) {
+	var f Folder
+	if err := json.Unmarshal(v, &f); err != nil {
+		return nil, err
+	}
+
+	feeds, err := folderFeeds(tx, user, f.UUID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	f.Feeds = feeds
+
+	return &f, nil
+}
+
+func (s *BoltStorage) Latest(user uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachSubscription(tx, user, func(k []byte) error {
+			b := tx.Bucket(articlesBucket).Bucket(k)
+			if b == nil {
+				return nil
+			}
+
+			a, err := filterArticles(tx, user, b, filter)
+			if err != nil {
+				return err
+			}
+
+			articles = append(articles, a...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(articles, offset, s.minLatest), nil
+}
+
+func (s *BoltStorage) LatestFromFeed(user uuid.UUID, id uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
+	var articles []*feed.Article
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(articlesBucket).Bucket(id[:])
+		if b == nil || !subscribed(tx, user, id[:]) {
+			return ErrFeedNotFound
+		}
+
+		var err error
+		articles, err = filterArticles(tx, user, b, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(articles, offset, s.minLatest), nil
+}
+
+func (s *BoltStorage) LatestFromFolder(user uuid.UUID, id uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if folderOf(tx, user, id[:]) == nil {
+			return ErrFolderNotFound
+		}
+
+		feeds, err := folderFeeds(tx, user, id[:])
+		if err != nil {
+			return err
+		}
+
+		for _, fid := range feeds {
+			b := tx.Bucket(articlesBucket).Bucket(fid[:])
+			if b == nil {
+				continue
+			}
+
+			a, err := filterArticles(tx, user, b, filter)
+			if err != nil {
+				return err
+			}
+
+			articles = append(articles, a...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(articles, offset, s.minLatest), nil
+}
+
+func (s *BoltStorage) Article(user uuid.UUID, id uuid.UUID) (*feed.Article, error) {
+	var article *feed.Article
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v, err := subscribedArticle(tx, user, id[:])
+		if err != nil {
+			return err
+		}
+
+		a, err := decodeArticle(v)
+		if err != nil {
+			return err
+		}
+
+		article = withState(a, stateOf(tx, user, id[:]))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return article, nil
+}
+
+// FeedArticle returns an article of the feed with the given UUID as it
+// is stored, regardless of who is subscribed to the feed
+func (s *BoltStorage) FeedArticle(fid uuid.UUID, id uuid.UUID) (*feed.Article, error) {
+	var article *feed.Article
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(articlesBucket).Bucket(fid[:])
+		if b == nil {
+			return ErrArticleNotFound
+		}
+
+		v := b.Get(id[:])
+		if v == nil {
+			return ErrArticleNotFound
+		}
+
+		a, err := decodeArticle(v)
+		if err != nil {
+			return err
+		}
+
+		article = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return article, nil
+}
+
+// MarkRead will mark the article with the given UUID as read or unread
+func (s *BoltStorage) MarkRead(user uuid.UUID, id uuid.UUID, read bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := subscribedArticle(tx, user, id[:]); err != nil {
+			return err
+		}
+
+		st := stateOf(tx, user, id[:])
+		st.Read = read
+		return putState(tx, user, id[:], st)
+	})
+}
+
+// Star will star or unstar the article with the given UUID
+func (s *BoltStorage) Star(user uuid.UUID, id uuid.UUID, starred bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := subscribedArticle(tx, user, id[:]); err != nil {
+			return err
+		}
+
+		st := stateOf(tx, user, id[:])
+		st.Starred = starred
+		return putState(tx, user, id[:], st)
+	})
+}
+
+// SetPosition will record how far, in seconds, the audio or video of
+// the article with the given UUID has been played
+func (s *BoltStorage) SetPosition(user uuid.UUID, id uuid.UUID, position uint) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := subscribedArticle(tx, user, id[:]); err != nil {
+			return err
+		}
+
+		st := stateOf(tx, user, id[:])
+		st.Position = position
+		return putState(tx, user, id[:], st)
+	})
+}
+
+// MarkFeedRead will mark every article of the given feed as read
+func (s *BoltStorage) MarkFeedRead(user uuid.UUID, id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(articlesBucket).Bucket(id[:])
+		if b == nil || !subscribed(tx, user, id[:]) {
+			return ErrFeedNotFound
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			st := stateOf(tx, user, k)
+			st.Read = true
+			return putState(tx, user, k, st)
+		})
+	})
+}
+
+// MarkReadBefore will mark every article published before the
+// given time as read.
+func (s *BoltStorage) MarkReadBefore(user uuid.UUID, before time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		articles := tx.Bucket(articlesBucket)
+
+		return forEachSubscription(tx, user, func(fk []byte) error {
+			b := articles.Bucket(fk)
+			if b == nil {
+				return nil
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				a, err := decodeArticle(v)
+				if err != nil {
+					return err
+				}
+
+				if !a.Published.Before(before) {
+					return nil
+				}
+
+				st := stateOf(tx, user, k)
+				st.Read = true
+				return putState(tx, user, k, st)
+			})
+		})
+	})
+}
+
+// subscribed reports whether the given user is subscribed to the feed
+// with the given key.
+func subscribed(tx *bolt.Tx, user uuid.UUID, k []byte) bool {
+	b := tx.Bucket(subscriptionsBucket).Bucket(user[:])
+	return b != nil && b.Get(k) != nil
+}
+
+// forEachSubscription calls fn with the key of every feed the given
+// user is subscribed to.
+func forEachSubscription(tx *bolt.Tx, user uuid.UUID, fn func(k []byte) error) error {
+	b := tx.Bucket(subscriptionsBucket).Bucket(user[:])
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(func(k, v []byte) error {
+		return fn(k)
+	})
+}
+
+// forEachBucket calls fn with every nested bucket of the given bucket
+func forEachBucket(b *bolt.Bucket, fn func(b *bolt.Bucket) error) error {
+	return b.ForEach(func(k, v []byte) error {
+		if nb := b.Bucket(k); nb != nil {
+			return fn(nb)
+		}
+		return nil
+	})
+}
+
+// subscribedArticle returns the encoded article with the given key as
+// long as the given user is subscribed to a feed it belongs to. The same
+// article can be in more than one feed, so every one of them is tried.
+func subscribedArticle(tx *bolt.Tx, user uuid.UUID, k []byte) ([]byte, error) {
+	for _, fid := range articleFeeds(tx, k) {
+		if !subscribed(tx, user, fid) {
+			continue
+		}
+
+		b := tx.Bucket(articlesBucket).Bucket(fid)
+		if b == nil {
+			continue
+		}
+
+		if v := b.Get(k); v != nil {
+			return v, nil
+		}
+	}
+
+	return nil, ErrArticleNotFound
+}
+
+// indexKey returns the key of the article index entry for an article in
+// a feed. The index holds an entry for every feed an article is in, made
+// of the article key followed by the feed key.
+func indexKey(article []byte, feed []byte) []byte {
+	return append(append([]byte{}, article...), feed...)
+}
+
+// articleFeeds returns the keys of every feed the article with the given
+// key is in
+func articleFeeds(tx *bolt.Tx, k []byte) [][]byte {
+	feeds := [][]byte{}
+
+	c := tx.Bucket(articleIndexBucket).Cursor()
+	for ik, _ := c.Seek(k); ik != nil && bytes.HasPrefix(ik, k); ik, _ = c.Next() {
+		if len(ik) > len(k) {
+			feeds = append(feeds, append([]byte{}, ik[len(k):]...))
+		}
+	}
+
+	return feeds
+}
+
+// migrateIndex moves article index entries from when the index mapped
+// each article to a single feed over to an entry for the article in
+// that feed
+func migrateIndex(tx *bolt.Tx) error {
+	index := tx.Bucket(articleIndexBucket)
+
+	// Keys can't be changed while iterating over the bucket
+	old := map[string][]byte{}
+	err := index.ForEach(func(k, v []byte) error {
+		if len(k) == len(uuid.UUID{}) {
+			old[string(k)] = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, fid := range old {
+		if err := index.Put(indexKey([]byte(k), fid), []byte{}); err != nil {
+			return err
+		}
+
+		if err := index.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stateOf returns the state a user has for the article with the given key
+func stateOf(tx *bolt.Tx, user uuid.UUID, k []byte) feed.State {
+	var st feed.State
+
+	b := tx.Bucket(statesBucket).Bucket(user[:])
+	if b == nil {
+		return st
+	}
+
+	if v := b.Get(k); v != nil {
+		// A state which can't be decoded is treated as no state
+		_ = json.Unmarshal(v, &st)
+	}
+
+	return st
+}
+
+// putState stores the state a user has for the article with the given
+// key. An empty state is removed rather than stored.
+func putState(tx *bolt.Tx, user uuid.UUID, k []byte, st feed.State) error {
+	if st == (feed.State{}) {
+		if b := tx.Bucket(statesBucket).Bucket(user[:]); b != nil {
+			return b.Delete(k)
+		}
+		return nil
+	}
+
+	v, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	b, err := tx.Bucket(statesBucket).CreateBucketIfNotExists(user[:])
+	if err != nil {
+		return err
+	}
+
+	return b.Put(k, v)
+}
+
+// deleteStates removes the state every user has for the article
+// with the given key.
+func deleteStates(tx *bolt.Tx, k []byte) error {
+	return forEachBucket(tx.Bucket(statesBucket), func(b *bolt.Bucket) error {
+		return b.Delete(k)
+	})
+}
+
+// starredArticles returns the UUID of every article starred by any user
+func starredArticles(tx *bolt.Tx) (map[uuid.UUID]bool, error) {
+	starred := map[uuid.UUID]bool{}
+
+	err := forEachBucket(tx.Bucket(statesBucket), func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var st feed.State
+			if err := json.Unmarshal(v, &st); err != nil || !st.Starred {
+				return nil
+			}
+
+			id, err := uuid.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			starred[id] = true
+			return nil
+		})
+	})
+
+	return starred, err
+}
+
+// Compact will remove all articles which fall outside of the given
+// retention policy. Articles starred by any user are kept and evicted
+// articles are not added again while they are still in their feed.
+func (s *BoltStorage) Compact(p RetentionPolicy) (Eviction, error) {
+	var e Eviction
+	var evict map[uuid.UUID][]uuid.UUID
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		articles := tx.Bucket(articlesBucket)
+		groups := map[uuid.UUID][]*feed.Article{}
+
+		err := articles.ForEach(func(k, v []byte) error {
+			fid, err := uuid.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			groups[fid], err = decodeArticles(articles.Bucket(k))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		starred, err := starredArticles(tx)
+		if err != nil {
+			return err
+		}
+
+		evict, e = evictions(groups, p, time.Now(), func(id uuid.UUID) bool {
+			return starred[id]
+		})
+
+		index := tx.Bucket(articleIndexBucket)
+
+		for fid, ids := range evict {
+			b := articles.Bucket(fid[:])
+
+			eb, err := tx.Bucket(evictedBucket).CreateBucketIfNotExists(fid[:])
+			if err != nil {
+				return err
+			}
+
+			for _, id := range ids {
+				if err := b.Delete(id[:]); err != nil {
+					return err
+				}
+
+				if err := eb.Put(id[:], []byte{1}); err != nil {
+					return err
+				}
+
+				if err := index.Delete(indexKey(id[:], fid[:])); err != nil {
+					return err
+				}
+
+				if len(articleFeeds(tx, id[:])) > 0 {
+					continue
+				}
+
+				if err := deleteStates(tx, id[:]); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Eviction{}, err
+	}
+
+	for fid, ids := range evict {
+		for _, id := range ids {
+			s.index.Remove(fid, id)
+		}
+	}
+
+	return e, nil
+}
+
+// Search returns all articles from the feeds the given user is subscribed
+// to which match the given query, most relevant first.
+func (s *BoltStorage) Search(user uuid.UUID, q search.Query) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		subscriptions := []uuid.UUID{}
+		err := forEachSubscription(tx, user, func(k []byte) error {
+			id, err := uuid.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			subscriptions = append(subscriptions, id)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		q.Feeds = subscribedFeeds(q.Feeds, subscriptions)
+		if len(q.Feeds) == 0 {
+			return nil
+		}
+
+		for _, r := range s.index.Search(q) {
+			b := tx.Bucket(articlesBucket).Bucket(r.Feed[:])
+			if b == nil {
+				continue
+			}
+
+			v := b.Get(r.Article[:])
+			if v == nil {
+				continue
+			}
+
+			a, err := decodeArticle(v)
+			if err != nil {
+				return err
+			}
+
+			articles = append(articles, withState(a, stateOf(tx, user, r.Article[:])))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return articles, nil
+}
+
+func encodeFeed(f *feed.Feed) ([]byte, error) {
+	return json.Marshal(boltFeed{
+		JSONFeed: feed.JSONFeed(*f),
+		FeedLink: f.FeedLink.String(),
+		ID:       f.ID,
+	})
+}
+
+func decodeFeed(v []byte) (*feed.Feed, error) {
+	var bf boltFeed
+	if err := json.Unmarshal(v, &bf); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(bf.FeedLink)
+	if err != nil {
+		return nil, err
+	}
+
+	f := feed.Feed(bf.JSONFeed)
+	f.FeedLink = u
+	f.ID = bf.ID
+
+	return &f, nil
+}
+
+func encodeArticle(a *feed.Article) ([]byte, error) {
+	return json.Marshal(boltArticle{
+		JSONArticle:    feed.JSONArticle(*a),
+		GUID:           a.GUID,
+		RawDescription: a.RawDescription,
+		RawContent:     a.RawContent,
+	})
+}
+
+func decodeArticle(v []byte) (*feed.Article, error) {
+	var ba boltArticle
+	if err := json.Unmarshal(v, &ba); err != nil {
+		return nil, err
+	}
+
+	a := feed.Article(ba.JSONArticle)
+	a.GUID = ba.GUID
+	a.RawDescription = ba.RawDescription
+	a.RawContent = ba.RawContent
+
+	return &a, nil
+}
+
+// decodeArticles decodes every article held in a feed's article bucket
+func decodeArticles(b *bolt.Bucket) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	err := b.ForEach(func(k, v []byte) error {
+		a, err := decodeArticle(v)
+		if err != nil {
+			return err
+		}
+
+		articles = append(articles, a)
+		return nil
+	})
+
+	return articles, err
+}
+
+// filterArticles returns every article in a feed's article bucket which
+// passes the given filter, with the state of the given user filled in.
+func filterArticles(tx *bolt.Tx, user uuid.UUID, b *bolt.Bucket, filter Filter) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	err := b.ForEach(func(k, v []byte) error {
+		a, err := decodeArticle(v)
+		if err != nil {
+			return err
+		}
+
+		a = withState(a, stateOf(tx, user, k))
+		if filter.match(a) {
+			articles = append(articles, a)
+		}
+
+		return nil
+	})
+
+	return articles, err
+}
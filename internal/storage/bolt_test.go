@@ -0,0 +1,707 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reader/internal/feed"
+	"reader/internal/search"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestBoltStorage(t *testing.T, latest uint) (*BoltStorage, string) {
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	path := filepath.Join(dir, "reader.db")
+	s, err := NewBoltStorage(path, latest)
+	if err != nil {
+		t.Fatalf("could not open bolt storage: %v", err)
+	}
+
+	return s, path
+}
+
+func testFeed(host string) *feed.Feed {
+	return &feed.Feed{
+		FeedLink: &url.URL{
+			Scheme: "https",
+			Host:   host,
+		},
+		Title: host,
+		Link:  "https://" + host,
+	}
+}
+
+func testArticle(link string, published time.Time) *feed.Article {
+	return &feed.Article{
+		Link:        link,
+		Published:   published,
+		Title:       link,
+		Description: "Description of " + link,
+	}
+}
+
+// articleLinks returns the links of the given articles
+func articleLinks(articles []*feed.Article) []string {
+	links := make([]string, 0, len(articles))
+	for _, a := range articles {
+		links = append(links, a.Link)
+	}
+
+	return links
+}
+
+// store will store a feed along with its articles and subscribe
+// the default user to it.
+func store(s Storage, f *feed.Feed, articles []*feed.Article) error {
+	if err := s.Store(f, articles); err != nil {
+		return err
+	}
+
+	return s.Subscribe(DefaultUser, f.UUID())
+}
+
+func TestBoltStorage_Persistence(t *testing.T) {
+	s, path := newTestBoltStorage(t, 10)
+
+	f := testFeed("mock.local")
+	f.FullContent = true
+	a := testArticle("https://mock.local/1", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	a.GUID = "guid-1"
+	a.Image = &feed.Image{Title: "Thumbnail", URL: "http://image"}
+	a.RawDescription = a.Description + "<script></script>"
+
+	if err := store(s, f, []*feed.Article{a}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err := NewBoltStorage(path, 10)
+	if err != nil {
+		t.Fatalf("could not reopen bolt storage: %v", err)
+	}
+	defer s.Close()
+
+	feeds, err := s.Feeds()
+	if err != nil {
+		t.Fatalf("Feeds() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(feeds, []*feed.Feed{f}) {
+		t.Errorf("Feeds() got = %v, want %v", feeds, []*feed.Feed{f})
+	}
+
+	got, err := s.Article(DefaultUser, a.UUID())
+	if err != nil {
+		t.Fatalf("Article() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, a) {
+		t.Errorf("Article() got = %v, want %v", got, a)
+	}
+}
+
+func TestBoltStorage_Latest(t *testing.T) {
+	t1 := time.Date(2010, 1, 1, 1, 1, 1, 0, time.UTC)
+	t2 := time.Date(2020, 1, 1, 1, 1, 1, 0, time.UTC)
+	t3 := time.Date(2020, 1, 1, 1, 1, 2, 0, time.UTC)
+
+	a1 := testArticle("https://mock.local/1", t1)
+	a2 := testArticle("https://mock.local/2", t2)
+	b1 := testArticle("https://mock2.local/1", t2)
+	b2 := testArticle("https://mock2.local/2", t3)
+
+	tests := []struct {
+		name    string
+		latest  uint
+		feed    uuid.UUID
+		offset  time.Time
+		want    []*feed.Article
+		wantErr bool
+	}{
+		{
+			"all articles",
+			10,
+			uuid.UUID{},
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			[]*feed.Article{b2, a2, b1, a1},
+			false,
+		},
+		{
+			"articles with the same published time are kept together",
+			2,
+			uuid.UUID{},
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			[]*feed.Article{b2, a2, b1},
+			false,
+		},
+		{
+			"articles before offset",
+			10,
+			uuid.UUID{},
+			t2,
+			[]*feed.Article{a1},
+			false,
+		},
+		{
+			"articles from feed",
+			10,
+			testFeed("mock2.local").UUID(),
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			[]*feed.Article{b2, b1},
+			false,
+		},
+		{
+			"articles from non-existent feed",
+			10,
+			feed.UUIDFromString("oops"),
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestBoltStorage(t, tt.latest)
+			defer s.Close()
+
+			if err := store(s, testFeed("mock.local"), []*feed.Article{a1, a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := store(s, testFeed("mock2.local"), []*feed.Article{b1, b2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			var got []*feed.Article
+			var err error
+			if tt.feed == (uuid.UUID{}) {
+				got, err = s.Latest(DefaultUser, tt.offset, Filter{})
+			} else {
+				got, err = s.LatestFromFeed(DefaultUser, tt.feed, tt.offset, Filter{})
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Latest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err != nil {
+				return
+			}
+
+			// Articles sharing a published time have no defined order
+			// so we order them by link before comparing.
+			sortByPublishedAndLink(got)
+			sortByPublishedAndLink(tt.want)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Latest() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func sortByPublishedAndLink(articles []*feed.Article) {
+	sort.SliceStable(articles, func(i, j int) bool {
+		if articles[i].Published.Equal(articles[j].Published) {
+			return articles[i].Link < articles[j].Link
+		}
+		return articles[i].Published.After(articles[j].Published)
+	})
+}
+
+func TestStorage_UpdateAndDeleteFeed(t *testing.T) {
+	a := testArticle("https://mock.local/1", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			old := testFeed("mock.local")
+			if err := store(s, old, []*feed.Article{a}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := store(s, testFeed("mock2.local"), nil); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := s.UpdateFeed(old.UUID(), testFeed("mock2.local")); err != ErrFeedExists {
+				t.Errorf("UpdateFeed() to existing feed error = %v, want %v", err, ErrFeedExists)
+			}
+
+			updated := testFeed("moved.local")
+			if err := s.UpdateFeed(old.UUID(), updated); err != nil {
+				t.Fatalf("UpdateFeed() error = %v", err)
+			}
+
+			if _, err := s.Feed(old.UUID()); err != ErrFeedNotFound {
+				t.Errorf("Feed() of old feed error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			articles, err := s.LatestFromFeed(DefaultUser, updated.UUID(), time.Now(), Filter{})
+			if err != nil {
+				t.Fatalf("LatestFromFeed() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(articles, []*feed.Article{a}) {
+				t.Errorf("LatestFromFeed() got = %v, want %v", articles, []*feed.Article{a})
+			}
+
+			if err := s.DeleteFeed(updated.UUID()); err != nil {
+				t.Fatalf("DeleteFeed() error = %v", err)
+			}
+
+			if err := s.DeleteFeed(updated.UUID()); err != ErrFeedNotFound {
+				t.Errorf("DeleteFeed() of deleted feed error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			if _, err := s.Article(DefaultUser, a.UUID()); err != ErrArticleNotFound {
+				t.Errorf("Article() of deleted feed error = %v, want %v", err, ErrArticleNotFound)
+			}
+		})
+	}
+}
+
+func TestStorage_MovedFeed(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			f := testFeed("mock.local")
+			id := f.UUID()
+			if err := store(s, f, nil); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			moved := testFeed("moved.local")
+			moved.ID = id
+			moved.Inactive = true
+			if err := s.Store(moved, nil); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			got, err := s.Feed(id)
+			if err != nil {
+				t.Fatalf("Feed() error = %v", err)
+			}
+
+			if got.UUID() != id || got.FeedLink.String() != "https://moved.local" || !got.Inactive {
+				t.Errorf("Feed() got = %v %v %v, want %v %v %v", got.UUID(), got.FeedLink, got.Inactive, id, "https://moved.local", true)
+			}
+
+			if got, err := FeedWithLink(s, "https://moved.local"); err != nil || got.UUID() != id {
+				t.Errorf("FeedWithLink() got = %v, %v, want %v", got, err, id)
+			}
+
+			if _, err := FeedWithLink(s, "https://mock.local"); err != ErrFeedNotFound {
+				t.Errorf("FeedWithLink() of old link error = %v, want %v", err, ErrFeedNotFound)
+			}
+		})
+	}
+}
+
+func TestStorage_FeedArticle(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			f := testFeed("mock.local")
+			a := testArticle("https://mock.local/1", time.Now())
+			a.ContentFetched = time.Now().Truncate(time.Second)
+
+			// Articles of feeds without subscribers are still found
+			if err := s.Store(f, []*feed.Article{a}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			got, err := s.FeedArticle(f.UUID(), a.UUID())
+			if err != nil {
+				t.Fatalf("FeedArticle() error = %v", err)
+			}
+
+			if got.UUID() != a.UUID() || !got.ContentFetched.Equal(a.ContentFetched) {
+				t.Errorf("FeedArticle() got = %v %v, want %v %v", got.UUID(), got.ContentFetched, a.UUID(), a.ContentFetched)
+			}
+
+			if _, err := s.FeedArticle(testFeed("other.local").UUID(), a.UUID()); err != ErrArticleNotFound {
+				t.Errorf("FeedArticle() of other feed error = %v, want %v", err, ErrArticleNotFound)
+			}
+		})
+	}
+}
+
+func TestStorage_FirstSeen(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			var changes []Change
+			s.OnStore(func(c Change) {
+				changes = append(changes, c)
+			})
+
+			f := testFeed("mock.local")
+			before := time.Now()
+
+			undated := testArticle("https://mock.local/undated", time.Time{})
+			if err := store(s, f, []*feed.Article{undated}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			got, err := s.Article(DefaultUser, undated.UUID())
+			if err != nil {
+				t.Fatalf("Article() error = %v", err)
+			}
+
+			seen := got.Published
+			if seen.Before(before) || seen.After(time.Now()) {
+				t.Errorf("Article() published = %v, want time first stored", seen)
+			}
+
+			if !undated.Published.IsZero() {
+				t.Errorf("stored article was modified: %v", undated.Published)
+			}
+
+			// Reading the feed again keeps the time the article was first seen
+			time.Sleep(time.Millisecond)
+			refetched := testArticle("https://mock.local/undated", time.Time{})
+			if err := s.Store(f, []*feed.Article{refetched}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			got, err = s.Article(DefaultUser, undated.UUID())
+			if err != nil {
+				t.Fatalf("Article() error = %v", err)
+			}
+
+			if !got.Published.Equal(seen) {
+				t.Errorf("Article() published after reading again = %v, want %v", got.Published, seen)
+			}
+
+			if len(changes) != 1 {
+				t.Errorf("OnStore() got %v changes, want 1", len(changes))
+			}
+
+			articles, err := s.Latest(DefaultUser, time.Now(), Filter{})
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+
+			if len(articles) != 1 || !articles[0].Published.Equal(seen) {
+				t.Errorf("Latest() got = %v, want article published at %v", articles, seen)
+			}
+		})
+	}
+}
+
+func TestBoltStorage_SearchAfterReopen(t *testing.T) {
+	s, path := newTestBoltStorage(t, 10)
+
+	a := testArticle("https://mock.local/election", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := store(s, testFeed("mock.local"), []*feed.Article{a}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err := NewBoltStorage(path, 10)
+	if err != nil {
+		t.Fatalf("could not reopen bolt storage: %v", err)
+	}
+	defer s.Close()
+
+	q, err := search.ParseQuery("elect*")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	got, err := s.Search(DefaultUser, q)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, []*feed.Article{a}) {
+		t.Errorf("Search() got = %v, want %v", got, []*feed.Article{a})
+	}
+}
+
+func TestStorage_SharedArticle(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			// Both feeds have the same article, but the user only
+			// subscribes to the second
+			first := testFeed("first.local")
+			second := testFeed("second.local")
+			a := testArticle("https://news.local/election", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			if err := s.Store(first, []*feed.Article{a}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := store(s, second, []*feed.Article{a}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if _, err := s.Article(DefaultUser, a.UUID()); err != nil {
+				t.Errorf("Article() error = %v", err)
+			}
+
+			if err := s.Star(DefaultUser, a.UUID(), true); err != nil {
+				t.Errorf("Star() error = %v", err)
+			}
+
+			q, err := search.ParseQuery("election")
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			if got, err := s.Search(DefaultUser, q); err != nil || len(got) != 1 {
+				t.Errorf("Search() got = %v, %v, want the article", got, err)
+			}
+
+			// Deleting the other feed keeps the article and its state
+			if err := s.DeleteFeed(first.UUID()); err != nil {
+				t.Fatalf("DeleteFeed() error = %v", err)
+			}
+
+			got, err := s.Article(DefaultUser, a.UUID())
+			if err != nil {
+				t.Fatalf("Article() after DeleteFeed() error = %v", err)
+			}
+
+			if !got.Starred {
+				t.Errorf("Article() after DeleteFeed() lost its state")
+			}
+
+			if got, err := s.Search(DefaultUser, q); err != nil || len(got) != 1 {
+				t.Errorf("Search() after DeleteFeed() got = %v, %v, want the article", got, err)
+			}
+		})
+	}
+}
+
+func TestBoltStorage_MigrateIndex(t *testing.T) {
+	s, path := newTestBoltStorage(t, 10)
+
+	f := testFeed("mock.local")
+	a := testArticle("https://mock.local/1", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := store(s, f, []*feed.Article{a}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Indexes used to map each article to a single feed
+	fid, aid := f.UUID(), a.UUID()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		index := tx.Bucket(articleIndexBucket)
+		if err := index.Delete(indexKey(aid[:], fid[:])); err != nil {
+			return err
+		}
+
+		return index.Put(aid[:], fid[:])
+	})
+	if err != nil {
+		t.Fatalf("could not write old index: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err = NewBoltStorage(path, 10)
+	if err != nil {
+		t.Fatalf("could not reopen bolt storage: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Article(DefaultUser, aid); err != nil {
+		t.Errorf("Article() after migration error = %v", err)
+	}
+}
+
+func TestStorage_ArticleState(t *testing.T) {
+	t1 := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			f := testFeed("mock.local")
+			a1 := testArticle("https://mock.local/1", t1)
+			a2 := testArticle("https://mock.local/2", t2)
+
+			if err := store(s, f, []*feed.Article{a1, a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := s.Star(DefaultUser, a1.UUID(), true); err != nil {
+				t.Fatalf("Star() error = %v", err)
+			}
+
+			if err := s.MarkReadBefore(DefaultUser, t2); err != nil {
+				t.Fatalf("MarkReadBefore() error = %v", err)
+			}
+
+			got, err := s.Article(DefaultUser, a1.UUID())
+			if err != nil {
+				t.Fatalf("Article() error = %v", err)
+			}
+
+			if want := (feed.State{Read: true, Starred: true}); got.State != want {
+				t.Errorf("Article() state = %+v, want %+v", got.State, want)
+			}
+
+			// Stored articles must not be changed by state
+			if a1.State != (feed.State{}) {
+				t.Errorf("stored article was modified: %+v", a1.State)
+			}
+
+			unread, err := s.LatestFromFeed(DefaultUser, f.UUID(), time.Now(), Filter{Unread: true})
+			if err != nil {
+				t.Fatalf("LatestFromFeed() error = %v", err)
+			}
+
+			if len(unread) != 1 || unread[0].Link != a2.Link {
+				t.Errorf("LatestFromFeed() unread = %v, want %v", unread, []*feed.Article{a2})
+			}
+
+			// Starred articles are kept regardless of retention policy
+			if _, err := s.Compact(RetentionPolicy{MaxTotal: 1, MaxPerFeed: 1}); err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			all, err := s.Latest(DefaultUser, time.Now(), Filter{})
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+
+			if len(all) != 2 {
+				t.Errorf("Latest() after Compact() got %v articles, want %v", len(all), 2)
+			}
+
+			if err := s.MarkFeedRead(DefaultUser, f.UUID()); err != nil {
+				t.Fatalf("MarkFeedRead() error = %v", err)
+			}
+
+			unread, err = s.Latest(DefaultUser, time.Now(), Filter{Unread: true})
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+
+			if len(unread) != 0 {
+				t.Errorf("Latest() unread after MarkFeedRead() = %v, want none", unread)
+			}
+
+			if err := s.MarkRead(DefaultUser, feed.UUIDFromString("oops"), true); err != ErrArticleNotFound {
+				t.Errorf("MarkRead() of unknown article error = %v, want %v", err, ErrArticleNotFound)
+			}
+
+			if err := s.SetPosition(DefaultUser, a2.UUID(), 90); err != nil {
+				t.Fatalf("SetPosition() error = %v", err)
+			}
+
+			got, err = s.Article(DefaultUser, a2.UUID())
+			if err != nil {
+				t.Fatalf("Article() error = %v", err)
+			}
+
+			if want := (feed.State{Read: true, Position: 90}); got.State != want {
+				t.Errorf("Article() state after SetPosition() = %+v, want %+v", got.State, want)
+			}
+
+			if err := s.SetPosition(DefaultUser, feed.UUIDFromString("oops"), 90); err != ErrArticleNotFound {
+				t.Errorf("SetPosition() of unknown article error = %v, want %v", err, ErrArticleNotFound)
+			}
+		})
+	}
+}
+
+func Test_encodeArticle(t *testing.T) {
+	a := testArticle("https://mock.local/1", time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC))
+	a.State = feed.State{Read: true, Starred: true, Position: 90}
+
+	v, err := encodeArticle(a)
+	if err != nil {
+		t.Fatalf("encodeArticle() error = %v", err)
+	}
+
+	for _, field := range []string{`"Read"`, `"Starred"`, `"Position"`} {
+		if bytes.Contains(v, []byte(field)) {
+			t.Errorf("encodeArticle() = %s, want no %v", v, field)
+		}
+	}
+
+	// State stored with articles before is ignored
+	got, err := decodeArticle([]byte(`{"Link": "https://mock.local/1", "GUID": "1", "Read": true, "Position": 90}`))
+	if err != nil {
+		t.Fatalf("decodeArticle() error = %v", err)
+	}
+
+	if got.State != (feed.State{}) {
+		t.Errorf("decodeArticle() state = %+v, want none", got.State)
+	}
+
+	// Articles which only differ by state are unchanged
+	if changed(testArticle(a.Link, a.Published), a) {
+		t.Errorf("changed() = true for articles which only differ by state")
+	}
+}
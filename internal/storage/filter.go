@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"reader/internal/feed"
+	"strings"
+)
+
+// Filter restricts which articles are returned when viewing latest
+// articles. The zero value does not filter out any articles.
+type Filter struct {
+	Unread  bool
+	Starred bool
+
+	// Category and Author only match articles with a category or an
+	// author of the same name, ignoring case
+	Category string
+	Author   string
+
+	// Media only matches articles with audio or video enclosures
+	Media bool
+}
+
+// match reports whether an article, with its state filled in,
+// passes the filter.
+func (f Filter) match(a *feed.Article) bool {
+	if f.Unread && a.Read {
+		return false
+	}
+
+	if f.Starred && !a.Starred {
+		return false
+	}
+
+	if f.Media && !a.Media() {
+		return false
+	}
+
+	if f.Category != "" && !hasCategory(a, f.Category) {
+		return false
+	}
+
+	if f.Author != "" && !hasAuthor(a, f.Author) {
+		return false
+	}
+
+	return true
+}
+
+func hasCategory(a *feed.Article, category string) bool {
+	for _, c := range a.Categories {
+		if strings.EqualFold(strings.TrimSpace(c), category) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAuthor(a *feed.Article, author string) bool {
+	for _, p := range a.Authors {
+		if strings.EqualFold(strings.TrimSpace(p.Name), author) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withState returns a copy of the given article with its state filled
+// in so that stored articles are never modified by state changes.
+func withState(a *feed.Article, st feed.State) *feed.Article {
+	c := *a
+	c.State = st
+	return &c
+}
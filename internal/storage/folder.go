@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/uuid"
+	"sort"
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("folder already exists")
+)
+
+// Folder groups some of the feeds a user is subscribed to. A feed is
+// in at most one folder of each user.
+type Folder struct {
+	UUID uuid.UUID
+	Name string
+
+	// Feeds in the folder, filled in by storage when folders are retrieved
+	Feeds []uuid.UUID
+}
+
+// FolderNamed returns the folder of a user with the given name,
+// adding it when the user does not have one yet.
+func FolderNamed(s Storage, user uuid.UUID, name string) (*Folder, error) {
+	folders, err := s.Folders(user)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range folders {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+
+	f := &Folder{
+		UUID: uuid.New(),
+		Name: name,
+	}
+
+	if err := s.AddFolder(user, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// sortFolders sorts folders alphabetically by name
+func sortFolders(folders []*Folder) {
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Name < folders[j].Name
+	})
+}
+
+// sortUUIDs sorts UUIDs by their bytes so that they are always
+// returned in the same order.
+func sortUUIDs(ids []uuid.UUID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"net/url"
+	"reader/internal/feed"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_Folders(t *testing.T) {
+	now := time.Now()
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			news := testFeed("news.local")
+			tech := testFeed("tech.local")
+			other := testFeed("other.local")
+
+			for i, f := range []*feed.Feed{news, tech, other} {
+				a := testArticle(f.Link+"/1", now.Add(-time.Duration(i+1)*time.Hour))
+				if err := store(s, f, []*feed.Article{a}); err != nil {
+					t.Fatalf("store() error = %v", err)
+				}
+			}
+
+			folder := &Folder{UUID: uuid.New(), Name: "Reading"}
+			if err := s.AddFolder(DefaultUser, folder); err != nil {
+				t.Fatalf("AddFolder() error = %v", err)
+			}
+
+			if err := s.AddFolder(DefaultUser, &Folder{UUID: uuid.New(), Name: "Reading"}); err != ErrFolderExists {
+				t.Errorf("AddFolder() with existing name error = %v, want %v", err, ErrFolderExists)
+			}
+
+			for _, f := range []*feed.Feed{news, tech} {
+				if err := s.SetFolder(DefaultUser, f.UUID(), folder.UUID); err != nil {
+					t.Fatalf("SetFolder() error = %v", err)
+				}
+			}
+
+			if err := s.SetFolder(DefaultUser, news.UUID(), uuid.New()); err != ErrFolderNotFound {
+				t.Errorf("SetFolder() to unknown folder error = %v, want %v", err, ErrFolderNotFound)
+			}
+
+			if err := s.SetFolder(DefaultUser, feed.UUIDFromString("oops"), folder.UUID); err != ErrFeedNotFound {
+				t.Errorf("SetFolder() of unknown feed error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			// Other users do not see the folder
+			if _, err := s.Folder(uuid.New(), folder.UUID); err != ErrFolderNotFound {
+				t.Errorf("Folder() of other user error = %v, want %v", err, ErrFolderNotFound)
+			}
+
+			want := []uuid.UUID{news.UUID(), tech.UUID()}
+			sortUUIDs(want)
+
+			got, err := s.Folder(DefaultUser, folder.UUID)
+			if err != nil || !reflect.DeepEqual(got.Feeds, want) {
+				t.Errorf("Folder() got = %v, %v, want feeds %v", got, err, want)
+			}
+
+			articles, err := s.LatestFromFolder(DefaultUser, folder.UUID, now, Filter{})
+			if err != nil {
+				t.Fatalf("LatestFromFolder() error = %v", err)
+			}
+
+			links := []string{}
+			for _, a := range articles {
+				links = append(links, a.Link)
+			}
+
+			wantLinks := []string{"https://news.local/1", "https://tech.local/1"}
+			if !reflect.DeepEqual(links, wantLinks) {
+				t.Errorf("LatestFromFolder() got = %v, want %v", links, wantLinks)
+			}
+
+			// Moving a feed keeps it in its folder
+			moved := &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: "moved.local"}}
+			if err := s.UpdateFeed(tech.UUID(), moved); err != nil {
+				t.Fatalf("UpdateFeed() error = %v", err)
+			}
+
+			want = []uuid.UUID{news.UUID(), moved.UUID()}
+			sortUUIDs(want)
+
+			folders, err := s.Folders(DefaultUser)
+			if err != nil || len(folders) != 1 || !reflect.DeepEqual(folders[0].Feeds, want) {
+				t.Errorf("Folders() got = %v, %v, want feeds %v", folders, err, want)
+			}
+
+			if err := s.DeleteFolder(DefaultUser, folder.UUID); err != nil {
+				t.Fatalf("DeleteFolder() error = %v", err)
+			}
+
+			if _, err := s.LatestFromFolder(DefaultUser, folder.UUID, now, Filter{}); err != ErrFolderNotFound {
+				t.Errorf("LatestFromFolder() of deleted folder error = %v, want %v", err, ErrFolderNotFound)
+			}
+
+			// Feeds of a deleted folder are kept
+			feeds, err := s.Subscriptions(DefaultUser)
+			if err != nil || len(feeds) != 3 {
+				t.Errorf("Subscriptions() got = %v, %v, want 3 feeds", feeds, err)
+			}
+
+			if err := s.AddFolder(DefaultUser, &Folder{UUID: uuid.New(), Name: "Reading"}); err != nil {
+				t.Errorf("AddFolder() after delete error = %v", err)
+			}
+
+			folders, err = s.Folders(DefaultUser)
+			if err != nil || len(folders) != 1 || len(folders[0].Feeds) != 0 {
+				t.Errorf("Folders() got = %v, %v, want one empty folder", folders, err)
+			}
+		})
+	}
+}
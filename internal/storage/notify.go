@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"sync"
+)
+
+// Change describes the articles a single call to Store has changed
+type Change struct {
+	Feed uuid.UUID
+
+	// Articles which had not been stored before
+	Added []uuid.UUID
+
+	// Articles which had been stored before but have changed since
+	Updated []uuid.UUID
+}
+
+// Hook is called with the changes made to storage
+type Hook func(c Change)
+
+// hooks keeps the hooks registered with a storage
+type hooks struct {
+	mu  sync.RWMutex
+	fns []Hook
+}
+
+// OnStore registers a hook which is called after Store has added new
+// articles or changed stored ones. Hooks are called in the order they
+// are registered and must not block.
+func (h *hooks) OnStore(fn Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fns = append(h.fns, fn)
+}
+
+// notify calls every hook with a change, unless it changes nothing
+func (h *hooks) notify(c Change) {
+	if len(c.Added) == 0 && len(c.Updated) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, fn := range h.fns {
+		fn(c)
+	}
+}
+
+// changed reports whether an article differs from how it was stored
+func changed(stored *feed.Article, a *feed.Article) bool {
+	sv, err := encodeArticle(stored)
+	if err != nil {
+		return true
+	}
+
+	v, err := encodeArticle(a)
+	if err != nil {
+		return true
+	}
+
+	return !bytes.Equal(sv, v)
+}
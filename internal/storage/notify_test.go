@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_OnStore(t *testing.T) {
+	now := time.Now()
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			var changes []Change
+			s.OnStore(func(c Change) {
+				changes = append(changes, c)
+			})
+
+			f := testFeed("mock.local")
+			a1 := testArticle("https://mock.local/1", now.Add(-2*time.Hour))
+			a2 := testArticle("https://mock.local/2", now.Add(-1*time.Hour))
+
+			edited := *a2
+			edited.Title = "Edited"
+
+			steps := [][]*feed.Article{
+				{a1},
+				// Storing an article again only adds the new one
+				{a1, a2},
+				// Nothing is reported when nothing is added
+				{a1, a2},
+				nil,
+				// Changed articles are reported as updated
+				{a1, &edited},
+			}
+			for _, articles := range steps {
+				if err := s.Store(f, articles); err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+			}
+
+			want := []Change{
+				{Feed: f.UUID(), Added: []uuid.UUID{a1.UUID()}},
+				{Feed: f.UUID(), Added: []uuid.UUID{a2.UUID()}},
+				{Feed: f.UUID(), Updated: []uuid.UUID{a2.UUID()}},
+			}
+
+			if !reflect.DeepEqual(changes, want) {
+				t.Errorf("OnStore() got = %v, want %v", changes, want)
+			}
+		})
+	}
+}
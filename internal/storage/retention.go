@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy describes which articles should be kept in storage.
+// A zero value for any of the limits disables that limit.
+type RetentionPolicy struct {
+
+	// Maximum number of articles to keep for each feed
+	MaxPerFeed uint
+
+	// Maximum age of an article based on its published date. Articles
+	// the feed gives no published date for are aged from when they were
+	// last updated, or from when they were first seen without either.
+	MaxAge time.Duration
+
+	// Maximum number of articles to keep across all feeds
+	MaxTotal uint
+}
+
+// Eviction reports how many articles were evicted by a compaction
+// and which rule of the retention policy caused them to be evicted.
+type Eviction struct {
+	Age   uint
+	Feed  uint
+	Total uint
+}
+
+// Sum returns the total number of evicted articles
+func (e Eviction) Sum() uint {
+	return e.Age + e.Feed + e.Total
+}
+
+// evictions works out which articles fall outside of the given policy.
+// Articles are grouped by the UUID of the feed they belong to and the
+// returned map uses the same grouping. Starred articles are never evicted
+// and do not count towards any limits.
+func evictions(groups map[uuid.UUID][]*feed.Article, p RetentionPolicy, now time.Time, starred func(uuid.UUID) bool) (map[uuid.UUID][]uuid.UUID, Eviction) {
+	evict := map[uuid.UUID][]uuid.UUID{}
+	e := Eviction{}
+
+	type kept struct {
+		feed    uuid.UUID
+		article *feed.Article
+	}
+
+	remaining := []kept{}
+
+	for fid, articles := range groups {
+
+		// Sort newest first so that limits always keep the newest articles
+		sort.Slice(articles, func(i, j int) bool {
+			return articles[i].Published.After(articles[j].Published)
+		})
+
+		n := uint(0)
+		for _, a := range articles {
+			if starred(a.UUID()) {
+				continue
+			}
+
+			if p.MaxAge > 0 && !a.Published.IsZero() && now.Sub(a.Published) > p.MaxAge {
+				evict[fid] = append(evict[fid], a.UUID())
+				e.Age++
+				continue
+			}
+
+			if p.MaxPerFeed > 0 && n >= p.MaxPerFeed {
+				evict[fid] = append(evict[fid], a.UUID())
+				e.Feed++
+				continue
+			}
+
+			n++
+			remaining = append(remaining, kept{fid, a})
+		}
+	}
+
+	if p.MaxTotal > 0 && uint(len(remaining)) > p.MaxTotal {
+		sort.Slice(remaining, func(i, j int) bool {
+			return remaining[i].article.Published.After(remaining[j].article.Published)
+		})
+
+		for _, k := range remaining[p.MaxTotal:] {
+			evict[k.feed] = append(evict[k.feed], k.article.UUID())
+			e.Total++
+		}
+	}
+
+	return evict, e
+}
+
+// Compaction is the result of a single compaction run
+type Compaction struct {
+	Eviction
+	Err error
+}
+
+// Compactor periodically enforces a retention policy on storage
+// so that a long running instance does not grow without bound.
+type Compactor struct {
+	s        Storage
+	p        RetentionPolicy
+	interval time.Duration
+}
+
+func NewCompactor(s Storage, p RetentionPolicy, interval time.Duration) *Compactor {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	return &Compactor{
+		s:        s,
+		p:        p,
+		interval: interval,
+	}
+}
+
+// Run will compact storage every interval until the given context
+// is closed. The result of every compaction is sent on the returned
+// channel so that evicted counts can be monitored.
+func (c *Compactor) Run(ctx context.Context) <-chan Compaction {
+	results := make(chan Compaction)
+
+	go func() {
+		defer close(results)
+
+		t := time.NewTicker(c.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			e, err := c.s.Compact(c.p)
+
+			select {
+			case <-ctx.Done():
+				return
+			case results <- Compaction{Eviction: e, Err: err}:
+			}
+		}
+	}()
+
+	return results
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStorage_Compact(t *testing.T) {
+	now := time.Now()
+
+	a1 := testArticle("https://mock.local/1", now.Add(-3*time.Hour))
+	a2 := testArticle("https://mock.local/2", now.Add(-2*time.Hour))
+	a3 := testArticle("https://mock.local/3", now.Add(-1*time.Hour))
+	b1 := testArticle("https://mock2.local/1", now.Add(-90*time.Minute))
+
+	// Articles without a published date are published when first stored
+	b2 := testArticle("https://mock2.local/2", time.Time{})
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   Eviction
+		left   []*feed.Article
+	}{
+		{
+			"no policy",
+			RetentionPolicy{},
+			Eviction{},
+			[]*feed.Article{b2, a3, b1, a2, a1},
+		},
+		{
+			"max per feed",
+			RetentionPolicy{MaxPerFeed: 1},
+			Eviction{Feed: 3},
+			[]*feed.Article{b2, a3},
+		},
+		{
+			"max age",
+			RetentionPolicy{MaxAge: 100 * time.Minute},
+			Eviction{Age: 2},
+			[]*feed.Article{b2, a3, b1},
+		},
+		{
+			"max total",
+			RetentionPolicy{MaxTotal: 2},
+			Eviction{Total: 3},
+			[]*feed.Article{b2, a3},
+		},
+		{
+			"combined",
+			RetentionPolicy{MaxPerFeed: 2, MaxAge: 150 * time.Minute, MaxTotal: 2},
+			Eviction{Age: 1, Total: 2},
+			[]*feed.Article{b2, a3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewInMemoryStorage(10)
+
+			if err := store(s, testFeed("mock.local"), []*feed.Article{a1, a2, a3}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := store(s, testFeed("mock2.local"), []*feed.Article{b1, b2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			got, err := s.Compact(tt.policy)
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Compact() got = %+v, want %+v", got, tt.want)
+			}
+
+			left, err := s.Latest(DefaultUser, time.Now(), Filter{})
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+
+			if got, want := articleLinks(left), articleLinks(tt.left); !reflect.DeepEqual(got, want) {
+				t.Errorf("Latest() after Compact() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBoltStorage_Compact(t *testing.T) {
+	now := time.Now()
+	a1 := testArticle("https://mock.local/1", now.Add(-2*time.Hour))
+	a2 := testArticle("https://mock.local/2", now.Add(-1*time.Hour))
+
+	s, _ := newTestBoltStorage(t, 10)
+	defer s.Close()
+
+	if err := store(s, testFeed("mock.local"), []*feed.Article{a1, a2}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	got, err := s.Compact(RetentionPolicy{MaxPerFeed: 1})
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if got.Sum() != 1 {
+		t.Errorf("Compact() evicted = %v, want %v", got.Sum(), 1)
+	}
+
+	if _, err := s.Article(DefaultUser, a1.UUID()); err == nil {
+		t.Errorf("Article() of evicted article returned no error")
+	}
+
+	if _, err := s.Article(DefaultUser, a2.UUID()); err != nil {
+		t.Errorf("Article() of kept article error = %v", err)
+	}
+}
+
+func TestStorage_Compact_Evicted(t *testing.T) {
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			f := testFeed("mock.local")
+			a1 := testArticle("https://mock.local/1", now.Add(-2*time.Hour))
+			a2 := testArticle("https://mock.local/2", now.Add(-1*time.Hour))
+
+			if err := store(s, f, []*feed.Article{a1, a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if _, err := s.Compact(RetentionPolicy{MaxPerFeed: 1}); err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			var changes []Change
+			s.OnStore(func(c Change) {
+				changes = append(changes, c)
+			})
+
+			// Evicted articles still in the feed are not added again
+			if err := s.Store(f, []*feed.Article{a1, a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if len(changes) != 0 {
+				t.Errorf("Store() of evicted article changes = %+v, want none", changes)
+			}
+
+			if _, err := s.Article(DefaultUser, a1.UUID()); err != ErrArticleNotFound {
+				t.Errorf("Article() of evicted article error = %v, want %v", err, ErrArticleNotFound)
+			}
+
+			// Once an evicted article has left the feed it is forgotten, so
+			// it is added again if it comes back
+			if err := s.Store(f, []*feed.Article{a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := s.Store(f, []*feed.Article{a1, a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if _, err := s.Article(DefaultUser, a1.UUID()); err != nil {
+				t.Errorf("Article() of article back in feed error = %v", err)
+			}
+		})
+	}
+}
+
+type compactStorage struct {
+	InMemoryStorage
+	mu       sync.Mutex
+	policies []RetentionPolicy
+}
+
+func (s *compactStorage) Compact(p RetentionPolicy) (Eviction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = append(s.policies, p)
+	return Eviction{Feed: 1}, nil
+}
+
+func TestCompactor_Run(t *testing.T) {
+	s := &compactStorage{}
+	p := RetentionPolicy{MaxPerFeed: 5}
+
+	c := NewCompactor(s, p, 5*time.Millisecond)
+	if c.interval != 5*time.Millisecond {
+		t.Errorf("NewCompactor() interval = %v, want %v", c.interval, 5*time.Millisecond)
+	}
+
+	ctx, cf := context.WithCancel(context.Background())
+	results := c.Run(ctx)
+
+	select {
+	case r := <-results:
+		if r.Err != nil || r.Sum() != 1 {
+			t.Errorf("Run() got = %+v, want 1 eviction", r)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout reached waiting for compaction")
+	}
+
+	cf()
+
+	// Once the context is closed the results channel must be closed
+	for range results {
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.policies) == 0 || s.policies[0] != p {
+		t.Errorf("Compact() called with %v, want %v", s.policies, p)
+	}
+}
+
+func TestEvictions_GroupedByFeed(t *testing.T) {
+	fid := feed.UUIDFromString("https://mock.local")
+	a1 := testArticle("https://mock.local/1", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	a2 := testArticle("https://mock.local/2", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	got, _ := evictions(map[uuid.UUID][]*feed.Article{
+		fid: {a1, a2},
+	}, RetentionPolicy{MaxPerFeed: 1}, time.Now(), func(uuid.UUID) bool {
+		return false
+	})
+
+	want := map[uuid.UUID][]uuid.UUID{
+		fid: {a1.UUID()},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("evictions() got = %v, want %v", got, want)
+	}
+}
@@ -4,28 +4,115 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"reader/internal/feed"
+	"reader/internal/search"
 	"sort"
 	"sync"
 	"time"
 )
 
+var (
+	ErrFeedNotFound    = errors.New("feed not found")
+	ErrFeedExists      = errors.New("feed already exists")
+	ErrArticleNotFound = errors.New("article not found")
+)
+
 type Storage interface {
 	Store(feed *feed.Feed, articles []*feed.Article) error
 	Feeds() ([]*feed.Feed, error)
-	Latest(offset time.Time) ([]*feed.Article, error)
-	LatestFromFeed(feed uuid.UUID, offset time.Time) ([]*feed.Article, error)
-	Article(article uuid.UUID) (*feed.Article, error)
+	Feed(feed uuid.UUID) (*feed.Feed, error)
+	UpdateFeed(feed uuid.UUID, updated *feed.Feed) error
+	DeleteFeed(feed uuid.UUID) error
+	AddUser(user *User) error
+	User(user uuid.UUID) (*User, error)
+	Subscribe(user uuid.UUID, feed uuid.UUID) error
+	Unsubscribe(user uuid.UUID, feed uuid.UUID) error
+	Subscriptions(user uuid.UUID) ([]*feed.Feed, error)
+	Subscribers(feed uuid.UUID) ([]uuid.UUID, error)
+	AddAPIKey(key *APIKey) error
+	APIKey(hash string) (*APIKey, error)
+	APIKeys() ([]*APIKey, error)
+	DeleteAPIKey(key uuid.UUID) error
+	AddWebhook(hook *Webhook) error
+	Webhooks() ([]*Webhook, error)
+	Webhook(hook uuid.UUID) (*Webhook, error)
+	DeleteWebhook(hook uuid.UUID) error
+	AddDelivery(delivery *Delivery) error
+	Deliveries(hook uuid.UUID) ([]*Delivery, error)
+	AddFolder(user uuid.UUID, folder *Folder) error
+	Folders(user uuid.UUID) ([]*Folder, error)
+	Folder(user uuid.UUID, folder uuid.UUID) (*Folder, error)
+	DeleteFolder(user uuid.UUID, folder uuid.UUID) error
+	SetFolder(user uuid.UUID, feed uuid.UUID, folder uuid.UUID) error
+	Latest(user uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error)
+	LatestFromFeed(user uuid.UUID, feed uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error)
+	LatestFromFolder(user uuid.UUID, folder uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error)
+	Article(user uuid.UUID, article uuid.UUID) (*feed.Article, error)
+	FeedArticle(feed uuid.UUID, article uuid.UUID) (*feed.Article, error)
+	MarkRead(user uuid.UUID, article uuid.UUID, read bool) error
+	Star(user uuid.UUID, article uuid.UUID, starred bool) error
+	SetPosition(user uuid.UUID, article uuid.UUID, position uint) error
+	MarkFeedRead(user uuid.UUID, feed uuid.UUID) error
+	MarkReadBefore(user uuid.UUID, before time.Time) error
+	Compact(policy RetentionPolicy) (Eviction, error)
+	Search(user uuid.UUID, query search.Query) ([]*feed.Article, error)
+	OnStore(hook Hook)
+}
+
+// stateKey identifies the state a single user has for a single article
+type stateKey struct {
+	user    uuid.UUID
+	article uuid.UUID
 }
 
 type InMemoryStorage struct {
 	feeds    *sync.Map
 	articles *sync.Map
 
+	// Articles evicted by compaction keyed by feed UUID. Each value is a
+	// map of the UUIDs of evicted articles which are still in the feed,
+	// so that they are not added again the next time it is read.
+	evicted *sync.Map
+
+	// Users keyed by user UUID
+	users *sync.Map
+
+	// API keys keyed by the hash of the key
+	apiKeys *sync.Map
+
+	// Webhooks keyed by webhook UUID
+	webhooks *sync.Map
+
+	// Delivery attempts keyed by webhook UUID, oldest first
+	deliveries *sync.Map
+
+	// Feeds each user is subscribed to keyed by user UUID. Each value
+	// is a map of the UUID of a subscribed feed to the UUID of the folder
+	// it is in, which is uuid.Nil when the feed is not in a folder.
+	subscriptions *sync.Map
+
+	// Folders of each user keyed by user UUID. Each value is
+	// a map of folders keyed by folder UUID.
+	folders *sync.Map
+
+	// State of each article keyed by user and article UUID. Articles
+	// without any state are not kept in the map.
+	states *sync.Map
+
 	// Minimum number articles to show when viewing latest.
 	// We use minimum here because of the time offset rule
 	// which theoretically could be more than the number of
 	// articles stated to ensure correct pagination.
 	minLatest uint
+
+	// Full text index of all stored articles
+	index *search.Index
+
+	// Hooks called when articles are added
+	*hooks
+
+	// Guards read-modify-write changes of article state, folders
+	// and deliveries
+	mu sync.Mutex
 }
 
 func NewInMemoryStorage(maxLatest uint) *InMemoryStorage {
@@ -34,29 +121,94 @@ func NewInMemoryStorage(maxLatest uint) *InMemoryStorage {
 	}
 
 	return &InMemoryStorage{
-		minLatest: maxLatest,
-		feeds:     &sync.Map{},
-		articles:  &sync.Map{},
+		minLatest:     maxLatest,
+		feeds:         &sync.Map{},
+		articles:      &sync.Map{},
+		evicted:       &sync.Map{},
+		users:         &sync.Map{},
+		apiKeys:       &sync.Map{},
+		webhooks:      &sync.Map{},
+		deliveries:    &sync.Map{},
+		subscriptions: &sync.Map{},
+		folders:       &sync.Map{},
+		states:        &sync.Map{},
+		index:         search.NewIndex(),
+		hooks:         &hooks{},
 	}
 }
 
-func (s *InMemoryStorage) Store(feed *feed.Feed, articles []*feed.Article) error {
-	s.feeds.Store(feed.UUID(), feed)
+func (s *InMemoryStorage) Store(f *feed.Feed, articles []*feed.Article) error {
+	s.feeds.Store(f.UUID(), f)
 
-	am, ok := s.articles.Load(feed.UUID())
+	am, ok := s.articles.Load(f.UUID())
 	if !ok {
 		am = &sync.Map{}
 	}
 
+	c := Change{Feed: f.UUID()}
+	seen := time.Now()
+
+	evicted := s.keepEvicted(f.UUID(), articles)
+
 	for _, a := range articles {
-		am.(*sync.Map).Store(a.UUID(), a)
+		if evicted[a.UUID()] {
+			continue
+		}
+
+		var prev *feed.Article
+		if v, ok := am.(*sync.Map).Load(a.UUID()); ok {
+			prev = v.(*feed.Article)
+		}
+
+		a = withPublished(prev, a, seen)
+
+		stored, loaded := am.(*sync.Map).LoadOrStore(a.UUID(), a)
+		switch {
+		case !loaded:
+			c.Added = append(c.Added, a.UUID())
+		case changed(stored.(*feed.Article), a):
+			am.(*sync.Map).Store(a.UUID(), a)
+			c.Updated = append(c.Updated, a.UUID())
+		}
+
+		s.index.Add(f.UUID(), a)
 	}
 
-	s.articles.Store(feed.UUID(), am)
+	s.articles.Store(f.UUID(), am)
+
+	s.notify(c)
 
 	return nil
 }
 
+// keepEvicted returns which of the given articles of a feed were evicted
+// by compaction. Articles are only kept evicted while they are still in
+// the feed, once they have left it they are forgotten.
+func (s *InMemoryStorage) keepEvicted(id uuid.UUID, articles []*feed.Article) map[uuid.UUID]bool {
+	evicted := map[uuid.UUID]bool{}
+
+	em, ok := s.evicted.Load(id)
+	if !ok || len(articles) == 0 {
+		return evicted
+	}
+
+	for _, a := range articles {
+		if _, ok := em.(*sync.Map).Load(a.UUID()); ok {
+			evicted[a.UUID()] = true
+		}
+	}
+
+	em.(*sync.Map).Range(func(key, value interface{}) bool {
+		if !evicted[key.(uuid.UUID)] {
+			em.(*sync.Map).Delete(key)
+		}
+		return true
+	})
+
+	return evicted
+}
+
+// Feeds returns every stored feed regardless of who is subscribed to it
 func (s *InMemoryStorage) Feeds() ([]*feed.Feed, error) {
 	feeds := []*feed.Feed{}
 
@@ -65,46 +217,656 @@ func (s *InMemoryStorage) Feeds() ([]*feed.Feed, error) {
 		return true
 	})
 
-	// Sort feeds alphabetically by title
-	sort.Slice(feeds, func(i, j int) bool {
-		return feeds[i].Title < feeds[j].Title
-	})
+	sortFeeds(feeds)
 
 	return feeds, nil
 }
 
-func (s *InMemoryStorage) Latest(offset time.Time) ([]*feed.Article, error) {
-	articles := []*feed.Article{}
+func (s *InMemoryStorage) Feed(id uuid.UUID) (*feed.Feed, error) {
+	f, ok := s.feeds.Load(id)
+	if !ok {
+		return nil, ErrFeedNotFound
+	}
 
-	s.articles.Range(func(key, value interface{}) bool {
-		value.(*sync.Map).Range(func(key, value interface{}) bool {
-			articles = append(articles, value.(*feed.Article))
+	return f.(*feed.Feed), nil
+}
+
+// UpdateFeed will replace the feed with the given UUID. As a feed UUID
+// is derived from its feed link, any stored articles and subscriptions
+// are moved over to the UUID of the updated feed.
+func (s *InMemoryStorage) UpdateFeed(id uuid.UUID, updated *feed.Feed) error {
+	if _, ok := s.feeds.Load(id); !ok {
+		return ErrFeedNotFound
+	}
+
+	nid := updated.UUID()
+	if nid != id {
+		if _, ok := s.feeds.Load(nid); ok {
+			return ErrFeedExists
+		}
+	}
+
+	s.feeds.Store(nid, updated)
+
+	if nid == id {
+		return nil
+	}
+
+	if am, ok := s.articles.Load(id); ok {
+		s.articles.Store(nid, am)
+
+		am.(*sync.Map).Range(func(key, value interface{}) bool {
+			s.index.Move(key.(uuid.UUID), id, nid)
 			return true
 		})
+	}
+
+	s.subscriptions.Range(func(key, value interface{}) bool {
+		if folder, ok := value.(*sync.Map).Load(id); ok {
+			value.(*sync.Map).Store(nid, folder)
+			value.(*sync.Map).Delete(id)
+		}
 		return true
 	})
 
+	if em, ok := s.evicted.Load(id); ok {
+		s.evicted.Store(nid, em)
+	}
+
+	s.feeds.Delete(id)
+	s.articles.Delete(id)
+	s.evicted.Delete(id)
+
+	return nil
+}
+
+// DeleteFeed will remove the feed with the given UUID along with
+// all of its articles and subscriptions.
+func (s *InMemoryStorage) DeleteFeed(id uuid.UUID) error {
+	if _, ok := s.feeds.Load(id); !ok {
+		return ErrFeedNotFound
+	}
+
+	if am, ok := s.articles.Load(id); ok {
+		removed := map[uuid.UUID]bool{}
+		am.(*sync.Map).Range(func(key, value interface{}) bool {
+			s.index.Remove(id, key.(uuid.UUID))
+			if !s.inOtherFeed(id, key.(uuid.UUID)) {
+				removed[key.(uuid.UUID)] = true
+			}
+			return true
+		})
+
+		s.deleteStates(removed)
+	}
+
+	s.subscriptions.Range(func(key, value interface{}) bool {
+		value.(*sync.Map).Delete(id)
+		return true
+	})
+
+	s.feeds.Delete(id)
+	s.articles.Delete(id)
+	s.evicted.Delete(id)
+
+	return nil
+}
+
+// AddUser will store a new user
+func (s *InMemoryStorage) AddUser(u *User) error {
+	if _, loaded := s.users.LoadOrStore(u.UUID, u); loaded {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+func (s *InMemoryStorage) User(id uuid.UUID) (*User, error) {
+	u, ok := s.users.Load(id)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return u.(*User), nil
+}
+
+// AddAPIKey will store a new API key
+func (s *InMemoryStorage) AddAPIKey(k *APIKey) error {
+	s.apiKeys.Store(k.Hash, k)
+	return nil
+}
+
+// APIKey returns the API key with the given hash
+func (s *InMemoryStorage) APIKey(hash string) (*APIKey, error) {
+	k, ok := s.apiKeys.Load(hash)
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return k.(*APIKey), nil
+}
+
+// APIKeys returns every stored API key, oldest first
+func (s *InMemoryStorage) APIKeys() ([]*APIKey, error) {
+	keys := []*APIKey{}
+
+	s.apiKeys.Range(func(key, value interface{}) bool {
+		keys = append(keys, value.(*APIKey))
+		return true
+	})
+
+	sortAPIKeys(keys)
+
+	return keys, nil
+}
+
+// DeleteAPIKey will remove the API key with the given UUID
+func (s *InMemoryStorage) DeleteAPIKey(id uuid.UUID) error {
+	found := false
+
+	s.apiKeys.Range(func(key, value interface{}) bool {
+		if value.(*APIKey).UUID == id {
+			s.apiKeys.Delete(key)
+			found = true
+			return false
+		}
+		return true
+	})
+
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// AddWebhook will store a new webhook
+func (s *InMemoryStorage) AddWebhook(w *Webhook) error {
+	s.webhooks.Store(w.UUID, w)
+	return nil
+}
+
+// Webhooks returns every stored webhook, oldest first
+func (s *InMemoryStorage) Webhooks() ([]*Webhook, error) {
+	hooks := []*Webhook{}
+
+	s.webhooks.Range(func(key, value interface{}) bool {
+		hooks = append(hooks, value.(*Webhook))
+		return true
+	})
+
+	sortWebhooks(hooks)
+
+	return hooks, nil
+}
+
+func (s *InMemoryStorage) Webhook(id uuid.UUID) (*Webhook, error) {
+	w, ok := s.webhooks.Load(id)
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	return w.(*Webhook), nil
+}
+
+// DeleteWebhook will remove a webhook along with its deliveries
+func (s *InMemoryStorage) DeleteWebhook(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks.Load(id); !ok {
+		return ErrWebhookNotFound
+	}
+
+	s.webhooks.Delete(id)
+	s.deliveries.Delete(id)
+
+	return nil
+}
+
+// AddDelivery will store an attempt at delivering to a webhook. Only
+// the most recent attempts are kept.
+func (s *InMemoryStorage) AddDelivery(d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks.Load(d.Webhook); !ok {
+		return ErrWebhookNotFound
+	}
+
+	var deliveries []*Delivery
+	if v, ok := s.deliveries.Load(d.Webhook); ok {
+		deliveries = v.([]*Delivery)
+	}
+
+	deliveries = append(deliveries, d)
+	if len(deliveries) > maxDeliveries {
+		deliveries = deliveries[len(deliveries)-maxDeliveries:]
+	}
+
+	s.deliveries.Store(d.Webhook, deliveries)
+
+	return nil
+}
+
+// Deliveries returns the most recent attempts at delivering to a
+// webhook, newest first
+func (s *InMemoryStorage) Deliveries(id uuid.UUID) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks.Load(id); !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	var deliveries []*Delivery
+	if v, ok := s.deliveries.Load(id); ok {
+		deliveries = v.([]*Delivery)
+	}
+
+	return newestFirst(deliveries), nil
+}
+
+// Subscribe will subscribe the given user to a stored feed
+func (s *InMemoryStorage) Subscribe(user uuid.UUID, id uuid.UUID) error {
+	if _, ok := s.feeds.Load(id); !ok {
+		return ErrFeedNotFound
+	}
+
+	sm, _ := s.subscriptions.LoadOrStore(user, &sync.Map{})
+	if _, loaded := sm.(*sync.Map).LoadOrStore(id, uuid.Nil); loaded {
+		return ErrSubscribed
+	}
+
+	return nil
+}
+
+// Unsubscribe will remove a feed from the subscriptions of the given
+// user. The feed itself is kept, even when no one is subscribed to it.
+func (s *InMemoryStorage) Unsubscribe(user uuid.UUID, id uuid.UUID) error {
+	if !s.subscribed(user, id) {
+		return ErrFeedNotFound
+	}
+
+	sm, _ := s.subscriptions.Load(user)
+	sm.(*sync.Map).Delete(id)
+
+	return nil
+}
+
+// Subscriptions returns every feed the given user is subscribed to
+func (s *InMemoryStorage) Subscriptions(user uuid.UUID) ([]*feed.Feed, error) {
+	feeds := []*feed.Feed{}
+
+	for _, id := range s.subscribedFeeds(user) {
+		if f, ok := s.feeds.Load(id); ok {
+			feeds = append(feeds, f.(*feed.Feed))
+		}
+	}
+
+	sortFeeds(feeds)
+
+	return feeds, nil
+}
+
+// Subscribers returns the UUID of every user subscribed to the given feed
+func (s *InMemoryStorage) Subscribers(id uuid.UUID) ([]uuid.UUID, error) {
+	if _, ok := s.feeds.Load(id); !ok {
+		return nil, ErrFeedNotFound
+	}
+
+	users := []uuid.UUID{}
+
+	s.subscriptions.Range(func(key, value interface{}) bool {
+		if _, ok := value.(*sync.Map).Load(id); ok {
+			users = append(users, key.(uuid.UUID))
+		}
+		return true
+	})
+
+	return users, nil
+}
+
+// subscribed reports whether the given user is subscribed to a feed
+func (s *InMemoryStorage) subscribed(user uuid.UUID, id uuid.UUID) bool {
+	sm, ok := s.subscriptions.Load(user)
+	if !ok {
+		return false
+	}
+
+	_, ok = sm.(*sync.Map).Load(id)
+	return ok
+}
+
+// subscribedFeeds returns the UUIDs of every feed the given user is
+// subscribed to.
+func (s *InMemoryStorage) subscribedFeeds(user uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{}
+
+	sm, ok := s.subscriptions.Load(user)
+	if !ok {
+		return ids
+	}
+
+	sm.(*sync.Map).Range(func(key, value interface{}) bool {
+		ids = append(ids, key.(uuid.UUID))
+		return true
+	})
+
+	return ids
+}
+
+// AddFolder will store a new folder for the given user. Folder names
+// are unique for each user.
+func (s *InMemoryStorage) AddFolder(user uuid.UUID, f *Folder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fm, _ := s.folders.LoadOrStore(user, &sync.Map{})
+
+	exists := false
+	fm.(*sync.Map).Range(func(key, value interface{}) bool {
+		exists = value.(*Folder).Name == f.Name || key.(uuid.UUID) == f.UUID
+		return !exists
+	})
+
+	if exists {
+		return ErrFolderExists
+	}
+
+	fm.(*sync.Map).Store(f.UUID, &Folder{UUID: f.UUID, Name: f.Name})
+
+	return nil
+}
+
+// Folders returns every folder of the given user along with their feeds
+func (s *InMemoryStorage) Folders(user uuid.UUID) ([]*Folder, error) {
+	folders := []*Folder{}
+
+	fm, ok := s.folders.Load(user)
+	if !ok {
+		return folders, nil
+	}
+
+	fm.(*sync.Map).Range(func(key, value interface{}) bool {
+		folders = append(folders, s.withFeeds(user, value.(*Folder)))
+		return true
+	})
+
+	sortFolders(folders)
+
+	return folders, nil
+}
+
+func (s *InMemoryStorage) Folder(user uuid.UUID, id uuid.UUID) (*Folder, error) {
+	fm, ok := s.folders.Load(user)
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+
+	f, ok := fm.(*sync.Map).Load(id)
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+
+	return s.withFeeds(user, f.(*Folder)), nil
+}
+
+// withFeeds returns a copy of the given folder with its feeds filled in
+func (s *InMemoryStorage) withFeeds(user uuid.UUID, f *Folder) *Folder {
+	return &Folder{
+		UUID:  f.UUID,
+		Name:  f.Name,
+		Feeds: s.folderFeeds(user, f.UUID),
+	}
+}
+
+// folderFeeds returns the UUIDs of every feed a user has in a folder
+func (s *InMemoryStorage) folderFeeds(user uuid.UUID, folder uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{}
+
+	sm, ok := s.subscriptions.Load(user)
+	if !ok {
+		return ids
+	}
+
+	sm.(*sync.Map).Range(func(key, value interface{}) bool {
+		if value.(uuid.UUID) == folder {
+			ids = append(ids, key.(uuid.UUID))
+		}
+		return true
+	})
+
+	sortUUIDs(ids)
+
+	return ids
+}
+
+// DeleteFolder will remove a folder of the given user. The feeds
+// in the folder are kept but are no longer in any folder.
+func (s *InMemoryStorage) DeleteFolder(user uuid.UUID, id uuid.UUID) error {
+	if _, err := s.Folder(user, id); err != nil {
+		return err
+	}
+
+	for _, fid := range s.folderFeeds(user, id) {
+		if err := s.SetFolder(user, fid, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	fm, _ := s.folders.Load(user)
+	fm.(*sync.Map).Delete(id)
+
+	return nil
+}
+
+// SetFolder will move a feed the given user is subscribed to into a
+// folder. Feeds are removed from their folder with uuid.Nil.
+func (s *InMemoryStorage) SetFolder(user uuid.UUID, id uuid.UUID, folder uuid.UUID) error {
+	if !s.subscribed(user, id) {
+		return ErrFeedNotFound
+	}
+
+	if folder != uuid.Nil {
+		if _, err := s.Folder(user, folder); err != nil {
+			return err
+		}
+	}
+
+	sm, _ := s.subscriptions.Load(user)
+	sm.(*sync.Map).Store(id, folder)
+
+	return nil
+}
+
+func (s *InMemoryStorage) Latest(user uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	for _, id := range s.subscribedFeeds(user) {
+		if am, ok := s.articles.Load(id); ok {
+			articles = append(articles, s.filter(user, am.(*sync.Map), filter)...)
+		}
+	}
+
 	return s.latest(articles, offset)
 }
 
-func (s *InMemoryStorage) LatestFromFeed(id uuid.UUID, offset time.Time) ([]*feed.Article, error) {
+func (s *InMemoryStorage) LatestFromFeed(user uuid.UUID, id uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
 	f, ok := s.articles.Load(id)
 
-	if !ok {
-		return nil, errors.New("feed not found")
+	if !ok || !s.subscribed(user, id) {
+		return nil, ErrFeedNotFound
+	}
+
+	return s.latest(s.filter(user, f.(*sync.Map), filter), offset)
+}
+
+func (s *InMemoryStorage) LatestFromFolder(user uuid.UUID, id uuid.UUID, offset time.Time, filter Filter) ([]*feed.Article, error) {
+	if _, err := s.Folder(user, id); err != nil {
+		return nil, err
 	}
 
 	articles := []*feed.Article{}
 
-	f.(*sync.Map).Range(func(key, value interface{}) bool {
-		articles = append(articles, value.(*feed.Article))
+	for _, fid := range s.folderFeeds(user, id) {
+		if am, ok := s.articles.Load(fid); ok {
+			articles = append(articles, s.filter(user, am.(*sync.Map), filter)...)
+		}
+	}
+
+	return s.latest(articles, offset)
+}
+
+// filter returns all articles of a feed's article map which pass
+// the given filter, with the state of the given user filled in.
+func (s *InMemoryStorage) filter(user uuid.UUID, am *sync.Map, filter Filter) []*feed.Article {
+	articles := []*feed.Article{}
+
+	am.Range(func(key, value interface{}) bool {
+		a := withState(value.(*feed.Article), s.state(user, key.(uuid.UUID)))
+		if filter.match(a) {
+			articles = append(articles, a)
+		}
 		return true
 	})
 
-	return s.latest(articles, offset)
+	return articles
+}
+
+// state returns the state a user has for the article with the given UUID
+func (s *InMemoryStorage) state(user uuid.UUID, id uuid.UUID) feed.State {
+	st, ok := s.states.Load(stateKey{user, id})
+	if !ok {
+		return feed.State{}
+	}
+
+	return st.(feed.State)
+}
+
+// setState changes the state a user has for all given articles
+func (s *InMemoryStorage) setState(user uuid.UUID, ids []uuid.UUID, fn func(st *feed.State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		st := s.state(user, id)
+		fn(&st)
+
+		if st == (feed.State{}) {
+			s.states.Delete(stateKey{user, id})
+			continue
+		}
+
+		s.states.Store(stateKey{user, id}, st)
+	}
+}
+
+// deleteStates removes the state every user has for the given articles
+func (s *InMemoryStorage) deleteStates(ids map[uuid.UUID]bool) {
+	s.states.Range(func(key, value interface{}) bool {
+		if ids[key.(stateKey).article] {
+			s.states.Delete(key)
+		}
+		return true
+	})
+}
+
+// MarkRead will mark the article with the given UUID as read or unread
+func (s *InMemoryStorage) MarkRead(user uuid.UUID, id uuid.UUID, read bool) error {
+	if _, err := s.Article(user, id); err != nil {
+		return err
+	}
+
+	s.setState(user, []uuid.UUID{id}, func(st *feed.State) {
+		st.Read = read
+	})
+
+	return nil
+}
+
+// Star will star or unstar the article with the given UUID
+func (s *InMemoryStorage) Star(user uuid.UUID, id uuid.UUID, starred bool) error {
+	if _, err := s.Article(user, id); err != nil {
+		return err
+	}
+
+	s.setState(user, []uuid.UUID{id}, func(st *feed.State) {
+		st.Starred = starred
+	})
+
+	return nil
+}
+
+// SetPosition will record how far, in seconds, the audio or video of
+// the article with the given UUID has been played
+func (s *InMemoryStorage) SetPosition(user uuid.UUID, id uuid.UUID, position uint) error {
+	if _, err := s.Article(user, id); err != nil {
+		return err
+	}
+
+	s.setState(user, []uuid.UUID{id}, func(st *feed.State) {
+		st.Position = position
+	})
+
+	return nil
+}
+
+// MarkFeedRead will mark every article of the given feed as read
+func (s *InMemoryStorage) MarkFeedRead(user uuid.UUID, id uuid.UUID) error {
+	am, ok := s.articles.Load(id)
+	if !ok || !s.subscribed(user, id) {
+		return ErrFeedNotFound
+	}
+
+	ids := []uuid.UUID{}
+	am.(*sync.Map).Range(func(key, value interface{}) bool {
+		ids = append(ids, key.(uuid.UUID))
+		return true
+	})
+
+	s.setState(user, ids, func(st *feed.State) {
+		st.Read = true
+	})
+
+	return nil
+}
+
+// MarkReadBefore will mark every article published before the
+// given time as read.
+func (s *InMemoryStorage) MarkReadBefore(user uuid.UUID, before time.Time) error {
+	ids := []uuid.UUID{}
+
+	for _, fid := range s.subscribedFeeds(user) {
+		am, ok := s.articles.Load(fid)
+		if !ok {
+			continue
+		}
+
+		am.(*sync.Map).Range(func(key, value interface{}) bool {
+			if value.(*feed.Article).Published.Before(before) {
+				ids = append(ids, key.(uuid.UUID))
+			}
+			return true
+		})
+	}
+
+	s.setState(user, ids, func(st *feed.State) {
+		st.Read = true
+	})
+
+	return nil
 }
 
 func (s *InMemoryStorage) latest(articles []*feed.Article, offset time.Time) ([]*feed.Article, error) {
+	return paginate(articles, offset, s.minLatest), nil
+}
+
+// paginate sorts given articles by published date and returns at least
+// min articles which were published before the given offset. It is shared
+// between storage implementations so that pagination semantics are
+// identical regardless of where articles are kept.
+func paginate(articles []*feed.Article, offset time.Time, min uint) []*feed.Article {
 
 	// Sort articles by published date
 	sort.Slice(articles, func(i, j int) bool {
@@ -129,18 +891,67 @@ func (s *InMemoryStorage) latest(articles []*feed.Article, offset time.Time) ([]
 			continue
 		}
 
-		if uint(len(latestArticles)) > s.minLatest-1 {
+		if uint(len(latestArticles)) > min-1 {
 			break
 		}
 	}
 
-	return latestArticles, nil
+	return latestArticles
+}
+
+// withPublished returns an article with its published time filled in
+// when the feed gave neither a published nor an updated time. Such an
+// article keeps the time it was first stored with, so that it stays
+// where it first appeared in timelines when the feed is read again.
+func withPublished(stored *feed.Article, a *feed.Article, seen time.Time) *feed.Article {
+	if !a.Published.IsZero() {
+		return a
+	}
+
+	c := *a
+	c.Published = seen
+	if stored != nil && !stored.Published.IsZero() {
+		c.Published = stored.Published
+	}
+
+	return &c
+}
+
+// FeedWithLink returns the stored feed with the given feed link. Feeds
+// are usually found by UUID, but a feed which has moved keeps the UUID
+// of its old feed link.
+func FeedWithLink(s Storage, link string) (*feed.Feed, error) {
+	feeds, err := s.Feeds()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range feeds {
+		if f.FeedLink.String() == link {
+			return f, nil
+		}
+	}
+
+	return nil, ErrFeedNotFound
 }
 
-func (s *InMemoryStorage) Article(id uuid.UUID) (*feed.Article, error) {
+// sortFeeds sorts feeds alphabetically by title
+func sortFeeds(feeds []*feed.Feed) {
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Title < feeds[j].Title
+	})
+}
+
+func (s *InMemoryStorage) Article(user uuid.UUID, id uuid.UUID) (*feed.Article, error) {
 	var article *feed.Article
 
+	// The same article can be in more than one feed, so it is looked for
+	// in every feed the user is subscribed to
 	s.articles.Range(func(key, value interface{}) bool {
+		if !s.subscribed(user, key.(uuid.UUID)) {
+			return true
+		}
+
 		a, ok := value.(*sync.Map).Load(id)
 		if ok {
 			article = a.(*feed.Article)
@@ -150,8 +961,122 @@ func (s *InMemoryStorage) Article(id uuid.UUID) (*feed.Article, error) {
 	})
 
 	if article == nil {
-		return nil, errors.New("article not found")
+		return nil, ErrArticleNotFound
+	}
+
+	return withState(article, s.state(user, id)), nil
+}
+
+// inOtherFeed reports whether the article with the given UUID is also
+// stored in a feed other than the given one. Its state is kept as long
+// as it is.
+func (s *InMemoryStorage) inOtherFeed(fid uuid.UUID, id uuid.UUID) bool {
+	found := false
+
+	s.articles.Range(func(key, value interface{}) bool {
+		if key.(uuid.UUID) == fid {
+			return true
+		}
+
+		_, found = value.(*sync.Map).Load(id)
+		return !found
+	})
+
+	return found
+}
+
+// FeedArticle returns an article of the feed with the given UUID as it
+// is stored, regardless of who is subscribed to the feed
+func (s *InMemoryStorage) FeedArticle(fid uuid.UUID, id uuid.UUID) (*feed.Article, error) {
+	am, ok := s.articles.Load(fid)
+	if !ok {
+		return nil, ErrArticleNotFound
+	}
+
+	a, ok := am.(*sync.Map).Load(id)
+	if !ok {
+		return nil, ErrArticleNotFound
+	}
+
+	return withState(a.(*feed.Article), feed.State{}), nil
+}
+
+// Compact will remove all articles which fall outside of the given
+// retention policy. Articles starred by any user are kept and evicted
+// articles are not added again while they are still in their feed.
+func (s *InMemoryStorage) Compact(p RetentionPolicy) (Eviction, error) {
+	groups := map[uuid.UUID][]*feed.Article{}
+
+	s.articles.Range(func(key, value interface{}) bool {
+		articles := []*feed.Article{}
+		value.(*sync.Map).Range(func(key, value interface{}) bool {
+			articles = append(articles, value.(*feed.Article))
+			return true
+		})
+
+		groups[key.(uuid.UUID)] = articles
+		return true
+	})
+
+	starred := map[uuid.UUID]bool{}
+	s.states.Range(func(key, value interface{}) bool {
+		if value.(feed.State).Starred {
+			starred[key.(stateKey).article] = true
+		}
+		return true
+	})
+
+	evict, e := evictions(groups, p, time.Now(), func(id uuid.UUID) bool {
+		return starred[id]
+	})
+
+	removed := map[uuid.UUID]bool{}
+	for fid, ids := range evict {
+		am, ok := s.articles.Load(fid)
+		if !ok {
+			continue
+		}
+
+		em, _ := s.evicted.LoadOrStore(fid, &sync.Map{})
+
+		for _, id := range ids {
+			am.(*sync.Map).Delete(id)
+			em.(*sync.Map).Store(id, true)
+			s.index.Remove(fid, id)
+			if !s.inOtherFeed(fid, id) {
+				removed[id] = true
+			}
+		}
+	}
+
+	s.deleteStates(removed)
+
+	return e, nil
+}
+
+// Search returns all articles from the feeds the given user is subscribed
+// to which match the given query, most relevant first.
+func (s *InMemoryStorage) Search(user uuid.UUID, q search.Query) ([]*feed.Article, error) {
+	articles := []*feed.Article{}
+
+	q.Feeds = subscribedFeeds(q.Feeds, s.subscribedFeeds(user))
+	if len(q.Feeds) == 0 {
+		return articles, nil
+	}
+
+	for _, r := range s.index.Search(q) {
+		am, ok := s.articles.Load(r.Feed)
+		if !ok {
+			continue
+		}
+
+		a, ok := am.(*sync.Map).Load(r.Article)
+		if !ok {
+			continue
+		}
+
+		articles = append(articles, withState(a.(*feed.Article), s.state(user, r.Article)))
 	}
 
-	return article, nil
+	return articles, nil
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"github.com/google/uuid"
 	"reader/internal/feed"
+	"reader/internal/search"
 	"reflect"
 	"sync"
 	"testing"
@@ -34,7 +35,7 @@ func TestInMemoryStorage_Article(t *testing.T) {
 				articles:  tt.fields.articles,
 				minLatest: tt.fields.minLatest,
 			}
-			got, err := s.Article(tt.args.id)
+			got, err := s.Article(DefaultUser, tt.args.id)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Article() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -104,7 +105,7 @@ func TestInMemoryStorage_Latest(t *testing.T) {
 				articles:  tt.fields.articles,
 				minLatest: tt.fields.minLatest,
 			}
-			got, err := s.Latest(tt.args.offset)
+			got, err := s.Latest(DefaultUser, tt.args.offset, Filter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Latest() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -142,7 +143,7 @@ func TestInMemoryStorage_LatestFromFeed(t *testing.T) {
 				articles:  tt.fields.articles,
 				minLatest: tt.fields.minLatest,
 			}
-			got, err := s.LatestFromFeed(tt.args.id, tt.args.offset)
+			got, err := s.LatestFromFeed(DefaultUser, tt.args.id, tt.args.offset, Filter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("LatestFromFeed() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -237,18 +238,38 @@ func TestNewInMemoryStorage(t *testing.T) {
 			"latest limit",
 			args{0},
 			&InMemoryStorage{
-				feeds:     &sync.Map{},
-				articles:  &sync.Map{},
-				minLatest: 10,
+				feeds:         &sync.Map{},
+				articles:      &sync.Map{},
+				evicted:       &sync.Map{},
+				users:         &sync.Map{},
+				apiKeys:       &sync.Map{},
+				webhooks:      &sync.Map{},
+				deliveries:    &sync.Map{},
+				subscriptions: &sync.Map{},
+				folders:       &sync.Map{},
+				states:        &sync.Map{},
+				minLatest:     10,
+				index:         search.NewIndex(),
+				hooks:         &hooks{},
 			},
 		},
 		{
 			"latest greater than 0",
 			args{7},
 			&InMemoryStorage{
-				feeds:     &sync.Map{},
-				articles:  &sync.Map{},
-				minLatest: 7,
+				feeds:         &sync.Map{},
+				articles:      &sync.Map{},
+				evicted:       &sync.Map{},
+				users:         &sync.Map{},
+				apiKeys:       &sync.Map{},
+				webhooks:      &sync.Map{},
+				deliveries:    &sync.Map{},
+				subscriptions: &sync.Map{},
+				folders:       &sync.Map{},
+				states:        &sync.Map{},
+				minLatest:     7,
+				index:         search.NewIndex(),
+				hooks:         &hooks{},
 			},
 		},
 	}
@@ -259,4 +280,4 @@ func TestNewInMemoryStorage(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrSubscribed   = errors.New("already subscribed to feed")
+)
+
+// DefaultUser is the user which owns requests that do not identify a
+// user, so that a single user instance works without creating any users.
+// The default user is never stored.
+var DefaultUser = uuid.Nil
+
+// User is someone with their own subscriptions and article state.
+// Feeds and articles themselves are shared between all users so that
+// a feed is only ever read once no matter how many users subscribe to it.
+type User struct {
+	UUID uuid.UUID
+	Name string
+}
+
+// subscribedFeeds restricts the feeds of a search query to the given
+// subscriptions. When the query is not restricted to any feeds all of
+// the subscriptions are used.
+func subscribedFeeds(feeds []uuid.UUID, subscriptions []uuid.UUID) []uuid.UUID {
+	if len(feeds) == 0 {
+		return subscriptions
+	}
+
+	subscribed := make(map[uuid.UUID]bool, len(subscriptions))
+	for _, id := range subscriptions {
+		subscribed[id] = true
+	}
+
+	restricted := []uuid.UUID{}
+	for _, id := range feeds {
+		if subscribed[id] {
+			restricted = append(restricted, id)
+		}
+	}
+
+	return restricted
+}
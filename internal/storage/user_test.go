@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"reader/internal/feed"
+	"reader/internal/search"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_Users(t *testing.T) {
+	now := time.Now()
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			alice := &User{UUID: uuid.New(), Name: "alice"}
+			bob := &User{UUID: uuid.New(), Name: "bob"}
+
+			for _, u := range []*User{alice, bob} {
+				if err := s.AddUser(u); err != nil {
+					t.Fatalf("AddUser() error = %v", err)
+				}
+			}
+
+			if err := s.AddUser(alice); err != ErrUserExists {
+				t.Errorf("AddUser() of existing user error = %v, want %v", err, ErrUserExists)
+			}
+
+			if got, err := s.User(bob.UUID); err != nil || !reflect.DeepEqual(got, bob) {
+				t.Errorf("User() got = %v, %v, want %v", got, err, bob)
+			}
+
+			if _, err := s.User(uuid.New()); err != ErrUserNotFound {
+				t.Errorf("User() of unknown user error = %v, want %v", err, ErrUserNotFound)
+			}
+
+			shared := testFeed("shared.local")
+			private := testFeed("private.local")
+			a1 := testArticle("https://shared.local/1", now.Add(-2*time.Hour))
+			a2 := testArticle("https://private.local/1", now.Add(-1*time.Hour))
+
+			if err := s.Store(shared, []*feed.Article{a1}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			if err := s.Store(private, []*feed.Article{a2}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			for _, sub := range []struct {
+				user uuid.UUID
+				feed uuid.UUID
+			}{
+				{alice.UUID, shared.UUID()},
+				{alice.UUID, private.UUID()},
+				{bob.UUID, shared.UUID()},
+			} {
+				if err := s.Subscribe(sub.user, sub.feed); err != nil {
+					t.Fatalf("Subscribe() error = %v", err)
+				}
+			}
+
+			if err := s.Subscribe(bob.UUID, shared.UUID()); err != ErrSubscribed {
+				t.Errorf("Subscribe() twice error = %v, want %v", err, ErrSubscribed)
+			}
+
+			if err := s.Subscribe(bob.UUID, feed.UUIDFromString("oops")); err != ErrFeedNotFound {
+				t.Errorf("Subscribe() to unknown feed error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			feeds, err := s.Subscriptions(bob.UUID)
+			if err != nil {
+				t.Fatalf("Subscriptions() error = %v", err)
+			}
+
+			if len(feeds) != 1 || feeds[0].UUID() != shared.UUID() {
+				t.Errorf("Subscriptions() got = %v, want %v", feeds, []*feed.Feed{shared})
+			}
+
+			subscribers, err := s.Subscribers(shared.UUID())
+			if err != nil {
+				t.Fatalf("Subscribers() error = %v", err)
+			}
+
+			if len(subscribers) != 2 {
+				t.Errorf("Subscribers() got = %v, want 2 users", subscribers)
+			}
+
+			// Bob must not be able to see articles from feeds he is not subscribed to
+			latest, err := s.Latest(bob.UUID, now, Filter{})
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+
+			if len(latest) != 1 || latest[0].Link != a1.Link {
+				t.Errorf("Latest() got = %v, want %v", latest, []*feed.Article{a1})
+			}
+
+			if _, err := s.LatestFromFeed(bob.UUID, private.UUID(), now, Filter{}); err != ErrFeedNotFound {
+				t.Errorf("LatestFromFeed() of unsubscribed feed error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			if _, err := s.Article(bob.UUID, a2.UUID()); err != ErrArticleNotFound {
+				t.Errorf("Article() of unsubscribed feed error = %v, want %v", err, ErrArticleNotFound)
+			}
+
+			q, _ := search.ParseQuery("description")
+			found, err := s.Search(bob.UUID, q)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if len(found) != 1 || found[0].Link != a1.Link {
+				t.Errorf("Search() got = %v, want %v", found, []*feed.Article{a1})
+			}
+
+			// Article state is kept per user
+			if err := s.MarkRead(alice.UUID, a1.UUID(), true); err != nil {
+				t.Fatalf("MarkRead() error = %v", err)
+			}
+
+			if err := s.Star(bob.UUID, a1.UUID(), true); err != nil {
+				t.Fatalf("Star() error = %v", err)
+			}
+
+			for user, want := range map[uuid.UUID]feed.State{
+				alice.UUID: {Read: true},
+				bob.UUID:   {Starred: true},
+			} {
+				got, err := s.Article(user, a1.UUID())
+				if err != nil {
+					t.Fatalf("Article() error = %v", err)
+				}
+
+				if got.State != want {
+					t.Errorf("Article() state = %+v, want %+v", got.State, want)
+				}
+			}
+
+			// Articles starred by any user are kept
+			if _, err := s.Compact(RetentionPolicy{MaxAge: time.Minute}); err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			if _, err := s.Article(alice.UUID, a1.UUID()); err != nil {
+				t.Errorf("Article() of article starred by another user error = %v", err)
+			}
+
+			if err := s.Unsubscribe(bob.UUID, shared.UUID()); err != nil {
+				t.Fatalf("Unsubscribe() error = %v", err)
+			}
+
+			if err := s.Unsubscribe(bob.UUID, shared.UUID()); err != ErrFeedNotFound {
+				t.Errorf("Unsubscribe() twice error = %v, want %v", err, ErrFeedNotFound)
+			}
+
+			if latest, _ := s.Latest(bob.UUID, now, Filter{}); len(latest) != 0 {
+				t.Errorf("Latest() after Unsubscribe() got = %v, want none", latest)
+			}
+		})
+	}
+}
+
+func Test_subscribedFeeds(t *testing.T) {
+	f1 := feed.UUIDFromString("https://mock.local")
+	f2 := feed.UUIDFromString("https://mock2.local")
+	f3 := feed.UUIDFromString("https://mock3.local")
+
+	tests := []struct {
+		name          string
+		feeds         []uuid.UUID
+		subscriptions []uuid.UUID
+		want          []uuid.UUID
+	}{
+		{"no feeds", nil, []uuid.UUID{f1, f2}, []uuid.UUID{f1, f2}},
+		{"restricted", []uuid.UUID{f2, f3}, []uuid.UUID{f1, f2}, []uuid.UUID{f2}},
+		{"none subscribed", []uuid.UUID{f3}, []uuid.UUID{f1}, []uuid.UUID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subscribedFeeds(tt.feeds, tt.subscriptions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subscribedFeeds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
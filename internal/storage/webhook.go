@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// maxDeliveries is the number of delivery attempts kept for each
+// webhook, older attempts are removed as new ones are added
+const maxDeliveries = 100
+
+// Webhook is a URL new articles are posted to as they are stored
+type Webhook struct {
+	UUID uuid.UUID
+	User uuid.UUID
+	URL  string
+
+	// Feeds articles are posted from. Articles from every feed the user
+	// is subscribed to are posted when there are none.
+	Feeds []uuid.UUID
+
+	// Secret posted articles are signed with, they are not signed
+	// when it is empty
+	Secret string
+
+	CreatedAt time.Time
+}
+
+// Matches reports whether articles from the given feed are posted
+func (w *Webhook) Matches(feed uuid.UUID) bool {
+	if len(w.Feeds) == 0 {
+		return true
+	}
+
+	for _, f := range w.Feeds {
+		if f == feed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is a single attempt at posting an article to a webhook
+type Delivery struct {
+	// UUID of the delivery, which is the same for every attempt at
+	// posting the same article
+	UUID    uuid.UUID
+	Webhook uuid.UUID
+	Article uuid.UUID
+	Attempt int
+
+	// Status code the webhook responded with, if it responded at all
+	StatusCode int
+
+	// Why the attempt failed, empty when it succeeded
+	Error string
+
+	At time.Time
+}
+
+// sortWebhooks sorts webhooks by when they were created, oldest first
+func sortWebhooks(hooks []*Webhook) {
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+}
+
+// newestFirst returns deliveries which are kept oldest first, newest first
+func newestFirst(deliveries []*Delivery) []*Delivery {
+	reversed := make([]*Delivery, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		reversed = append(reversed, deliveries[i])
+	}
+
+	return reversed
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Matches(t *testing.T) {
+	f1, f2 := uuid.New(), uuid.New()
+
+	if !(&Webhook{}).Matches(f1) {
+		t.Errorf("Matches() of webhook without feeds = false, want true")
+	}
+
+	w := &Webhook{Feeds: []uuid.UUID{f1}}
+	if !w.Matches(f1) || w.Matches(f2) {
+		t.Errorf("Matches() got = %v %v, want true false", w.Matches(f1), w.Matches(f2))
+	}
+}
+
+func TestStorage_Webhooks(t *testing.T) {
+	now := time.Now().UTC()
+
+	bs, _ := newTestBoltStorage(t, 10)
+	defer bs.Close()
+
+	storages := map[string]Storage{
+		"in memory": NewInMemoryStorage(10),
+		"bolt":      bs,
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			first := &Webhook{UUID: uuid.New(), URL: "https://first.local", Secret: "secret", CreatedAt: now.Add(-time.Hour)}
+			second := &Webhook{UUID: uuid.New(), URL: "https://second.local", Feeds: []uuid.UUID{uuid.New()}, CreatedAt: now}
+
+			for _, w := range []*Webhook{second, first} {
+				if err := s.AddWebhook(w); err != nil {
+					t.Fatalf("AddWebhook() error = %v", err)
+				}
+			}
+
+			hooks, err := s.Webhooks()
+			if err != nil || !reflect.DeepEqual(hooks, []*Webhook{first, second}) {
+				t.Errorf("Webhooks() got = %v, %v, want %v %v", hooks, err, first, second)
+			}
+
+			if got, err := s.Webhook(second.UUID); err != nil || !reflect.DeepEqual(got, second) {
+				t.Errorf("Webhook() got = %v, %v, want %v", got, err, second)
+			}
+
+			if _, err := s.Webhook(uuid.New()); err != ErrWebhookNotFound {
+				t.Errorf("Webhook() of unknown webhook error = %v, want %v", err, ErrWebhookNotFound)
+			}
+
+			for i := 1; i <= maxDeliveries+1; i++ {
+				d := &Delivery{UUID: uuid.New(), Webhook: first.UUID, Attempt: i, StatusCode: 500, At: now}
+				if err := s.AddDelivery(d); err != nil {
+					t.Fatalf("AddDelivery() error = %v", err)
+				}
+			}
+
+			if err := s.AddDelivery(&Delivery{Webhook: uuid.New()}); err != ErrWebhookNotFound {
+				t.Errorf("AddDelivery() to unknown webhook error = %v, want %v", err, ErrWebhookNotFound)
+			}
+
+			// Only the most recent deliveries are kept, newest first
+			deliveries, err := s.Deliveries(first.UUID)
+			if err != nil {
+				t.Fatalf("Deliveries() error = %v", err)
+			}
+
+			if len(deliveries) != maxDeliveries || deliveries[0].Attempt != maxDeliveries+1 || deliveries[maxDeliveries-1].Attempt != 2 {
+				t.Errorf("Deliveries() got %v deliveries, want %v newest first", len(deliveries), maxDeliveries)
+			}
+
+			if deliveries, err := s.Deliveries(second.UUID); err != nil || len(deliveries) != 0 {
+				t.Errorf("Deliveries() of webhook without deliveries got = %v, %v", deliveries, err)
+			}
+
+			if err := s.DeleteWebhook(first.UUID); err != nil {
+				t.Fatalf("DeleteWebhook() error = %v", err)
+			}
+
+			if err := s.DeleteWebhook(first.UUID); err != ErrWebhookNotFound {
+				t.Errorf("DeleteWebhook() twice error = %v, want %v", err, ErrWebhookNotFound)
+			}
+
+			if _, err := s.Deliveries(first.UUID); err != ErrWebhookNotFound {
+				t.Errorf("Deliveries() of deleted webhook error = %v, want %v", err, ErrWebhookNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package syndication
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reader/internal/feed"
+	"time"
+)
+
+// Format is a feed format timelines can be written in
+type Format string
+
+const (
+	RSS      Format = "rss"
+	Atom     Format = "atom"
+	JSONFeed Format = "json"
+)
+
+// ContentType returns the media type documents of the format are served as
+func (f Format) ContentType() string {
+	switch f {
+	case RSS:
+		return "application/rss+xml; charset=utf-8"
+	case Atom:
+		return "application/atom+xml; charset=utf-8"
+	case JSONFeed:
+		return "application/feed+json; charset=utf-8"
+	}
+
+	return ""
+}
+
+// Timeline is a list of articles which is published as a feed of its own
+type Timeline struct {
+	Title string
+
+	// Link of the site the timeline belongs to, if any
+	Link string
+
+	// Link the timeline itself is published at
+	FeedLink string
+
+	Articles []*feed.Article
+}
+
+// Write encodes the timeline in the given format
+func (t *Timeline) Write(w io.Writer, format Format) error {
+	switch format {
+	case RSS:
+		return t.writeXML(w, t.rss())
+	case Atom:
+		return t.writeXML(w, t.atom())
+	case JSONFeed:
+		return json.NewEncoder(w).Encode(t.jsonFeed())
+	}
+
+	return fmt.Errorf("unknown feed format %q", format)
+}
+
+func (t *Timeline) writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+
+	return e.Encode(v)
+}
+
+// updated returns when the newest article in the timeline was
+// published, or the current time when the timeline is empty.
+func (t *Timeline) updated() time.Time {
+	var updated time.Time
+	for _, a := range t.Articles {
+		if a.Published.After(updated) {
+			updated = a.Published
+		}
+	}
+
+	if updated.IsZero() {
+		return time.Now()
+	}
+
+	return updated
+}
+
+// articleID returns an identifier for an article which never changes
+func articleID(a *feed.Article) string {
+	return "urn:uuid:" + a.UUID().String()
+}
+
+// firstEnclosure returns the first audio or video enclosure of an
+// article, otherwise its first enclosure
+func firstEnclosure(a *feed.Article) *feed.Enclosure {
+	for _, e := range a.Enclosures {
+		if e.Media() {
+			return e
+		}
+	}
+
+	if len(a.Enclosures) > 0 {
+		return a.Enclosures[0]
+	}
+
+	return nil
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Content string     `xml:"xmlns:content,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	Content     string        `xml:"content:encoded,omitempty"`
+	Creators    []string      `xml:"dc:creator"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (t *Timeline) rss() rss {
+	link := t.Link
+	if link == "" {
+		link = t.FeedLink
+	}
+
+	c := rssChannel{
+		Title:         t.Title,
+		Link:          link,
+		Description:   t.Title,
+		LastBuildDate: t.updated().Format(time.RFC1123Z),
+		Self:          atomLink{Href: t.FeedLink, Rel: "self", Type: RSS.ContentType()},
+		Items:         make([]rssItem, 0, len(t.Articles)),
+	}
+
+	for _, a := range t.Articles {
+		item := rssItem{
+			Title:       a.Title,
+			Link:        a.Link,
+			Description: a.Description,
+			Content:     a.Content,
+			Categories:  a.Categories,
+			GUID:        rssGUID{Value: articleID(a)},
+		}
+
+		// RSS items only have a single enclosure, which is the first
+		// audio or video enclosure when there is one
+		if e := firstEnclosure(a); e != nil {
+			item.Enclosure = &rssEnclosure{URL: e.URL, Length: e.Length, Type: e.Type}
+		}
+
+		// RSS authors must be email addresses, so names are given
+		// as Dublin Core creators instead
+		for _, p := range a.Authors {
+			if p.Name != "" {
+				item.Creators = append(item.Creators, p.Name)
+			}
+		}
+
+		if !a.Published.IsZero() {
+			item.PubDate = a.Published.Format(time.RFC1123Z)
+		}
+
+		c.Items = append(c.Items, item)
+	}
+
+	return rss{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: c,
+	}
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Authors    []atomAuthor   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Links      []atomLink     `xml:"link"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (t *Timeline) atom() atom {
+	updated := t.updated()
+
+	a := atom{
+		ID:      t.FeedLink,
+		Title:   t.Title,
+		Updated: updated.Format(time.RFC3339),
+		Author:  atomAuthor{Name: t.Title},
+		Links:   []atomLink{{Href: t.FeedLink, Rel: "self", Type: Atom.ContentType()}},
+		Entries: make([]atomEntry, 0, len(t.Articles)),
+	}
+
+	if t.Link != "" {
+		a.Links = append(a.Links, atomLink{Href: t.Link, Rel: "alternate"})
+	}
+
+	for _, article := range t.Articles {
+		// Entries must have an updated time, which is only known for
+		// articles which have been updated or published
+		entryUpdated := article.Updated
+		if entryUpdated.IsZero() {
+			entryUpdated = article.Published
+		}
+
+		if entryUpdated.IsZero() {
+			entryUpdated = updated
+		}
+
+		e := atomEntry{
+			ID:      articleID(article),
+			Title:   article.Title,
+			Updated: entryUpdated.Format(time.RFC3339),
+			Links:   []atomLink{},
+		}
+
+		if !article.Published.IsZero() {
+			e.Published = article.Published.Format(time.RFC3339)
+		}
+
+		if article.Link != "" {
+			e.Links = append(e.Links, atomLink{Href: article.Link, Rel: "alternate"})
+		}
+
+		for _, enc := range article.Enclosures {
+			e.Links = append(e.Links, atomLink{Href: enc.URL, Rel: "enclosure", Type: enc.Type, Length: enc.Length})
+		}
+
+		if article.Description != "" {
+			e.Summary = &atomText{Type: "html", Value: article.Description}
+		}
+
+		if article.Content != "" {
+			e.Content = &atomText{Type: "html", Value: article.Content}
+		}
+
+		for _, p := range article.Authors {
+			e.Authors = append(e.Authors, atomAuthor{Name: p.Name, Email: p.Email})
+		}
+
+		for _, c := range article.Categories {
+			e.Categories = append(e.Categories, atomCategory{Term: c})
+		}
+
+		a.Entries = append(a.Entries, e)
+	}
+
+	return a
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Author        *jsonFeedAuthor      `json:"author,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string `json:"url"`
+	MIMEType          string `json:"mime_type"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds uint   `json:"duration_in_seconds,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func (t *Timeline) jsonFeed() jsonFeed {
+	f := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       t.Title,
+		HomePageURL: t.Link,
+		FeedURL:     t.FeedLink,
+		Items:       make([]jsonFeedItem, 0, len(t.Articles)),
+	}
+
+	for _, a := range t.Articles {
+		item := jsonFeedItem{
+			ID:          articleID(a),
+			URL:         a.Link,
+			Title:       a.Title,
+			ContentHTML: a.Description,
+		}
+
+		// Full content is preferred, with the description as a summary
+		if a.Content != "" {
+			item.ContentHTML = a.Content
+			item.Summary = a.Description
+		}
+
+		if !a.Published.IsZero() {
+			item.DatePublished = a.Published.Format(time.RFC3339)
+		}
+
+		if !a.Updated.IsZero() {
+			item.DateModified = a.Updated.Format(time.RFC3339)
+		}
+
+		for _, p := range a.Authors {
+			if p.Name != "" {
+				item.Authors = append(item.Authors, jsonFeedAuthor{Name: p.Name})
+			}
+		}
+
+		// The first author is also given as in version 1.0 for readers
+		// which do not support version 1.1 yet
+		if len(item.Authors) > 0 {
+			item.Author = &item.Authors[0]
+		}
+
+		item.Tags = a.Categories
+
+		for _, e := range a.Enclosures {
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{
+				URL:               e.URL,
+				MIMEType:          e.Type,
+				SizeInBytes:       e.Length,
+				DurationInSeconds: e.Duration,
+			})
+		}
+
+		if a.Image != nil {
+			item.Image = a.Image.URL
+		}
+
+		f.Items = append(f.Items, item)
+	}
+
+	return f
+}
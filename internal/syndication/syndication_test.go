@@ -0,0 +1,144 @@
+package syndication
+
+import (
+	"bytes"
+	"github.com/mmcdole/gofeed"
+	"reader/internal/feed"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTimeline() *Timeline {
+	return &Timeline{
+		Title:    "Mock & Feed",
+		Link:     "https://mock.local",
+		FeedLink: "https://reader.local/latest",
+		Articles: []*feed.Article{
+			{
+				Link:        "https://mock.local/article/2",
+				Published:   time.Date(2020, 1, 1, 1, 1, 1, 0, time.UTC),
+				Title:       "Article 2",
+				Description: "<p>This is the <b>second</b> article</p>",
+				Image:       &feed.Image{URL: "https://mock.local/2.png"},
+				Content:     "<p>This is all of the <b>second</b> article</p>",
+				Authors:     []*feed.Person{{Name: "Jane Doe"}},
+				Categories:  []string{"Go", "Testing"},
+				Enclosures: []*feed.Enclosure{
+					{URL: "https://mock.local/2.mp3", Type: "audio/mpeg", Length: 1024, Duration: 60},
+				},
+			},
+			{
+				GUID:        "article-1",
+				Link:        "https://mock.local/article/1",
+				Published:   time.Date(2010, 1, 1, 1, 1, 1, 0, time.UTC),
+				Title:       "Article 1",
+				Description: "This is the first article",
+			},
+		},
+	}
+}
+
+func TestTimeline_Write(t *testing.T) {
+	for _, format := range []Format{RSS, Atom, JSONFeed} {
+		t.Run(string(format), func(t *testing.T) {
+			tl := testTimeline()
+
+			var b bytes.Buffer
+			if err := tl.Write(&b, format); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			// Written documents must be read back as the same timeline
+			f, err := gofeed.NewParser().Parse(&b)
+			if err != nil {
+				t.Fatalf("could not parse written %v feed: %v", format, err)
+			}
+
+			if f.Title != tl.Title {
+				t.Errorf("Title got = %v, want %v", f.Title, tl.Title)
+			}
+
+			if len(f.Items) != len(tl.Articles) {
+				t.Fatalf("Items got = %v, want %v", len(f.Items), len(tl.Articles))
+			}
+
+			for i, item := range f.Items {
+				a := tl.Articles[i]
+
+				if item.Link != a.Link || item.Title != a.Title {
+					t.Errorf("Item %v got = %v %v, want %v %v", i, item.Link, item.Title, a.Link, a.Title)
+				}
+
+				if item.GUID != "urn:uuid:"+a.UUID().String() {
+					t.Errorf("Item %v GUID got = %v, want %v", i, item.GUID, a.UUID())
+				}
+
+				if item.PublishedParsed == nil || !item.PublishedParsed.Equal(a.Published) {
+					t.Errorf("Item %v Published got = %v, want %v", i, item.PublishedParsed, a.Published)
+				}
+
+				// JSON Feed items without a summary only have content
+				description := item.Description
+				if description == "" && a.Content == "" {
+					description = item.Content
+				}
+
+				if description != a.Description {
+					t.Errorf("Item %v Description got = %v, want %v", i, description, a.Description)
+				}
+
+				if a.Content != "" && item.Content != a.Content {
+					t.Errorf("Item %v Content got = %v, want %v", i, item.Content, a.Content)
+				}
+
+				if !reflect.DeepEqual(item.Categories, a.Categories) {
+					t.Errorf("Item %v Categories got = %v, want %v", i, item.Categories, a.Categories)
+				}
+
+				if len(item.Enclosures) != len(a.Enclosures) {
+					t.Fatalf("Item %v Enclosures got = %v, want %v", i, len(item.Enclosures), len(a.Enclosures))
+				}
+
+				// Lengths of JSON Feed attachments are read as their
+				// duration by the parser
+				for j, e := range item.Enclosures {
+					want := a.Enclosures[j]
+					length := strconv.FormatInt(want.Length, 10)
+					if format == JSONFeed {
+						length = strconv.FormatUint(uint64(want.Duration), 10)
+					}
+
+					if e.URL != want.URL || e.Type != want.Type || e.Length != length {
+						t.Errorf("Item %v Enclosure got = %+v, want %+v", i, e, want)
+					}
+				}
+
+				for _, p := range a.Authors {
+					if item.Author == nil || item.Author.Name != p.Name {
+						t.Errorf("Item %v Author got = %v, want %v", i, item.Author, p.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTimeline_Write_Empty(t *testing.T) {
+	for _, format := range []Format{RSS, Atom, JSONFeed} {
+		var b bytes.Buffer
+		if err := (&Timeline{Title: "Empty"}).Write(&b, format); err != nil {
+			t.Fatalf("Write() of %v error = %v", format, err)
+		}
+
+		if _, err := gofeed.NewParser().Parse(&b); err != nil {
+			t.Errorf("could not parse written empty %v feed: %v", format, err)
+		}
+	}
+
+	if err := testTimeline().Write(&bytes.Buffer{}, Format("xml")); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("Write() of unknown format error = %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 of the request body, signed
+	// with the secret of the webhook, as sha256=<hex>
+	SignatureHeader = "X-Reader-Signature"
+
+	// DeliveryHeader holds the UUID of the delivery, which is the same
+	// for every attempt so that receivers can ignore repeats
+	DeliveryHeader = "X-Reader-Delivery"
+
+	// EventHeader holds the kind of event being delivered
+	EventHeader = "X-Reader-Event"
+)
+
+// EventArticleAdded is delivered when a feed publishes a new article
+const EventArticleAdded = "article.added"
+
+// maxDrain is how much of a response body is read so that the connection
+// can be reused. Connections with longer responses are closed instead.
+const maxDrain = 64 << 10
+
+// Payload is the body posted to webhooks
+type Payload struct {
+	Event   string
+	Webhook uuid.UUID
+	Feed    uuid.UUID
+	Article *feed.Article
+}
+
+// Sign returns the signature of a body for the given secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher posts new articles to the webhooks interested in them
+type Dispatcher struct {
+	s storage.Storage
+	c *http.Client
+
+	// Number of times a delivery is attempted before giving up
+	attempts int
+
+	// Wait after the first failed attempt, which doubles after every
+	// consecutive failure
+	backoff time.Duration
+
+	// Maximum number of deliveries made at the same time
+	workers int
+
+	// Changes which have been stored but not yet dispatched
+	mu      sync.Mutex
+	pending []storage.Change
+	wake    chan struct{}
+}
+
+type Option func(*Dispatcher)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.c = client
+	}
+}
+
+// WithRetries sets how many times a delivery is attempted and how long
+// to wait after the first failure. The wait doubles after every failure.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		if attempts <= 0 {
+			attempts = 1
+		}
+
+		d.attempts = attempts
+		d.backoff = backoff
+	}
+}
+
+func WithWorkers(workers int) Option {
+	return func(d *Dispatcher) {
+		if workers <= 0 {
+			workers = 1
+		}
+
+		d.workers = workers
+	}
+}
+
+// NewDispatcher creates a dispatcher for the webhooks in the given
+// storage. Articles stored from now on are delivered once Run is called.
+func NewDispatcher(s storage.Storage, options ...Option) *Dispatcher {
+	d := &Dispatcher{
+		s:    s,
+		wake: make(chan struct{}, 1),
+	}
+
+	defaultOptions := []Option{
+		WithHTTPClient(&http.Client{Timeout: 10 * time.Second}),
+		WithRetries(5, 10*time.Second),
+		WithWorkers(4),
+	}
+
+	for _, opt := range append(defaultOptions, options...) {
+		opt(d)
+	}
+
+	s.OnStore(d.enqueue)
+
+	return d
+}
+
+// enqueue keeps a change to be dispatched without blocking storage
+func (d *Dispatcher) enqueue(c storage.Change) {
+	if len(c.Added) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	d.pending = append(d.pending, c)
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// delivery is a single article to be posted to a single webhook
+type delivery struct {
+	id      uuid.UUID
+	hook    *storage.Webhook
+	feed    uuid.UUID
+	article *feed.Article
+}
+
+// Run will deliver articles as they are stored until the given context
+// is closed. Any errors which occur while delivering are sent on the
+// returned channel, which is closed once every delivery has stopped.
+func (d *Dispatcher) Run(ctx context.Context) <-chan error {
+	errs := make(chan error)
+	work := make(chan delivery)
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for dl := range work {
+				if err := d.deliver(ctx, dl); err != nil {
+					select {
+					case errs <- err:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(work)
+			wg.Wait()
+			close(errs)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+			}
+
+			d.mu.Lock()
+			pending := d.pending
+			d.pending = nil
+			d.mu.Unlock()
+
+			deliveries, err := d.deliveries(pending)
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			for _, dl := range deliveries {
+				select {
+				case work <- dl:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return errs
+}
+
+// deliveries returns the deliveries to make for the given changes
+func (d *Dispatcher) deliveries(changes []storage.Change) ([]delivery, error) {
+	hooks, err := d.s.Webhooks()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve webhooks: %w", err)
+	}
+
+	deliveries := []delivery{}
+	for _, c := range changes {
+		for _, hook := range hooks {
+			if !hook.Matches(c.Feed) {
+				continue
+			}
+
+			for _, id := range c.Added {
+				// Articles are only posted to users subscribed to their feed
+				article, err := d.s.Article(hook.User, id)
+				if err != nil {
+					continue
+				}
+
+				deliveries = append(deliveries, delivery{
+					id:      uuid.New(),
+					hook:    hook,
+					feed:    c.Feed,
+					article: article,
+				})
+			}
+		}
+	}
+
+	return deliveries, nil
+}
+
+// deliver posts an article to a webhook, retrying with backoff until
+// the webhook accepts it. Every attempt is recorded in storage.
+func (d *Dispatcher) deliver(ctx context.Context, dl delivery) error {
+	body, err := json.Marshal(Payload{
+		Event:   EventArticleAdded,
+		Webhook: dl.hook.UUID,
+		Feed:    dl.feed,
+		Article: dl.article,
+	})
+	if err != nil {
+		return err
+	}
+
+	wait := d.backoff
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		status, postErr := d.post(ctx, dl, body)
+
+		// Deliveries cut short by shutting down are not recorded
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		record := &storage.Delivery{
+			UUID:       dl.id,
+			Webhook:    dl.hook.UUID,
+			Article:    dl.article.UUID(),
+			Attempt:    attempt,
+			StatusCode: status,
+			At:         time.Now(),
+		}
+
+		if postErr != nil {
+			record.Error = postErr.Error()
+		}
+
+		if err := d.s.AddDelivery(record); err != nil {
+			// The webhook has been deleted since, so stop delivering to it
+			if errors.Is(err, storage.ErrWebhookNotFound) {
+				return nil
+			}
+
+			return fmt.Errorf("could not record delivery to %v: %w", dl.hook.URL, err)
+		}
+
+		if postErr == nil {
+			return nil
+		}
+
+		if !retry(status) {
+			return fmt.Errorf("could not deliver to %v: %w", dl.hook.URL, postErr)
+		}
+
+		if attempt == d.attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+
+	return fmt.Errorf("could not deliver to %v after %d attempts", dl.hook.URL, d.attempts)
+}
+
+// post makes a single attempt at posting a body to a webhook, returning
+// the status code the webhook responded with, if any
+func (d *Dispatcher) post(ctx context.Context, dl delivery, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, EventArticleAdded)
+	req.Header.Set(DeliveryHeader, dl.id.String())
+
+	if dl.hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(dl.hook.Secret, body))
+	}
+
+	resp, err := d.c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrain))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// retry reports whether a failed delivery is worth another attempt.
+// Requests which were rejected by the webhook are not attempted again,
+// unless it is only asking for fewer requests.
+func retry(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
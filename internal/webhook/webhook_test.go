@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reader/internal/feed"
+	"reader/internal/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver records the requests posted to it, failing the first
+// attempt at each delivery with the given status code
+type receiver struct {
+	mu       sync.Mutex
+	fail     int
+	attempts map[string]int
+	payloads []Payload
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	id := r.Header.Get(DeliveryHeader)
+	rc.attempts[id]++
+	if rc.attempts[id] == 1 && rc.fail != 0 {
+		w.WriteHeader(rc.fail)
+		return
+	}
+
+	var p Payload
+	json.Unmarshal(body, &p)
+
+	rc.payloads = append(rc.payloads, p)
+	rc.headers = append(rc.headers, r.Header)
+	rc.bodies = append(rc.bodies, body)
+}
+
+func testFeed(host string) *feed.Feed {
+	return &feed.Feed{FeedLink: &url.URL{Scheme: "https", Host: host}, Title: host}
+}
+
+func TestDispatcher(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	user := uuid.New()
+
+	wanted := testFeed("wanted.local")
+	other := testFeed("other.local")
+	unsubscribed := testFeed("unsubscribed.local")
+
+	for _, f := range []*feed.Feed{wanted, other, unsubscribed} {
+		if err := s.Store(f, nil); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	for _, f := range []*feed.Feed{wanted, other} {
+		if err := s.Subscribe(user, f.UUID()); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+	}
+
+	rc := &receiver{fail: http.StatusServiceUnavailable, attempts: map[string]int{}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	hook := &storage.Webhook{
+		UUID:   uuid.New(),
+		User:   user,
+		URL:    srv.URL,
+		Feeds:  []uuid.UUID{wanted.UUID(), unsubscribed.UUID()},
+		Secret: "secret",
+	}
+	if err := s.AddWebhook(hook); err != nil {
+		t.Fatalf("AddWebhook() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := NewDispatcher(s, WithRetries(3, time.Millisecond)).Run(ctx)
+
+	// Only new articles from feeds the webhook wants and the user is
+	// subscribed to are delivered
+	article := &feed.Article{Link: "https://wanted.local/1", Title: "Wanted"}
+	stores := []struct {
+		f        *feed.Feed
+		articles []*feed.Article
+	}{
+		{other, []*feed.Article{{Link: "https://other.local/1"}}},
+		{unsubscribed, []*feed.Article{{Link: "https://unsubscribed.local/1"}}},
+		{wanted, []*feed.Article{article}},
+		{wanted, []*feed.Article{article}},
+	}
+	for _, st := range stores {
+		if err := s.Store(st.f, st.articles); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	var deliveries []*storage.Delivery
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		deliveries, _ = s.Deliveries(hook.UUID)
+		if len(deliveries) >= 2 {
+			break
+		}
+	}
+
+	cancel()
+	for err := range errs {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if len(rc.payloads) != 1 {
+		t.Fatalf("delivered payloads want 1 got %v", len(rc.payloads))
+	}
+
+	p := rc.payloads[0]
+	if p.Event != EventArticleAdded || p.Webhook != hook.UUID || p.Feed != wanted.UUID() || p.Article == nil || p.Article.Link != article.Link {
+		t.Errorf("payload got %+v", p)
+	}
+
+	if sig := rc.headers[0].Get(SignatureHeader); sig != Sign("secret", rc.bodies[0]) {
+		t.Errorf("%v want %v got %v", SignatureHeader, Sign("secret", rc.bodies[0]), sig)
+	}
+
+	// Both attempts are recorded as the same delivery, newest first
+	if len(deliveries) != 2 {
+		t.Fatalf("Deliveries() want 2 got %v", len(deliveries))
+	}
+
+	failed, succeeded := deliveries[1], deliveries[0]
+	if failed.Attempt != 1 || failed.StatusCode != http.StatusServiceUnavailable || failed.Error == "" {
+		t.Errorf("first attempt got %+v", failed)
+	}
+
+	if succeeded.Attempt != 2 || succeeded.StatusCode != http.StatusOK || succeeded.Error != "" || succeeded.UUID != failed.UUID {
+		t.Errorf("second attempt got %+v", succeeded)
+	}
+
+	if succeeded.Article != article.UUID() {
+		t.Errorf("delivered article want %v got %v", article.UUID(), succeeded.Article)
+	}
+}
+
+func TestDispatcher_Rejected(t *testing.T) {
+	s := storage.NewInMemoryStorage(10)
+	f := testFeed("mock.local")
+
+	if err := s.Store(f, nil); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := s.Subscribe(storage.DefaultUser, f.UUID()); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	rc := &receiver{fail: http.StatusGone, attempts: map[string]int{}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	hook := &storage.Webhook{UUID: uuid.New(), URL: srv.URL}
+	if err := s.AddWebhook(hook); err != nil {
+		t.Fatalf("AddWebhook() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := NewDispatcher(s, WithRetries(3, time.Millisecond)).Run(ctx)
+
+	if err := s.Store(f, []*feed.Article{{Link: "https://mock.local/1"}}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Deliveries rejected by the webhook are not attempted again
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Run() error = nil, want rejected delivery")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run() did not report rejected delivery")
+	}
+
+	if deliveries, err := s.Deliveries(hook.UUID); err != nil || len(deliveries) != 1 {
+		t.Errorf("Deliveries() got %v, %v, want 1 attempt", deliveries, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Signature from: echo -n 'body' | openssl dgst -sha256 -hmac secret
+	want := "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355"
+	if got := Sign("secret", []byte("body")); got != want {
+		t.Errorf("Sign() got = %v, want %v", got, want)
+	}
+}